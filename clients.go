@@ -0,0 +1,234 @@
+package stackshot
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/pkg/errors"
+)
+
+// defaultRoleSessionName is the session name used when assuming a role
+// without StackConfig.AssumeRoleSessionName.
+const defaultRoleSessionName = "stackshot"
+
+// clientKey identifies the account, region, and role a StackConfig targets.
+// The account is represented by the profile used to load credentials.
+type clientKey struct {
+	profile     string
+	region      string
+	roleARN     string
+	externalID  string
+	sessionName string
+}
+
+func newClientKey(profile, region, roleARN, externalID, sessionName string) clientKey {
+	key := clientKey{
+		profile: profile,
+		region:  region,
+		roleARN: roleARN,
+	}
+	if key.roleARN != "" {
+		key.externalID = externalID
+		key.sessionName = sessionName
+		if key.sessionName == "" {
+			key.sessionName = defaultRoleSessionName
+		}
+	}
+	return key
+}
+
+func stackClientKey(config *StackConfig) clientKey {
+	return newClientKey(
+		config.Profile,
+		config.Region,
+		config.AssumeRoleARN,
+		config.AssumeRoleExternalID,
+		config.AssumeRoleSessionName,
+	)
+}
+
+// Clients builds AWS clients for the profile, region, and role of each
+// StackConfig. Clients are cached so stacks sharing an account, region, and
+// role share a session, which lets a single run deploy stacks spanning
+// multiple accounts and regions.
+//
+// Settings a StackConfig leaves empty fall back to the environment and shared
+// configuration files, the same as the AWS CLI.
+type Clients struct {
+	// Metrics, when set, counts every API call made with the clients. Set it
+	// before building any clients.
+	Metrics *Metrics
+
+	mu         sync.Mutex
+	sessions   map[clientKey]*session.Session
+	clients    map[clientKey]cloudformationiface.CloudFormationAPI
+	identities map[clientKey]*Identity
+
+	// newSession loads a session from the environment and shared
+	// configuration for a profile and region. newCloudFormation and newSTS
+	// build clients from a session. They're replaced in tests.
+	newSession        func(profile, region string) (*session.Session, error)
+	newCloudFormation func(*session.Session) cloudformationiface.CloudFormationAPI
+	newSTS            func(*session.Session) stsiface.STSAPI
+}
+
+// Identity is the account and region a session deploys to.
+type Identity struct {
+	Account string
+	Region  string
+}
+
+// NewClients allocates an empty Clients cache.
+func NewClients() *Clients {
+	return &Clients{
+		sessions:   map[clientKey]*session.Session{},
+		clients:    map[clientKey]cloudformationiface.CloudFormationAPI{},
+		identities: map[clientKey]*Identity{},
+		newSession: sharedConfigSession,
+		newCloudFormation: func(sess *session.Session) cloudformationiface.CloudFormationAPI {
+			return cloudformation.New(sess)
+		},
+		newSTS: func(sess *session.Session) stsiface.STSAPI {
+			return sts.New(sess)
+		},
+	}
+}
+
+func sharedConfigSession(profile, region string) (*session.Session, error) {
+	options := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           profile,
+	}
+	if region != "" {
+		options.Config.Region = aws.String(region)
+	}
+	return session.NewSessionWithOptions(options)
+}
+
+// Session returns the session for the account, region, and role config
+// targets. When config assumes a role, the session's credentials are
+// temporary credentials for the role obtained with the profile's credentials.
+func (c *Clients) Session(config *StackConfig) (*session.Session, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.session(stackClientKey(config))
+}
+
+func (c *Clients) session(key clientKey) (*session.Session, error) {
+	if sess, ok := c.sessions[key]; ok {
+		return sess, nil
+	}
+
+	var sess *session.Session
+	var err error
+	if key.roleARN == "" {
+		sess, err = c.newSession(key.profile, key.region)
+		if err != nil {
+			return nil, err
+		}
+		c.Metrics.InstrumentSession(sess)
+	} else {
+		base, err := c.session(clientKey{profile: key.profile, region: key.region})
+		if err != nil {
+			return nil, err
+		}
+
+		credentials := stscreds.NewCredentials(base, key.roleARN, func(p *stscreds.AssumeRoleProvider) {
+			p.RoleSessionName = key.sessionName
+			if key.externalID != "" {
+				p.ExternalID = aws.String(key.externalID)
+			}
+		})
+		sess = base.Copy(&aws.Config{Credentials: credentials})
+	}
+
+	c.sessions[key] = sess
+	return sess, nil
+}
+
+// CloudFormation returns a Cloudformation client for the account, region,
+// and role config targets.
+func (c *Clients) CloudFormation(config *StackConfig) (cloudformationiface.CloudFormationAPI, error) {
+	return c.cloudFormation(stackClientKey(config))
+}
+
+// StackSetCloudFormation returns a Cloudformation client for the
+// administrator account, region, and role a StackSetConfig is managed from.
+func (c *Clients) StackSetCloudFormation(config *StackSetConfig) (cloudformationiface.CloudFormationAPI, error) {
+	return c.cloudFormation(
+		newClientKey(
+			config.Profile,
+			config.Region,
+			config.AssumeRoleARN,
+			config.AssumeRoleExternalID,
+			config.AssumeRoleSessionName,
+		),
+	)
+}
+
+func (c *Clients) cloudFormation(key clientKey) (cloudformationiface.CloudFormationAPI, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+
+	sess, err := c.session(key)
+	if err != nil {
+		return nil, err
+	}
+
+	client := c.newCloudFormation(sess)
+	c.clients[key] = client
+	return client, nil
+}
+
+// Identity returns the account and region config targets. Unlike config's
+// settings, which may be left empty, the identity is resolved from the
+// session's credentials and region, so configs reaching the same account and
+// region share an Identity.
+func (c *Clients) Identity(config *StackConfig) (*Identity, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := stackClientKey(config)
+	if identity, ok := c.identities[key]; ok {
+		return identity, nil
+	}
+
+	sess, err := c.session(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := c.newSTS(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load caller identity")
+	}
+
+	identity := &Identity{
+		Account: aws.StringValue(out.Account),
+		Region:  aws.StringValue(sess.Config.Region),
+	}
+	c.identities[key] = identity
+	return identity, nil
+}
+
+// Uploader returns an S3Uploader that uploads to buckets in the account and
+// region config targets.
+func (c *Clients) Uploader(config *StackConfig) (*S3Uploader, error) {
+	sess, err := c.Session(config)
+	if err != nil {
+		return nil, err
+	}
+	return NewS3Uploader(s3.New(sess), aws.StringValue(sess.Config.Region)), nil
+}
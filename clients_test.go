@@ -0,0 +1,92 @@
+package stackshot
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// newTestClients allocates Clients that build sessions with static
+// credentials instead of reading the environment. It records the number of
+// sessions built for each profile.
+func newTestClients(built map[string]int) *Clients {
+	clients := NewClients()
+	clients.newSession = func(profile, region string) (*session.Session, error) {
+		built[profile]++
+		return session.NewSession(&aws.Config{
+			Region:      aws.String(region),
+			Credentials: credentials.NewStaticCredentials(profile, "secret", ""),
+		})
+	}
+	return clients
+}
+
+func TestClients(t *testing.T) {
+	t.Run(
+		"Clients are cached per profile, region, and role",
+		func(t *testing.T) {
+			built := map[string]int{}
+			clients := newTestClients(built)
+
+			configs := []*StackConfig{
+				{Name: "a", Profile: "prod", Region: "us-east-1"},
+				{Name: "b", Profile: "prod", Region: "us-east-1"},
+				{Name: "c", Profile: "prod", Region: "eu-west-1"},
+				{Name: "d", Profile: "prod", Region: "us-east-1", AssumeRoleARN: "arn:aws:iam::123456789012:role/deployer"},
+			}
+
+			apis := []interface{}{}
+			for _, config := range configs {
+				api, err := clients.CloudFormation(config)
+				if err != nil {
+					t.Fatalf("Expected CloudFormation() to succeed. Got error: %s", err)
+				}
+				apis = append(apis, api)
+			}
+
+			if apis[0] != apis[1] {
+				t.Errorf("Expected stacks in the same account and region to share a client")
+			}
+			if apis[0] == apis[2] {
+				t.Errorf("Expected stacks in different regions to have different clients")
+			}
+			if apis[0] == apis[3] {
+				t.Errorf("Expected stacks assuming a role to have different clients")
+			}
+			if built["prod"] != 2 {
+				t.Errorf("Expected 2 sessions built for the prod profile. Got: %d", built["prod"])
+			}
+		},
+	)
+
+	t.Run(
+		"Assumed roles use the role's credentials",
+		func(t *testing.T) {
+			clients := newTestClients(map[string]int{})
+			config := &StackConfig{
+				Name:                 "a",
+				Region:               "us-west-2",
+				AssumeRoleARN:        "arn:aws:iam::123456789012:role/deployer",
+				AssumeRoleExternalID: "external-id",
+			}
+
+			sess, err := clients.Session(config)
+			if err != nil {
+				t.Fatalf("Expected Session() to succeed. Got error: %s", err)
+			}
+			base, err := clients.Session(&StackConfig{Name: "b", Region: "us-west-2"})
+			if err != nil {
+				t.Fatalf("Expected Session() to succeed. Got error: %s", err)
+			}
+
+			if sess.Config.Credentials == base.Config.Credentials {
+				t.Errorf("Expected the role's session to use different credentials")
+			}
+			if aws.StringValue(sess.Config.Region) != "us-west-2" {
+				t.Errorf("Expected region us-west-2. Got: %s", aws.StringValue(sess.Config.Region))
+			}
+		},
+	)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+// githubCI makes a sync's output GitHub Actions aware: output is grouped by
+// stack, failures are annotated on their configuration files, and a
+// deployment summary is written to $GITHUB_STEP_SUMMARY. Its methods do
+// nothing when it's nil so callers don't check whether -ci is set.
+type githubCI struct{}
+
+// newCI returns the CI integration named by -ci, or nil when name is empty.
+func newCI(name string) (*githubCI, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "github":
+		return &githubCI{}, nil
+	}
+	return nil, fmt.Errorf("Unknown CI %s. Only github is supported", name)
+}
+
+// group starts a collapsible group of output titled title.
+func (g *githubCI) group(title string) {
+	if g == nil {
+		return
+	}
+	fmt.Printf("::group::%s\n", title)
+}
+
+func (g *githubCI) endGroup() {
+	if g == nil {
+		return
+	}
+	fmt.Println("::endgroup::")
+}
+
+// annotate annotates file, which may be empty, with err.
+func (g *githubCI) annotate(file, title string, err error) {
+	if g == nil {
+		return
+	}
+	fmt.Println(stackshot.GitHubError(file, title, err.Error()))
+}
+
+// finish annotates every failed stack's configuration file and writes the
+// deployment summary when $GITHUB_STEP_SUMMARY is set.
+func (g *githubCI) finish(summaries []*stackshot.StackSummary) error {
+	if g == nil {
+		return nil
+	}
+
+	for _, summary := range summaries {
+		if summary.Result != stackshot.SyncFailed {
+			continue
+		}
+		title := "Failed to sync " + summary.Name
+		if summary.Region != "" {
+			title += " in " + summary.Region
+		}
+		fmt.Println(stackshot.GitHubError(summary.File, title, summary.Error))
+	}
+
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to write deployment summary")
+	}
+	err = stackshot.WriteGitHubSummary(file, summaries)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrap(err, "failed to write deployment summary")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+// stackFile is a configuration document along with the file it was read
+// from. Either Config or StackSet is set depending on the document's Kind.
+type stackFile struct {
+	Path     string
+	Config   *stackshot.StackConfig
+	StackSet *stackshot.StackSetConfig
+}
+
+// template returns the template settings of the file's configuration.
+func (f *stackFile) template() (url, path, body string) {
+	if f.StackSet != nil {
+		return f.StackSet.TemplateURL, f.StackSet.TemplatePath, string(f.StackSet.TemplateBody)
+	}
+	return f.Config.TemplateURL, f.Config.TemplatePath, string(f.Config.TemplateBody)
+}
+
+// stackConfigPaths expands args into stack configuration files. Directories
+// are searched recursively for .yaml and .yml files, which are returned in
+// lexical order.
+func stackConfigPaths(args []string) ([]string, error) {
+	paths := []string{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		found := []string{}
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := filepath.Ext(path)
+			if !info.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(found)
+		paths = append(paths, found...)
+	}
+	return paths, nil
+}
+
+// readStackFiles reads every configuration document within args. See
+// stackConfigPaths().
+func readStackFiles(args []string) ([]*stackFile, error) {
+	paths, err := stackConfigPaths(args)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*stackFile, 0, len(paths))
+	for _, path := range paths {
+		file, err := readStackFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// readStackFile reads the Stack or StackSet configuration at path.
+func readStackFile(path string) (*stackFile, error) {
+	doc, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read file: %s", path)
+	}
+
+	kind, err := stackshot.DocumentKind(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load yaml %s: errors: %s", path, err)
+	}
+
+	file := &stackFile{Path: path}
+	if kind == stackshot.KindStackSet {
+		file.StackSet, err = stackshot.NewStackSetFromYAML(doc)
+	} else {
+		file.Config, err = stackshot.NewStackFromYAML(doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not load yaml %s %s: errors: %s", strings.ToLower(kind), path, err)
+	}
+	return file, nil
+}
+
+// stackTarget returns the StackConfig of the stack arg names. arg is either a
+// stack configuration file or the name of a stack in the account and region
+// selected by profile and region. region also picks one of the regions of a
+// configuration deploying to several regions.
+//
+// Args that look like paths are never taken for stack names so a mistyped
+// path is reported rather than looked up as a stack.
+func stackTarget(arg, profile, region string) (*stackshot.StackConfig, error) {
+	if _, err := os.Stat(arg); err != nil {
+		if isPath(arg) {
+			return nil, err
+		}
+		return &stackshot.StackConfig{Name: arg, Profile: profile, Region: region}, nil
+	}
+
+	file, err := readStackFile(arg)
+	if err != nil {
+		return nil, err
+	}
+	if file.Config == nil {
+		return nil, fmt.Errorf("%s is a %s, not a stack", arg, stackshot.KindStackSet)
+	}
+
+	config := file.Config
+	if profile != "" {
+		config.Profile = profile
+	}
+	if len(config.Regions) == 0 {
+		if region != "" {
+			config.Region = region
+		}
+		return config, nil
+	}
+
+	for _, regional := range config.ExpandRegions() {
+		if regional.Region == region {
+			return regional, nil
+		}
+	}
+	if region == "" {
+		return nil, fmt.Errorf("%s deploys to several regions. Pick one with -region", arg)
+	}
+	return nil, fmt.Errorf("%s doesn't deploy to %s", arg, region)
+}
+
+// isPath reports whether arg looks like a path to a stack configuration file
+// rather than a stack name.
+func isPath(arg string) bool {
+	extension := strings.ToLower(filepath.Ext(arg))
+	return strings.ContainsAny(arg, `/\`) || extension == ".yaml" || extension == ".yml"
+}
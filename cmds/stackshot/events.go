@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func eventsCommand(args []string) int {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+	since := flags.String("since", "", "only print events newer than a duration ago, e.g. 2h, or an RFC3339 time")
+	statuses := stringsFlag{}
+	flags.Var(&statuses, "status", "only print events with a resource status ending in the given status, e.g. FAILED; can be repeated")
+	resources := stringsFlag{}
+	flags.Var(&resources, "resource", "only print events of the given logical resource ID; can be repeated")
+	limit := flags.Int("limit", 0, "only print the most recent matching events")
+	format := flags.String("format", "text", "output format: text or json")
+	region := flags.String("region", "", "region of the stack; required for configurations deploying to several regions")
+	profile := flags.String("profile", "", "AWS profile to use when reading the events of a stack by name")
+	flags.Usage = usage(flags.PrintDefaults, "events [flags] stack.yaml|stack-name")
+	args = parseArgs(flags, args)
+
+	if len(args) != 1 {
+		fmt.Println("Expected a single stack configuration or stack name")
+		flags.Usage()
+		return 1
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Printf("Unknown format %s\n", *format)
+		return 1
+	}
+
+	filter := stackshot.EventFilter{Statuses: statuses, Resources: resources, Limit: *limit}
+	if *since != "" {
+		var err error
+		if filter.Since, err = parseSince(*since); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	config, err := stackTarget(args[0], *profile, *region)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	svc, err := stackshot.NewClients().CloudFormation(config)
+	if err != nil {
+		fmt.Println("Failed to create AWS session:", err)
+		return 1
+	}
+
+	stack, err := stackshot.LoadStack(svc, config)
+	if err != nil {
+		fmt.Printf("Failed to load %s: %s\n", config.Name, err)
+		return 1
+	}
+
+	var consumer stackshot.EventConsumer = stackshot.EventConsumerFunc(stackshot.EventPrinter)
+	if *format == "json" {
+		consumer = stackshot.EventJSONPrinter(os.Stdout)
+	}
+
+	if err := stack.EventHistory(filter, consumer); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// parseSince parses -since as either a duration before now or a timestamp.
+func parseSince(since string) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-since %s is neither a duration nor an RFC3339 time", since)
+	}
+	return t, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func importCommand(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	resourcesPath := flags.String("resources", "", "path to a YAML file listing the ResourcesToImport")
+	planOnly := flags.Bool(
+		"plan-only",
+		false,
+		"create the import change set and show its plan without executing it",
+	)
+	flags.Usage = usage(flags.PrintDefaults, "import stack.yaml -resources import.yaml [flags]")
+	args = parseArgs(flags, args)
+
+	if len(args) != 1 || *resourcesPath == "" {
+		fmt.Println("Missing arguments!")
+		flags.Usage()
+		return 1
+	}
+
+	file, err := readStackFile(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if file.Config == nil {
+		fmt.Printf("%s: resources can only be imported into a Stack\n", file.Path)
+		return 1
+	}
+	config := file.Config
+	if len(config.Regions) > 0 {
+		fmt.Printf("%s: resources can only be imported into a single region. Set Region instead of Regions\n", file.Path)
+		return 1
+	}
+
+	doc, err := ioutil.ReadFile(*resourcesPath)
+	if err != nil {
+		fmt.Printf("Could not read file: %s\n", *resourcesPath)
+		return 1
+	}
+	resources, err := stackshot.NewImportFromYAML(doc)
+	if err != nil {
+		fmt.Printf("Could not load yaml resources %s: errors: %s\n", *resourcesPath, err)
+		return 1
+	}
+
+	clients := stackshot.NewClients()
+	svc, err := clients.CloudFormation(config)
+	if err != nil {
+		fmt.Println("Failed to create AWS session:", err)
+		return 1
+	}
+	uploader, err := clients.Uploader(config)
+	if err != nil {
+		fmt.Println("Failed to create AWS session:", err)
+		return 1
+	}
+
+	stack, err := stackshot.LoadStack(svc, config, stackshot.WithUploader(uploader))
+	if err != nil {
+		fmt.Println("Broken!", err)
+		return 1
+	}
+
+	changeSet, err := stack.PlanImport(resources)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	fmt.Printf("Import plan for %s:\n", config.Name)
+	for _, change := range changeSet.Changes {
+		fmt.Printf(
+			"  %s %s(%s) %s\n",
+			aws.StringValue(change.Action),
+			aws.StringValue(change.LogicalResourceId),
+			aws.StringValue(change.ResourceType),
+			aws.StringValue(change.PhysicalResourceId),
+		)
+	}
+
+	if *planOnly {
+		fmt.Println("Skipping execution. The change set can be reviewed and executed in Cloudformation.")
+		return 0
+	}
+
+	err = changeSet.ExecuteAndPollEvents(stackshot.EventConsumerFunc(stackshot.EventPrinter))
+	if err != nil {
+		fmt.Println("Failed to import resources:", err)
+		return 1
+	}
+	return 0
+}
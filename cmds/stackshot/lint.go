@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/tightlycoupled/stackshot/lint"
+)
+
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := flags.String("format", "text", "output format: text or json")
+	flags.Usage = usage(flags.PrintDefaults, "lint [flags] stack.yaml|dir [more.yaml|dir ...]")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 || (*format != "text" && *format != "json") {
+		flags.Usage()
+		return 1
+	}
+
+	paths, err := stackConfigPaths(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	problems := []lint.Problem{}
+	failed := false
+	for _, path := range paths {
+		file, err := readStackFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+
+		templateURL, templatePath, templateBody := file.template()
+		switch {
+		case templateURL != "":
+			fmt.Fprintf(os.Stderr, "%s: skipping template referenced by TemplateURL\n", path)
+		case templatePath != "":
+			body, err := ioutil.ReadFile(templatePath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+				continue
+			}
+			for _, problem := range lint.Lint(body) {
+				problem.File = templatePath
+				problems = append(problems, problem)
+			}
+		default:
+			// Line numbers are relative to the embedded template rather
+			// than the stack configuration, so only the path is kept.
+			for _, problem := range lint.Lint([]byte(templateBody)) {
+				problem.File = path
+				problem.Line = 0
+				problems = append(problems, problem)
+			}
+		}
+	}
+
+	if *format == "json" {
+		out, _ := json.MarshalIndent(problems, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, problem := range problems {
+			if problem.Path != "" {
+				fmt.Printf("%s (%s)\n", problem, problem.Path)
+			} else {
+				fmt.Println(problem)
+			}
+		}
+	}
+
+	if failed || lint.HasErrors(problems) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/pkg/errors"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+// lockFlags are the flags choosing where deployment locks are kept.
+type lockFlags struct {
+	table *string
+	dir   *string
+}
+
+func addLockFlags(flags *flag.FlagSet) *lockFlags {
+	return &lockFlags{
+		table: flags.String(
+			"lock-table",
+			os.Getenv("STACKSHOT_LOCK_TABLE"),
+			"DynamoDB table to keep deployment locks in. Its partition key must be a string named LockID. Defaults to $STACKSHOT_LOCK_TABLE",
+		),
+		dir: flags.String(
+			"lock-dir",
+			"",
+			"directory to keep deployment lock files in. Only locks out runs on the same machine",
+		),
+	}
+}
+
+// locker returns the Locker chosen by the flags, or nil when stacks aren't
+// locked.
+func (l *lockFlags) locker(clients *stackshot.Clients) (stackshot.Locker, error) {
+	switch {
+	case *l.table != "" && *l.dir != "":
+		return nil, errors.New("-lock-table and -lock-dir cannot both be set")
+	case *l.table != "":
+		sess, err := clients.Session(&stackshot.StackConfig{})
+		if err != nil {
+			return nil, err
+		}
+		return stackshot.NewDynamoDBLocker(dynamodb.New(sess), *l.table), nil
+	case *l.dir != "":
+		return &stackshot.FileLocker{Dir: *l.dir}, nil
+	}
+	return nil, nil
+}
+
+// lockInfo describes this run to runs blocked by its locks.
+func lockInfo() stackshot.LockInfo {
+	holder := os.Getenv("USER")
+	if hostname, err := os.Hostname(); err == nil {
+		holder += "@" + hostname
+	}
+
+	sha := os.Getenv("GITHUB_SHA")
+	if sha == "" {
+		if out, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+			sha = strings.TrimSpace(string(out))
+		}
+	}
+	return stackshot.LockInfo{Holder: holder, GitSHA: sha}
+}
+
+func unlockCommand(args []string) int {
+	flags := flag.NewFlagSet("unlock", flag.ExitOnError)
+	locks := addLockFlags(flags)
+	flags.Usage = usage(
+		flags.PrintDefaults,
+		"unlock -lock-table table|-lock-dir dir stack.yaml|dir [more.yaml|dir ...]",
+	)
+	args = parseArgs(flags, args)
+
+	if len(args) == 0 {
+		fmt.Println("Missing arguments!")
+		flags.Usage()
+		return 1
+	}
+
+	clients := stackshot.NewClients()
+	locker, err := locks.locker(clients)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if locker == nil {
+		fmt.Println("Missing -lock-table or -lock-dir")
+		flags.Usage()
+		return 1
+	}
+
+	files, err := readStackFiles(args)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	failed := 0
+	for _, file := range files {
+		if file.Config == nil {
+			continue
+		}
+		for _, config := range file.Config.ExpandRegions() {
+			name := stackshot.LockName(config)
+			if err := locker.Unlock(name); err != nil {
+				fmt.Println(err)
+				failed++
+				continue
+			}
+			fmt.Println("Unlocked", name)
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -1,65 +1,79 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/cloudformation"
-	"github.com/pkg/errors"
-
-	"github.com/tightlycoupled/stackshot"
+	"strings"
 )
 
+// commands maps subcommand names to the functions that run them. Each
+// function receives the arguments following the subcommand's name and returns
+// the process' exit code.
+var commands = map[string]func([]string) int{
+	"events":    eventsCommand,
+	"import":    importCommand,
+	"lint":      lintCommand,
+	"prune":     pruneCommand,
+	"reconcile": reconcileCommand,
+	"status":    statusCommand,
+	"sync":      syncCommand,
+	"unlock":    unlockCommand,
+	"validate":  validateCommand,
+	"watch":     watchCommand,
+}
+
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Missing arguments!")
-		fmt.Println("Usage:")
-		fmt.Printf("  %s stack.yaml", os.Args[0])
-		return
-	}
+	args := os.Args[1:]
 
-	doc, err := ioutil.ReadFile(os.Args[1])
-	if err != nil {
-		fmt.Printf("Could not read file: %s\n", os.Args[1])
-		return
+	// Syncing is the default command so that `stackshot stack.yaml` keeps
+	// working.
+	command := syncCommand
+	if len(args) > 0 {
+		if c, ok := commands[args[0]]; ok {
+			command = c
+			args = args[1:]
+		}
 	}
 
-	config, err := stackshot.NewStackFromYAML(doc)
-	if err != nil {
-		fmt.Printf("Could not load yaml stack: errors: %s\n", err)
-		os.Exit(1)
+	os.Exit(command(args))
+}
+
+// usage returns a flag.FlagSet Usage function that prints the command's usage
+// line followed by its flags.
+func usage(printDefaults func(), lines ...string) func() {
+	return func() {
+		fmt.Println("Usage:")
+		for _, line := range lines {
+			fmt.Printf("  %s %s\n", os.Args[0], line)
+		}
+		fmt.Println("Flags:")
+		printDefaults()
 	}
+}
 
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-	svc := cloudformation.New(sess)
+// parseArgs parses flags that appear before or after the command's
+// positional arguments, e.g. `stackshot import stack.yaml -resources
+// import.yaml`, and returns the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	flags.Parse(args)
 
-	stack, err := stackshot.LoadStack(svc, config)
-	if err != nil {
-		fmt.Println("Broken!", err)
-		return
+	positional := []string{}
+	for flags.NArg() > 0 {
+		positional = append(positional, flags.Arg(0))
+		flags.Parse(flags.Args()[1:])
 	}
+	return positional
+}
 
-	err = stack.SyncAndPollEvents(stackshot.EventConsumerFunc(stackshot.EventPrinter))
-	if err != nil {
-		switch err := errors.Cause(err).(type) {
-		case awserr.Error:
-			if stackshot.NoStackUpdatesToPerform(err) {
-				fmt.Println("No updates to be applied")
-			} else {
-				fmt.Println("AWS error")
-				fmt.Println(err.Code(), err.Message(), "", err.OrigErr())
-				fmt.Printf("Full error:\n%+v\n", err)
+// stringsFlag is a flag.Value collecting every occurrence of a repeated flag.
+type stringsFlag []string
 
-				return
-			}
-		default:
-			fmt.Println("Failed to sync configuration:", err)
-			return
-		}
-	}
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
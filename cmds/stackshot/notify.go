@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+// notifyFlags are the flags adding webhooks notified of every stack's syncs,
+// on top of the Notifications in stack configurations.
+type notifyFlags struct {
+	webhooks stringsFlag
+	slack    stringsFlag
+	teams    stringsFlag
+}
+
+func addNotifyFlags(flags *flag.FlagSet) *notifyFlags {
+	f := &notifyFlags{}
+	flags.Var(&f.webhooks, "notify-webhook", "post every stack's sync notifications as JSON to this URL; can be repeated")
+	flags.Var(&f.slack, "notify-slack", "post every stack's sync notifications to this Slack incoming webhook URL; can be repeated")
+	flags.Var(&f.teams, "notify-teams", "post every stack's sync notifications to this Microsoft Teams incoming webhook URL; can be repeated")
+	return f
+}
+
+// options returns the StackOptions sending notifications to the webhooks.
+func (f *notifyFlags) options() ([]stackshot.StackOption, error) {
+	options := []stackshot.StackOption{}
+	for _, webhooks := range []struct {
+		format string
+		urls   []string
+	}{
+		{stackshot.NotificationFormatJSON, f.webhooks},
+		{stackshot.NotificationFormatSlack, f.slack},
+		{stackshot.NotificationFormatTeams, f.teams},
+	} {
+		for _, url := range webhooks.urls {
+			notifier, err := stackshot.NewWebhookNotifier(&stackshot.NotificationConfig{URL: url, Format: webhooks.format})
+			if err != nil {
+				return nil, err
+			}
+			options = append(options, stackshot.WithNotifier(notifier))
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+// outputsFlags are the flags choosing where synced stacks' outputs are
+// written.
+type outputsFlags struct {
+	json   *string
+	env    *string
+	github *bool
+}
+
+func addOutputsFlags(flags *flag.FlagSet) *outputsFlags {
+	return &outputsFlags{
+		json: flags.String(
+			"outputs-json",
+			"",
+			"write the synced stacks' outputs to this file as JSON, keyed by stack name",
+		),
+		env: flags.String(
+			"outputs-env",
+			"",
+			"write the synced stacks' output values to this file as a dotenv file",
+		),
+		github: flags.Bool(
+			"outputs-github",
+			false,
+			"write the synced stacks' output values to GitHub Actions' $GITHUB_OUTPUT file",
+		),
+	}
+}
+
+func (o *outputsFlags) enabled() bool {
+	return *o.json != "" || *o.env != "" || *o.github
+}
+
+// outputsCollector collects the outputs of stacks as they finish syncing.
+// Stacks deployed to several regions sync concurrently.
+type outputsCollector struct {
+	mu       sync.Mutex
+	outputs  map[string]stackshot.Outputs
+	prefixed bool
+}
+
+// newOutputsCollector allocates an outputsCollector for a run syncing stacks
+// stacks. Output keys are prefixed with stack names when more than one stack
+// is synced, whether or not the others succeed, so a failed stack doesn't
+// change the keys its neighbours' outputs are written under.
+func newOutputsCollector(stacks int) *outputsCollector {
+	return &outputsCollector{outputs: map[string]stackshot.Outputs{}, prefixed: stacks > 1}
+}
+
+// add records a stack's outputs. name identifies the stack in the written
+// files.
+func (c *outputsCollector) add(name string, outputs stackshot.Outputs) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outputs[name] = outputs
+}
+
+// write writes the collected outputs to the files chosen by flags.
+func (c *outputsCollector) write(flags *outputsFlags) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if *flags.json != "" {
+		contents, err := json.MarshalIndent(c.outputs, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*flags.json, append(contents, '\n'), 0644); err != nil {
+			return errors.Wrap(err, "failed to write outputs")
+		}
+	}
+
+	if *flags.env != "" {
+		file, err := os.Create(*flags.env)
+		if err != nil {
+			return errors.Wrap(err, "failed to write outputs")
+		}
+		err = c.each(file, stackshot.Outputs.WriteDotenv)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to write outputs")
+		}
+	}
+
+	if *flags.github {
+		path := os.Getenv("GITHUB_OUTPUT")
+		if path == "" {
+			return errors.New("failed to write outputs: $GITHUB_OUTPUT is not set")
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return errors.Wrap(err, "failed to write outputs")
+		}
+		err = c.each(file, stackshot.Outputs.WriteGitHubOutputs)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to write outputs")
+		}
+	}
+	return nil
+}
+
+var unsafeKeyCharacters = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// each writes every stack's outputs with writeTo. Output keys are prefixed
+// with the stack's name when more than one stack is synced so keys from
+// different stacks can't collide.
+func (c *outputsCollector) each(w io.Writer, writeTo func(stackshot.Outputs, io.Writer, string) error) error {
+	names := make([]string, 0, len(c.outputs))
+	for name := range c.outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prefix := ""
+		if c.prefixed {
+			prefix = unsafeKeyCharacters.ReplaceAllString(name, "_") + "_"
+		}
+		if err := writeTo(c.outputs[name], w, prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func pruneCommand(args []string) int {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory of stack configurations managed by owner")
+	owner := flags.String(
+		"owner",
+		os.Getenv("STACKSHOT_OWNER"),
+		"the owner stacks were tagged with by `stackshot sync -owner`. Defaults to $STACKSHOT_OWNER",
+	)
+	regions := stringsFlag{}
+	flags.Var(
+		&regions,
+		"region",
+		"additional region to search with the default credentials. Can be repeated",
+	)
+	deleteStacks := flags.Bool("delete", false, "delete the orphaned stacks instead of only listing them")
+	yes := flags.Bool("yes", false, "delete without asking for confirmation")
+	flags.Usage = usage(flags.PrintDefaults, "prune -dir stacks/ -owner repo-id [flags]")
+	args = parseArgs(flags, args)
+
+	if len(args) > 0 || *dir == "" || *owner == "" {
+		fmt.Println("Missing arguments!")
+		flags.Usage()
+		return 1
+	}
+
+	// Every configuration must load. A stack whose configuration fails to
+	// load would otherwise look orphaned and be deleted.
+	files, err := readStackFiles([]string{*dir})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	configs := []*stackshot.StackConfig{}
+	for _, file := range files {
+		if file.Config != nil {
+			configs = append(configs, file.Config.ExpandRegions()...)
+		}
+	}
+	for _, region := range regions {
+		configs = append(configs, &stackshot.StackConfig{Region: region})
+	}
+	if len(configs) == 0 {
+		// Search the default account and region when the directory is
+		// empty.
+		configs = append(configs, &stackshot.StackConfig{})
+	}
+
+	clients := stackshot.NewClients()
+	orphans, err := stackshot.FindOrphanedStacks(clients, *owner, configs)
+	if err != nil {
+		fmt.Println("Failed to find orphaned stacks:", err)
+		return 1
+	}
+
+	if len(orphans) == 0 {
+		fmt.Println("No orphaned stacks found")
+		return 0
+	}
+
+	fmt.Printf("Stacks owned by %s that are no longer in %s:\n", *owner, *dir)
+	for _, orphan := range orphans {
+		fmt.Printf("  %s %s/%s %s\n", orphan.Name, orphan.Account, orphan.Region, orphan.Status)
+	}
+
+	if !*deleteStacks {
+		fmt.Println("Run with -delete to delete these stacks")
+		return 0
+	}
+
+	if !*yes && !confirm(fmt.Sprintf("Delete %d stacks?", len(orphans))) {
+		fmt.Println("Aborted")
+		return 1
+	}
+
+	failed := 0
+	for _, orphan := range orphans {
+		fmt.Printf("==> Deleting %s (%s/%s)\n", orphan.Name, orphan.Account, orphan.Region)
+		err := orphan.DeleteAndPollEvents(stackshot.EventConsumerFunc(stackshot.EventPrinter))
+		if err != nil {
+			fmt.Println("Failed to delete stack:", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d stacks failed to delete\n", failed, len(orphans))
+		return 1
+	}
+	return 0
+}
+
+// confirm asks a yes or no question on stdin and reports whether it was
+// answered with yes.
+func confirm(question string) bool {
+	fmt.Printf("%s Type 'yes' to continue: ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
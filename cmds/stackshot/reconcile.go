@@ -0,0 +1,168 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func reconcileCommand(args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	dir := flags.String("dir", "", "directory of stack configurations to keep in sync")
+	interval := flags.Duration("interval", 5*time.Minute, "time between reconciles")
+	listen := flags.String(
+		"listen",
+		"",
+		"address to serve the status of the last reconcile as JSON on, e.g. 127.0.0.1:8080. Prometheus metrics are served at /metrics",
+	)
+	metricsFile := flags.String(
+		"metrics-textfile",
+		"",
+		"write Prometheus metrics to this file for node_exporter's textfile collector after every reconcile",
+	)
+	templateBucket := flags.String(
+		"template-bucket",
+		"",
+		"S3 bucket to upload templates too large to send inline. TemplateBucket in the stack configuration takes precedence",
+	)
+	owner := flags.String(
+		"owner",
+		os.Getenv("STACKSHOT_OWNER"),
+		"tag stacks with stackshot:managed-by=<owner> so `stackshot prune` can find stacks removed from the repository. Defaults to $STACKSHOT_OWNER",
+	)
+	locks := addLockFlags(flags)
+	notify := addNotifyFlags(flags)
+	flags.Usage = usage(flags.PrintDefaults, "reconcile -dir stacks/ [flags]")
+	args = parseArgs(flags, args)
+
+	if len(args) > 0 || *dir == "" {
+		fmt.Println("Missing arguments!")
+		flags.Usage()
+		return 1
+	}
+	if *interval <= 0 {
+		fmt.Println("-interval must be positive")
+		return 1
+	}
+
+	metrics := stackshot.NewMetrics()
+	clients := stackshot.NewClients()
+	clients.Metrics = metrics
+
+	options := []stackshot.StackOption{stackshot.WithMetrics(metrics)}
+	if *owner != "" {
+		options = append(options, stackshot.WithOwner(*owner))
+	}
+
+	locker, err := locks.locker(clients)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if locker != nil {
+		options = append(options, stackshot.WithLocker(locker, lockInfo()))
+	}
+
+	notifiers, err := notify.options()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	options = append(options, notifiers...)
+
+	reconciler := &stackshot.Reconciler{
+		Load: func() ([]*stackshot.StackConfig, error) {
+			files, err := readStackFiles([]string{*dir})
+			if err != nil {
+				return nil, err
+			}
+
+			// Stack sets deploy through their own operations and aren't
+			// reconciled.
+			configs := []*stackshot.StackConfig{}
+			for _, file := range files {
+				if file.Config == nil {
+					continue
+				}
+				if file.Config.TemplateBucket == "" {
+					file.Config.TemplateBucket = *templateBucket
+				}
+				configs = append(configs, file.Config)
+			}
+			return configs, nil
+		},
+		Clients: clients,
+		Options: options,
+		Events: func(config *stackshot.StackConfig) stackshot.EventConsumer {
+			prefix := fmt.Sprintf("[%s] ", config.Name)
+			if config.Region != "" {
+				prefix = fmt.Sprintf("[%s %s] ", config.Name, config.Region)
+			}
+			return stackshot.PrefixedEventPrinter(prefix)
+		},
+		Reconciled: func(report *stackshot.ReconcileReport) {
+			printReconcileReport(report)
+			if *metricsFile != "" {
+				writeMetrics(metrics, *metricsFile)
+			}
+		},
+	}
+
+	if *listen != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/", reconciler)
+		mux.Handle("/metrics", metrics)
+		go func() {
+			err := http.ListenAndServe(*listen, mux)
+			fmt.Println("Failed to serve reconcile status:", err)
+			os.Exit(1)
+		}()
+	}
+
+	// Stop between reconciles so a stack is never left mid-update by
+	// stackshot.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stop := make(chan struct{})
+	go func() {
+		<-signals
+		fmt.Println("Stopping after the current reconcile")
+		close(stop)
+	}()
+
+	fmt.Printf("Reconciling %s every %s\n", *dir, *interval)
+	reconciler.Run(*interval, stop)
+	return 0
+}
+
+// printReconcileReport prints the stacks that changed or failed during a
+// reconcile.
+func printReconcileReport(report *stackshot.ReconcileReport) {
+	if report.Error != "" {
+		fmt.Println("Reconcile failed:", report.Error)
+		return
+	}
+
+	unchanged := 0
+	for _, status := range report.Stacks {
+		name := status.Name
+		if status.Region != "" {
+			name += " (" + status.Region + ")"
+		}
+		switch status.Result {
+		case stackshot.ReconcileApplied:
+			fmt.Printf("%s: applied %s\n", name, status.Plan.Action)
+		case stackshot.ReconcileFailed:
+			fmt.Printf("%s: failed: %s\n", name, status.Error)
+		default:
+			unchanged++
+		}
+	}
+	fmt.Printf("Reconciled %d stacks, %d unchanged\n", len(report.Stacks), unchanged)
+}
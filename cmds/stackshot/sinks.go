@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+// eventsFlags are the flags choosing which of the synced stacks' events are
+// printed and where else they're sent.
+type eventsFlags struct {
+	json     *string
+	statuses stringsFlag
+}
+
+func addEventsFlags(flags *flag.FlagSet) *eventsFlags {
+	f := &eventsFlags{
+		json: flags.String(
+			"events-json",
+			"",
+			"also append every event to this file as a line of JSON",
+		),
+	}
+	flags.Var(
+		&f.statuses,
+		"events-status",
+		"only print events with a resource status ending in the given status, e.g. FAILED; can be repeated. Other sinks still get every event",
+	)
+	return f
+}
+
+// eventSinks passes the events of synced stacks to the terminal and to the
+// sinks chosen with eventsFlags. Sinks are shared by stacks syncing
+// concurrently.
+type eventSinks struct {
+	printed stackshot.EventFilter
+	file    *os.File
+	json    *stackshot.AsyncConsumer
+}
+
+func (f *eventsFlags) open() (*eventSinks, error) {
+	sinks := &eventSinks{printed: stackshot.EventFilter{Statuses: f.statuses}}
+	if *f.json != "" {
+		file, err := os.OpenFile(*f.json, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open -events-json file")
+		}
+		sinks.file = file
+		sinks.json = stackshot.NewAsyncConsumer(stackshot.EventJSONPrinter(file))
+	}
+	return sinks, nil
+}
+
+// consumer returns the EventConsumer of a stack whose printed events start
+// with prefix.
+func (s *eventSinks) consumer(prefix string) stackshot.EventConsumer {
+	consumers := []stackshot.EventConsumer{
+		stackshot.FilterConsumer(s.printed.Match, stackshot.PrefixedEventPrinter(prefix)),
+	}
+	if s.json != nil {
+		consumers = append(consumers, s.json)
+	}
+	return stackshot.MultiConsumer(consumers...)
+}
+
+// close flushes the sinks once every stack finished syncing.
+func (s *eventSinks) close() error {
+	if s.json == nil {
+		return nil
+	}
+	err := s.json.Close()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrap(err, "failed to write -events-json file")
+}
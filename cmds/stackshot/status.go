@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func statusCommand(args []string) int {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	format := flags.String("format", "table", "output format: table or json")
+	flags.Usage = usage(flags.PrintDefaults, "status [flags] stack.yaml|dir [more.yaml|dir ...]")
+	args = parseArgs(flags, args)
+
+	if len(args) == 0 {
+		fmt.Println("Missing arguments!")
+		flags.Usage()
+		return 1
+	}
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown format %s\n", *format)
+		return 1
+	}
+
+	files, err := readStackFiles(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	clients := stackshot.NewClients()
+	statuses := []*stackshot.StackStatus{}
+	failed := 0
+	for _, file := range files {
+		if file.Config == nil {
+			continue
+		}
+
+		for _, config := range file.Config.ExpandRegions() {
+			svc, err := clients.CloudFormation(config)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to create AWS session:", err)
+				failed++
+				continue
+			}
+
+			stack, err := stackshot.LoadStack(svc, config)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to load %s: %s\n", config.Name, err)
+				failed++
+				continue
+			}
+			statuses = append(statuses, stack.Status())
+		}
+	}
+
+	if *format == "json" {
+		out, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(out))
+	} else {
+		for i, status := range statuses {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Print(status)
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
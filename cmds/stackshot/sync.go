@@ -0,0 +1,373 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func syncCommand(args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	policyDuringUpdate := flags.String(
+		"stack-policy-during-update",
+		"",
+		"path to a stack policy that temporarily overrides the stack's policy for this update only",
+	)
+	templateBucket := flags.String(
+		"template-bucket",
+		"",
+		"S3 bucket to upload templates too large to send inline. TemplateBucket in the stack configuration takes precedence",
+	)
+	owner := flags.String(
+		"owner",
+		os.Getenv("STACKSHOT_OWNER"),
+		"tag stacks with stackshot:managed-by=<owner> so `stackshot prune` can find stacks removed from the repository. Defaults to $STACKSHOT_OWNER",
+	)
+	metricsFile := flags.String(
+		"metrics-textfile",
+		"",
+		"write Prometheus metrics to this file for node_exporter's textfile collector after syncing",
+	)
+	locks := addLockFlags(flags)
+	notify := addNotifyFlags(flags)
+	outputs := addOutputsFlags(flags)
+	events := addEventsFlags(flags)
+	junit := flags.String(
+		"junit",
+		"",
+		"write a JUnit XML report with a test case for every synced stack to this file",
+	)
+	ciName := flags.String(
+		"ci",
+		"",
+		"make output aware of a CI system. github groups output by stack, annotates failures, writes a deployment summary to $GITHUB_STEP_SUMMARY, and sets stack outputs as step outputs",
+	)
+	flags.Usage = usage(
+		flags.PrintDefaults,
+		"[flags] stack.yaml|dir [more.yaml|dir ...]",
+		"sync [flags] stack.yaml|dir [more.yaml|dir ...]",
+	)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("Missing arguments!")
+		flags.Usage()
+		return 1
+	}
+
+	ci, err := newCI(*ciName)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	// -ci github only sets step outputs when there's somewhere to write
+	// them, unlike an explicit -outputs-github.
+	if ci != nil && os.Getenv("GITHUB_OUTPUT") != "" {
+		*outputs.github = true
+	}
+
+	// The run is timed for the JUnit report since stacks deployed to several
+	// regions sync concurrently.
+	runStarted := time.Now()
+
+	files, err := readStackFiles(flags.Args())
+	if err != nil {
+		fmt.Println(err)
+		ci.annotate("", "Invalid stack configuration", err)
+		return 1
+	}
+
+	options := []stackshot.StackOption{}
+	if *policyDuringUpdate != "" {
+		policy, err := ioutil.ReadFile(*policyDuringUpdate)
+		if err != nil {
+			fmt.Printf("Could not read file: %s\n", *policyDuringUpdate)
+			return 1
+		}
+		options = append(options, stackshot.WithStackPolicyDuringUpdate(string(policy)))
+	}
+
+	if *owner != "" {
+		options = append(options, stackshot.WithOwner(*owner))
+	}
+
+	clients := stackshot.NewClients()
+	if *metricsFile != "" {
+		clients.Metrics = stackshot.NewMetrics()
+		options = append(options, stackshot.WithMetrics(clients.Metrics))
+		defer writeMetrics(clients.Metrics, *metricsFile)
+	}
+
+	locker, err := locks.locker(clients)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if locker != nil {
+		options = append(options, stackshot.WithLocker(locker, lockInfo()))
+	}
+
+	notifiers, err := notify.options()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	options = append(options, notifiers...)
+
+	sinks, err := events.open()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	stacks := 0
+	for _, file := range files {
+		if file.Config != nil {
+			stacks += len(file.Config.ExpandRegions())
+		}
+	}
+	collected := newOutputsCollector(stacks)
+	summaries := &syncSummaries{}
+	failed := 0
+	for _, file := range files {
+		// Each file syncs in a closure so its output group ends however it
+		// returns.
+		func() {
+			var name string
+			if file.StackSet != nil {
+				name = file.StackSet.Name
+			} else {
+				name = file.Config.Name
+			}
+			title := fmt.Sprintf("%s (%s)", name, file.Path)
+			if ci != nil {
+				ci.group(title)
+				defer ci.endGroup()
+			} else if len(files) > 1 {
+				fmt.Printf("==> %s\n", title)
+			}
+
+			if file.StackSet != nil {
+				started := time.Now()
+				summary := &stackshot.StackSummary{Name: name, File: file.Path, Result: stackshot.SyncSucceeded}
+				if err := syncStackSet(clients, file.StackSet); err != nil {
+					summary.Result, summary.Error = stackshot.SyncFailed, err.Error()
+					failed++
+				}
+				summary.Duration = time.Since(started)
+				summaries.add(summary)
+				return
+			}
+
+			if file.Config.TemplateBucket == "" {
+				file.Config.TemplateBucket = *templateBucket
+			}
+
+			if len(file.Config.Regions) == 0 {
+				summary, err := syncStack(clients, file.Config, options, sinks, "")
+				summary.File = file.Path
+				summaries.add(summary)
+				if err != nil {
+					failed++
+					return
+				}
+				collected.add(file.Config.Name, summary.Outputs)
+				return
+			}
+
+			report := stackshot.RollOut(file.Config, func(config *stackshot.StackConfig) error {
+				summary, err := syncStack(clients, config, options, sinks, fmt.Sprintf("[%s] ", config.Region))
+				summary.File = file.Path
+				summaries.add(summary)
+				if err == nil {
+					collected.add(config.Name+"@"+config.Region, summary.Outputs)
+				}
+				return err
+			})
+			fmt.Print(report)
+			if report.Failed() > 0 {
+				failed++
+			}
+		}()
+	}
+
+	if err := ci.finish(summaries.all()); err != nil {
+		fmt.Println(err)
+	}
+
+	// Reports are written even when stacks failed, but failing to write
+	// them fails the run.
+	reportErr := sinks.close()
+	if reportErr != nil {
+		fmt.Println(reportErr)
+	}
+	if *junit != "" {
+		if err := writeJUnit(*junit, summaries.all(), time.Since(runStarted)); err != nil {
+			fmt.Println(err)
+			reportErr = err
+		}
+	}
+
+	if outputs.enabled() {
+		if err := collected.write(outputs); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	if failed > 0 {
+		if len(files) > 1 {
+			fmt.Printf("%d of %d stacks failed to sync\n", failed, len(files))
+		}
+		return 1
+	}
+	if reportErr != nil {
+		return 1
+	}
+	return 0
+}
+
+// syncSummaries collects the summaries of stacks as they finish syncing.
+// Stacks deployed to several regions sync concurrently.
+type syncSummaries struct {
+	mu        sync.Mutex
+	summaries []*stackshot.StackSummary
+}
+
+func (s *syncSummaries) add(summary *stackshot.StackSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summaries = append(s.summaries, summary)
+}
+
+func (s *syncSummaries) all() []*stackshot.StackSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summaries
+}
+
+// writeJUnit writes a JUnit XML report of summaries from a run that took
+// elapsed to path.
+func writeJUnit(path string, summaries []*stackshot.StackSummary, elapsed time.Duration) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to write JUnit report")
+	}
+	err = stackshot.WriteJUnit(file, summaries, elapsed)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return errors.Wrap(err, "failed to write JUnit report")
+}
+
+// writeMetrics writes metrics to path, printing any error.
+func writeMetrics(metrics *stackshot.Metrics, path string) {
+	if err := metrics.WriteTextfile(path); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// syncStack syncs a single stack and passes its events to sinks, printing
+// them with every line starting with prefix. Errors are printed before being
+// returned. A stack without updates to perform isn't an error. A summary of
+// the sync, including the stack's outputs, is returned even when it fails.
+func syncStack(clients *stackshot.Clients, config *stackshot.StackConfig, options []stackshot.StackOption, sinks *eventSinks, prefix string) (*stackshot.StackSummary, error) {
+	logln := func(a ...interface{}) {
+		fmt.Print(prefix)
+		fmt.Println(a...)
+	}
+
+	summary := &stackshot.StackSummary{Name: config.Name, Region: config.Region, Result: stackshot.SyncFailed}
+	started := time.Now()
+	fail := func(err error) (*stackshot.StackSummary, error) {
+		summary.Error = err.Error()
+		summary.Duration = time.Since(started)
+		return summary, err
+	}
+
+	svc, err := clients.CloudFormation(config)
+	if err != nil {
+		logln("Failed to create AWS session:", err)
+		return fail(err)
+	}
+	uploader, err := clients.Uploader(config)
+	if err != nil {
+		logln("Failed to create AWS session:", err)
+		return fail(err)
+	}
+
+	options = append(
+		[]stackshot.StackOption{stackshot.WithUploader(uploader), stackshot.WithHookOutput(os.Stdout, prefix)},
+		options...,
+	)
+	stack, err := stackshot.LoadStack(svc, config, options...)
+	if err != nil {
+		logln("Broken!", err)
+		return fail(err)
+	}
+
+	events := &stackshot.BufferedConsumer{}
+	err = stack.SyncAndPollEvents(stackshot.MultiConsumer(sinks.consumer(prefix), events))
+	summary.Resources = stackshot.ResourceResults(events.Events())
+	summary.FailureReasons = stackshot.FailureReasons(events.Events())
+	if cause, ok := errors.Cause(err).(awserr.Error); ok && stackshot.NoStackUpdatesToPerform(cause) {
+		logln("No updates to be applied")
+		summary.Result, summary.Outputs = stackshot.SyncUnchanged, stack.Outputs()
+		summary.Duration = time.Since(started)
+		return summary, nil
+	}
+	if token := stack.ClientRequestToken(); token != "" {
+		logln("Client request token:", token)
+	}
+	if err != nil {
+		switch cause := errors.Cause(err).(type) {
+		case awserr.Error:
+			logln("AWS error")
+			logln(cause.Code(), cause.Message(), "", cause.OrigErr())
+			logln(fmt.Sprintf("Full error:\n%+v", cause))
+		case stackshot.ValidationErrors:
+			logln(cause)
+		case *stackshot.LockedError:
+			logln(cause)
+			logln("Run `stackshot unlock` if the lock's holder is no longer running")
+		default:
+			logln("Failed to sync configuration:", err)
+		}
+		return fail(err)
+	}
+
+	summary.Result, summary.Outputs = stackshot.SyncSucceeded, stack.Outputs()
+	summary.Duration = time.Since(started)
+	return summary, nil
+}
+
+// syncStackSet syncs a stack set and its stack instances and prints the
+// status of each instance. Errors are printed before being returned.
+func syncStackSet(clients *stackshot.Clients, config *stackshot.StackSetConfig) error {
+	svc, err := clients.StackSetCloudFormation(config)
+	if err != nil {
+		fmt.Println("Failed to create AWS session:", err)
+		return err
+	}
+
+	stackSet, err := stackshot.LoadStackSet(svc, config)
+	if err != nil {
+		fmt.Println("Broken!", err)
+		return err
+	}
+
+	err = stackSet.SyncAndPollEvents(stackshot.StackSetEventConsumerFunc(stackshot.StackSetEventPrinter))
+	if err != nil {
+		fmt.Println("Failed to sync stack set:", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func validateCommand(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	offline := flags.Bool(
+		"offline",
+		false,
+		"validate local templates without calling AWS. Required capabilities are inferred from the template's resources",
+	)
+	templateBucket := flags.String(
+		"template-bucket",
+		"",
+		"S3 bucket to upload templates too large to send inline. TemplateBucket in the stack configuration takes precedence",
+	)
+	ciName := flags.String("ci", "", "make output aware of a CI system. github annotates invalid configuration files")
+	flags.Usage = usage(flags.PrintDefaults, "validate [flags] stack.yaml|dir [more.yaml|dir ...]")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Println("Missing arguments!")
+		flags.Usage()
+		return 1
+	}
+
+	ci, err := newCI(*ciName)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	var validate func(*stackshot.StackConfig) error
+	if *offline {
+		validate = stackshot.ValidateOffline
+	} else {
+		clients := stackshot.NewClients()
+
+		validate = func(config *stackshot.StackConfig) error {
+			svc, err := clients.CloudFormation(config)
+			if err != nil {
+				return err
+			}
+			stack, err := stackshot.LoadStack(svc, config)
+			if err != nil {
+				return err
+			}
+			return stack.Validate()
+		}
+	}
+
+	paths, err := stackConfigPaths(flags.Args())
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	status := 0
+	for _, path := range paths {
+		file, err := readStackFile(path)
+		if err != nil {
+			fmt.Println(err)
+			ci.annotate(path, "Invalid stack configuration", err)
+			status = 1
+			continue
+		}
+		if file.StackSet != nil {
+			fmt.Printf("%s: skipping StackSet, only Stacks are validated\n", path)
+			continue
+		}
+		config := file.Config
+
+		if config.TemplateBucket == "" {
+			config.TemplateBucket = *templateBucket
+		}
+
+		for _, regional := range config.ExpandRegions() {
+			name := path
+			if len(config.Regions) > 0 {
+				name = fmt.Sprintf("%s (%s)", path, regional.Region)
+			}
+
+			if err := validate(regional); err != nil {
+				fmt.Printf("%s: %s\n", name, err)
+				ci.annotate(path, "Invalid stack configuration", err)
+				status = 1
+				continue
+			}
+			fmt.Printf("%s: OK\n", name)
+		}
+	}
+	return status
+}
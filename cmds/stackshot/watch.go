@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tightlycoupled/stackshot"
+)
+
+func watchCommand(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	follow := flags.Bool("follow", false, "keep printing events after the stack's operation finishes until interrupted")
+	region := flags.String("region", "", "region of the stack; required for configurations deploying to several regions")
+	profile := flags.String("profile", "", "AWS profile to use when watching a stack by name")
+	flags.Usage = usage(flags.PrintDefaults, "watch [flags] stack.yaml|stack-name")
+	args = parseArgs(flags, args)
+
+	if len(args) != 1 {
+		fmt.Println("Expected a single stack configuration or stack name")
+		flags.Usage()
+		return 1
+	}
+
+	config, err := stackTarget(args[0], *profile, *region)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	svc, err := stackshot.NewClients().CloudFormation(config)
+	if err != nil {
+		fmt.Println("Failed to create AWS session:", err)
+		return 1
+	}
+
+	stack, err := stackshot.LoadStack(svc, config)
+	if err != nil {
+		fmt.Printf("Failed to load %s: %s\n", config.Name, err)
+		return 1
+	}
+
+	consumer := stackshot.EventConsumerFunc(stackshot.EventPrinter)
+	if *follow {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		stop := make(chan struct{})
+		go func() {
+			<-signals
+			close(stop)
+		}()
+
+		err = stack.FollowEvents(consumer, stop)
+	} else if !stack.InProgress() {
+		fmt.Printf("No operation in progress on %s\n", config.Name)
+		return 0
+	} else {
+		err = stack.WatchEvents(consumer)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
@@ -1,6 +1,8 @@
 package stackshot
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -8,7 +10,39 @@ import (
 	"github.com/pkg/errors"
 )
 
+// Document kinds selected with a document's Kind setting. Documents without
+// a Kind describe a Stack.
+const (
+	KindStack    = "Stack"
+	KindStackSet = "StackSet"
+)
+
+// DocumentKind returns the kind of configuration a YAML document describes.
+func DocumentKind(doc []byte) (string, error) {
+	d := struct{ Kind string }{}
+	if err := yaml.Unmarshal(doc, &d); err != nil {
+		return "", errors.Wrap(err, "failed to parse YAML")
+	}
+
+	switch d.Kind {
+	case "", KindStack:
+		return KindStack, nil
+	case KindStackSet:
+		return KindStackSet, nil
+	default:
+		return "", fmt.Errorf("unknown kind %s", d.Kind)
+	}
+}
+
 func NewStackFromYAML(doc []byte) (*StackConfig, error) {
+	kind, err := DocumentKind(doc)
+	if err != nil {
+		return nil, err
+	}
+	if kind != KindStack {
+		return nil, fmt.Errorf("document is a %s, not a %s", kind, KindStack)
+	}
+
 	s := StackConfig{}
 
 	if err := yaml.Unmarshal([]byte(doc), &s); err != nil {
@@ -31,10 +65,39 @@ type StackConfig struct {
 	TemplateURL  string
 	TemplatePath string
 	TemplateBody templateBody
-	Parameters   map[string]string
+	Parameters   map[string]ParameterValue
 	Tags         map[string]string
 	Capabilities []string
 
+	// UsePreviousTemplate updates the stack with its current template instead
+	// of TemplateURL, TemplatePath, or TemplateBody. It can't be used to
+	// create a stack.
+	UsePreviousTemplate bool
+
+	// TemplateBucket is an S3 bucket that local templates too large to send
+	// inline are uploaded to.
+	TemplateBucket string
+
+	// Region, Profile, and AssumeRoleARN select the AWS region and account
+	// the stack is deployed to. Empty settings fall back to the environment
+	// and shared AWS configuration files.
+	Region  string
+	Profile string
+
+	// AssumeRoleARN is a role assumed with the Profile's credentials to
+	// deploy the stack. AssumeRoleExternalID and AssumeRoleSessionName are
+	// passed along when assuming the role.
+	AssumeRoleARN         string
+	AssumeRoleExternalID  string
+	AssumeRoleSessionName string
+
+	// Regions deploys the stack to each listed region instead of Region.
+	// RegionOverrides replaces settings in individual regions and Rollout
+	// controls the order regions are deployed in. See ExpandRegions().
+	Regions         []string
+	RegionOverrides map[string]RegionOverride
+	Rollout         RolloutConfig
+
 	// Settings for CreateStack()
 	DisableRollback bool
 
@@ -43,6 +106,18 @@ type StackConfig struct {
 
 	// Settings for CreateStack()
 	OnFailure string
+
+	// StackPolicy is either an inline policy document or a path to a local
+	// policy file. It's applied with StackPolicyBody when creating a stack
+	// and SetStackPolicy when updating a stack.
+	StackPolicy stackPolicy
+
+	// Hooks are commands run before and after the stack is synced.
+	Hooks Hooks
+
+	// Notifications are webhooks notified when the stack starts updating,
+	// when a resource fails, and when the stack finishes.
+	Notifications []NotificationConfig
 }
 
 func (s *StackConfig) verifyRequiredFields() error {
@@ -51,7 +126,8 @@ func (s *StackConfig) verifyRequiredFields() error {
 		missingFields = append(missingFields, "name")
 	}
 
-	if s.TemplateURL == "" && s.TemplateBody == "" && s.TemplatePath == "" {
+	hasTemplate := s.TemplateURL != "" || s.TemplateBody != "" || s.TemplatePath != ""
+	if !hasTemplate && !s.UsePreviousTemplate {
 		missingFields = append(missingFields, "template_url/template_body/template_path")
 	}
 
@@ -66,13 +142,62 @@ func (s *StackConfig) verifyRequiredFields() error {
 		return fmt.Errorf("disable_rollback and on_failure cannot both be set")
 	}
 
+	if hasTemplate && s.UsePreviousTemplate {
+		return fmt.Errorf("use_previous_template and template_url/template_body/template_path cannot both be set")
+	}
+
+	if err := s.Hooks.verify(); err != nil {
+		return err
+	}
+
+	for i := range s.Notifications {
+		if err := s.Notifications[i].verify(); err != nil {
+			return err
+		}
+	}
+
+	return s.verifyRegions()
+}
+
+func (s *StackConfig) verifyRegions() error {
+	if s.Region != "" && len(s.Regions) > 0 {
+		return fmt.Errorf("region and regions cannot both be set")
+	}
+
+	listed := map[string]bool{}
+	for _, region := range s.Regions {
+		if listed[region] {
+			return fmt.Errorf("region %s is listed more than once in regions", region)
+		}
+		listed[region] = true
+	}
+
+	for region := range s.RegionOverrides {
+		if !listed[region] {
+			return fmt.Errorf("region_overrides has settings for %s which is not listed in regions", region)
+		}
+	}
+
+	if s.Rollout.WaveSize < 0 || s.Rollout.FailureTolerance < 0 {
+		return fmt.Errorf("rollout wave_size and failure_tolerance cannot be negative")
+	}
+
 	return nil
 }
 
 type templateBody string
 
-// Convert data back into YAML to match what a user will write a template in.
+// A string is used verbatim, which lets users embed JSON templates or YAML
+// templates containing short-form intrinsic functions (!Ref, !Sub, ...) as a
+// block string. Anything else is converted back into YAML to match what a
+// user will write a template in.
 func (t *templateBody) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err == nil {
+		*t = templateBody(raw)
+		return nil
+	}
+
 	body, err := yaml.JSONToYAML(data)
 	if err != nil {
 		return err
@@ -81,3 +206,245 @@ func (t *templateBody) UnmarshalJSON(data []byte) error {
 	*t = templateBody(string(body))
 	return nil
 }
+
+// ParameterValue is the value of a template parameter. A parameter is either
+// set to Value or, when updating a stack, keeps the stack's current value with
+// UsePreviousValue.
+//
+// In YAML, a parameter is written as a plain value or as a mapping:
+//
+//	Parameters:
+//	  VpcId: vpc-123abcde789
+//	  DbPassword:
+//	    UsePreviousValue: true
+type ParameterValue struct {
+	Value            string
+	UsePreviousValue bool
+}
+
+func (p *ParameterValue) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch value.(type) {
+	case map[string]interface{}:
+		// Alias the type to decode the mapping without recursing into
+		// UnmarshalJSON.
+		type parameterValue ParameterValue
+		v := parameterValue{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*p = ParameterValue(v)
+	case string:
+		p.Value = value.(string)
+	case nil:
+		p.Value = ""
+	default:
+		// Numbers and booleans keep the text they were written with.
+		p.Value = string(data)
+	}
+	return nil
+}
+
+// stackPolicy holds a stack policy set either inline (Body) or as a path to a
+// local file (Path). Only one of the two is ever set.
+type stackPolicy struct {
+	Body string
+	Path string
+}
+
+// A YAML mapping is converted to a JSON policy document since Cloudformation
+// only accepts JSON stack policies. A string holding a JSON document is kept
+// as is, one holding a YAML mapping (usually a block string) is converted to
+// JSON, and any other single line string is a path to a policy file.
+func (p *stackPolicy) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return p.setBody(data)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(text), "{") && json.Valid([]byte(text)) {
+		p.Body = text
+		return nil
+	}
+	converted, err := yaml.YAMLToJSON([]byte(text))
+	if err == nil && bytes.HasPrefix(converted, []byte("{")) {
+		return p.setBody(converted)
+	}
+	if strings.Contains(strings.TrimSpace(text), "\n") {
+		if err == nil {
+			err = errors.New("expected a mapping")
+		}
+		return errors.Wrap(err, "invalid inline stack policy")
+	}
+	p.Path = text
+	return nil
+}
+
+func (p *stackPolicy) setBody(document []byte) error {
+	var body bytes.Buffer
+	if err := json.Compact(&body, document); err != nil {
+		return err
+	}
+	p.Body = body.String()
+	return nil
+}
+
+func (p stackPolicy) isSet() bool {
+	return p.Body != "" || p.Path != ""
+}
+
+// NewStackSetFromYAML parses a YAML document with Kind: StackSet.
+func NewStackSetFromYAML(doc []byte) (*StackSetConfig, error) {
+	s := StackSetConfig{}
+
+	if err := yaml.Unmarshal(doc, &s); err != nil {
+		return nil, errors.Wrap(err, "failed to parse YAML")
+	}
+
+	if s.Kind != KindStackSet {
+		return nil, fmt.Errorf("document is not a %s", KindStackSet)
+	}
+
+	if err := s.verifyRequiredFields(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// StackSetConfig describes a Cloudformation StackSet and the accounts, or
+// organizational units, and regions its stack instances are deployed to.
+type StackSetConfig struct {
+	// Kind must be StackSet.
+	Kind string
+
+	Name         string
+	Description  string
+	TemplateURL  string
+	TemplatePath string
+	TemplateBody templateBody
+	Parameters   map[string]ParameterValue
+	Tags         map[string]string
+	Capabilities []string
+
+	// PermissionModel is either SELF_MANAGED, the default, or
+	// SERVICE_MANAGED.
+	PermissionModel string
+
+	// AdministrationRoleARN and ExecutionRoleName are the roles used by
+	// SELF_MANAGED stack sets. Cloudformation's default roles are used when
+	// they're empty.
+	AdministrationRoleARN string
+	ExecutionRoleName     string
+
+	// AutoDeployment deploys SERVICE_MANAGED stack sets to accounts added to
+	// the DeploymentTargets' organizational units.
+	AutoDeployment *StackSetAutoDeployment
+
+	// DeploymentTargets and Regions select the stack instances. An instance
+	// is deployed to every region for each target.
+	DeploymentTargets StackSetDeploymentTargets
+	Regions           []string
+
+	OperationPreferences StackSetOperationPreferences
+
+	// Region, Profile, and AssumeRoleARN select the administrator account
+	// and region the stack set is managed from. See StackConfig.
+	Region                string
+	Profile               string
+	AssumeRoleARN         string
+	AssumeRoleExternalID  string
+	AssumeRoleSessionName string
+}
+
+// StackSetAutoDeployment configures automatic deployments of SERVICE_MANAGED
+// stack sets.
+type StackSetAutoDeployment struct {
+	Enabled                      bool
+	RetainStacksOnAccountRemoval bool
+}
+
+// StackSetDeploymentTargets lists the accounts a SELF_MANAGED stack set, or
+// the organizational units a SERVICE_MANAGED stack set, is deployed to.
+type StackSetDeploymentTargets struct {
+	Accounts              []string
+	OrganizationalUnitIds []string
+}
+
+// StackSetOperationPreferences controls how stack set operations roll out
+// across accounts and regions. Zero values use Cloudformation's defaults.
+// Only one of each Count and Percentage pair can be set.
+type StackSetOperationPreferences struct {
+	RegionOrder                []string
+	FailureToleranceCount      int64
+	FailureTolerancePercentage int64
+	MaxConcurrentCount         int64
+	MaxConcurrentPercentage    int64
+}
+
+func (s *StackSetConfig) verifyRequiredFields() error {
+	missingFields := []string{}
+	if s.Name == "" {
+		missingFields = append(missingFields, "name")
+	}
+
+	templates := 0
+	for _, template := range []string{s.TemplateURL, string(s.TemplateBody), s.TemplatePath} {
+		if template != "" {
+			templates++
+		}
+	}
+	if templates == 0 {
+		missingFields = append(missingFields, "template_url/template_body/template_path")
+	}
+
+	if len(missingFields) != 0 {
+		return fmt.Errorf(
+			"Missing fields from document: %s",
+			strings.Join(missingFields, ", "),
+		)
+	}
+
+	if templates > 1 {
+		return fmt.Errorf("only one of template_url, template_body, or template_path can be set")
+	}
+
+	targets := s.DeploymentTargets
+	switch s.PermissionModel {
+	case "", "SELF_MANAGED":
+		if len(targets.OrganizationalUnitIds) > 0 {
+			return fmt.Errorf("deployment_targets organizational_unit_ids requires the SERVICE_MANAGED permission_model")
+		}
+		if s.AutoDeployment != nil {
+			return fmt.Errorf("auto_deployment requires the SERVICE_MANAGED permission_model")
+		}
+	case "SERVICE_MANAGED":
+		if len(targets.Accounts) > 0 {
+			return fmt.Errorf("deployment_targets accounts requires the SELF_MANAGED permission_model")
+		}
+		if s.AdministrationRoleARN != "" || s.ExecutionRoleName != "" {
+			return fmt.Errorf("administration_role_arn and execution_role_name require the SELF_MANAGED permission_model")
+		}
+	default:
+		return fmt.Errorf("permission_model must be SELF_MANAGED or SERVICE_MANAGED")
+	}
+
+	hasTargets := len(targets.Accounts) > 0 || len(targets.OrganizationalUnitIds) > 0
+	if hasTargets && len(s.Regions) == 0 {
+		return fmt.Errorf("regions must be set to deploy to deployment_targets")
+	}
+
+	preferences := s.OperationPreferences
+	if preferences.FailureToleranceCount != 0 && preferences.FailureTolerancePercentage != 0 {
+		return fmt.Errorf("failure_tolerance_count and failure_tolerance_percentage cannot both be set")
+	}
+	if preferences.MaxConcurrentCount != 0 && preferences.MaxConcurrentPercentage != 0 {
+		return fmt.Errorf("max_concurrent_count and max_concurrent_percentage cannot both be set")
+	}
+
+	return nil
+}
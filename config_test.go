@@ -110,11 +110,11 @@ Tags:
 				TemplateURL:                 "https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml",
 				DisableRollback:             true,
 				EnableTerminationProtection: true,
-				Parameters: map[string]string{
-					"hello":         "world",
-					"VpcId":         "vpc-123abcde789",
-					"SubnetGroupId": "subnet-group-id",
-					"MultiAz":       "true",
+				Parameters: map[string]ParameterValue{
+					"hello":         {Value: "world"},
+					"VpcId":         {Value: "vpc-123abcde789"},
+					"SubnetGroupId": {Value: "subnet-group-id"},
+					"MultiAz":       {Value: "true"},
 				},
 				Tags: map[string]string{
 					"environment": "production",
@@ -124,6 +124,130 @@ Tags:
 			},
 		},
 
+		// TemplateBody as a block string is kept verbatim
+		{
+			doc: `---
+Name: hellobuckets
+TemplateBody: |
+  Resources:
+    S3Bucket:
+      Type: AWS::S3::Bucket
+      Properties:
+        BucketName: !Sub "${AWS::StackName}-bucket"`,
+			out: &StackConfig{
+				Name:         "hellobuckets",
+				TemplateBody: "Resources:\n  S3Bucket:\n    Type: AWS::S3::Bucket\n    Properties:\n      BucketName: !Sub \"${AWS::StackName}-bucket\"",
+			},
+		},
+
+		// TemplateBody as a JSON block string
+		{
+			doc: `---
+Name: hellobuckets
+TemplateBody: |
+  {"Resources": {"S3Bucket": {"Type": "AWS::S3::Bucket"}}}`,
+			out: &StackConfig{
+				Name:         "hellobuckets",
+				TemplateBody: `{"Resources": {"S3Bucket": {"Type": "AWS::S3::Bucket"}}}`,
+			},
+		},
+
+		// Parameters using previous values
+		{
+			doc: `---
+Name: hellobuckets
+UsePreviousTemplate: true
+Parameters:
+  DbPassword:
+    UsePreviousValue: true
+  Port: 5432
+  Version: 1.5`,
+			out: &StackConfig{
+				Name:                "hellobuckets",
+				UsePreviousTemplate: true,
+				Parameters: map[string]ParameterValue{
+					"DbPassword": {UsePreviousValue: true},
+					"Port":       {Value: "5432"},
+					"Version":    {Value: "1.5"},
+				},
+			},
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+UsePreviousTemplate: true
+TemplateURL: https://example.com/mytemplate.yaml`,
+			err: errors.New("use_previous_template and template_url/template_body/template_path cannot both be set"),
+		},
+
+		// StackPolicy as inline YAML
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml
+StackPolicy:
+  Statement:
+  - Effect: Allow
+    Action: Update:*
+    Principal: "*"
+    Resource: "*"`,
+			out: &StackConfig{
+				Name:        "hellobuckets",
+				TemplateURL: "https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml",
+				StackPolicy: stackPolicy{
+					Body: `{"Statement":[{"Action":"Update:*","Effect":"Allow","Principal":"*","Resource":"*"}]}`,
+				},
+			},
+		},
+
+		// StackPolicy as inline JSON
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml
+StackPolicy: |
+  {"Statement": []}`,
+			out: &StackConfig{
+				Name:        "hellobuckets",
+				TemplateURL: "https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml",
+				StackPolicy: stackPolicy{Body: "{\"Statement\": []}"},
+			},
+		},
+
+		// StackPolicy as an inline YAML block string
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml
+StackPolicy: |
+  Statement:
+  - Effect: Allow
+    Action: Update:*
+    Principal: "*"
+    Resource: "*"`,
+			out: &StackConfig{
+				Name:        "hellobuckets",
+				TemplateURL: "https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml",
+				StackPolicy: stackPolicy{
+					Body: `{"Statement":[{"Action":"Update:*","Effect":"Allow","Principal":"*","Resource":"*"}]}`,
+				},
+			},
+		},
+
+		// StackPolicy as a path
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml
+StackPolicy: policies/database.json`,
+			out: &StackConfig{
+				Name:        "hellobuckets",
+				TemplateURL: "https://cfn-deploy-templates.s3.amazonaws.com/s3bucket-barebones.local.yaml",
+				StackPolicy: stackPolicy{Path: "policies/database.json"},
+			},
+		},
+
 		{
 			doc: `---
 Name: hellobuckets
@@ -150,6 +274,147 @@ TemplateURL: https://example.com/mytemplate.yaml`,
 			err: errors.New("Missing fields from document: name"),
 		},
 
+		// Regions with overrides and rollout settings
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Parameters:
+  InstanceType: t3.micro
+Regions:
+- us-east-1
+- eu-west-1
+RegionOverrides:
+  eu-west-1:
+    Parameters:
+      InstanceType: t3.small
+    TemplateBucket: templates-eu-west-1
+Rollout:
+  WaveSize: 2
+  FailureTolerance: 1`,
+			out: &StackConfig{
+				Name:        "hellobuckets",
+				TemplateURL: "https://example.com/mytemplate.yaml",
+				Parameters: map[string]ParameterValue{
+					"InstanceType": {Value: "t3.micro"},
+				},
+				Regions: []string{"us-east-1", "eu-west-1"},
+				RegionOverrides: map[string]RegionOverride{
+					"eu-west-1": {
+						Parameters:     map[string]ParameterValue{"InstanceType": {Value: "t3.small"}},
+						TemplateBucket: "templates-eu-west-1",
+					},
+				},
+				Rollout: RolloutConfig{WaveSize: 2, FailureTolerance: 1},
+			},
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Region: us-east-1
+Regions: [us-east-1, eu-west-1]`,
+			err: errors.New("region and regions cannot both be set"),
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Regions: [us-east-1, eu-west-1, us-east-1]`,
+			err: errors.New("region us-east-1 is listed more than once in regions"),
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Regions: [us-east-1]
+RegionOverrides:
+  eu-west-1:
+    Parameters:
+      InstanceType: t3.small`,
+			err: errors.New("region_overrides has settings for eu-west-1 which is not listed in regions"),
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Regions: [us-east-1]
+Rollout:
+  WaveSize: -1`,
+			err: errors.New("rollout wave_size and failure_tolerance cannot be negative"),
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Hooks:
+  PreSync: ["./drain.sh", ""]`,
+			err: errors.New("hooks pre_sync cannot contain empty commands"),
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Hooks:
+  PreSync:
+  - ./drain.sh
+  PostSuccess:
+  - ./smoke-test.sh $STACKSHOT_OUTPUT_ApiUrl`,
+			out: &StackConfig{
+				Name:        "hellobuckets",
+				TemplateURL: "https://example.com/mytemplate.yaml",
+				Hooks: Hooks{
+					PreSync:     []string{"./drain.sh"},
+					PostSuccess: []string{"./smoke-test.sh $STACKSHOT_OUTPUT_ApiUrl"},
+				},
+			},
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Notifications:
+- URLEnv: SLACK_WEBHOOK_URL
+  Format: slack
+  Events: [failing, failed]
+- URL: https://example.com/hooks/deploys
+  Template: '{"message": {{json .Text}}}'`,
+			out: &StackConfig{
+				Name:        "hellobuckets",
+				TemplateURL: "https://example.com/mytemplate.yaml",
+				Notifications: []NotificationConfig{
+					{URLEnv: "SLACK_WEBHOOK_URL", Format: "slack", Events: []string{"failing", "failed"}},
+					{URL: "https://example.com/hooks/deploys", Template: `{"message": {{json .Text}}}`},
+				},
+			},
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Notifications:
+- URL: https://example.com/hooks/deploys
+  Format: discord`,
+			err: errors.New("notifications format discord must be json, slack, or teams"),
+		},
+
+		{
+			doc: `---
+Name: hellobuckets
+TemplateURL: https://example.com/mytemplate.yaml
+Notifications:
+- Format: slack`,
+			err: errors.New("notifications need a url or url_env"),
+		},
+
 		{
 			doc: `---
 EnableTerminationProtection: true`,
@@ -181,3 +446,132 @@ EnableTerminationProtection: true`,
 	}
 
 }
+
+func TestStackSetYAMLParsing(t *testing.T) {
+	tests := []struct {
+		doc string
+		out *StackSetConfig
+		err error
+	}{
+		{
+			doc: `---
+Kind: StackSet
+Name: baseline
+TemplatePath: templates/baseline.yaml
+Parameters:
+  Env: production
+PermissionModel: SERVICE_MANAGED
+AutoDeployment:
+  Enabled: true
+DeploymentTargets:
+  OrganizationalUnitIds: [ou-abcd-1234]
+Regions: [us-east-1, eu-west-1]
+OperationPreferences:
+  FailureToleranceCount: 1
+  MaxConcurrentPercentage: 50`,
+			out: &StackSetConfig{
+				Kind:              "StackSet",
+				Name:              "baseline",
+				TemplatePath:      "templates/baseline.yaml",
+				Parameters:        map[string]ParameterValue{"Env": {Value: "production"}},
+				PermissionModel:   "SERVICE_MANAGED",
+				AutoDeployment:    &StackSetAutoDeployment{Enabled: true},
+				DeploymentTargets: StackSetDeploymentTargets{OrganizationalUnitIds: []string{"ou-abcd-1234"}},
+				Regions:           []string{"us-east-1", "eu-west-1"},
+				OperationPreferences: StackSetOperationPreferences{
+					FailureToleranceCount:   1,
+					MaxConcurrentPercentage: 50,
+				},
+			},
+		},
+
+		{
+			doc: `---
+Name: baseline
+TemplatePath: templates/baseline.yaml`,
+			err: errors.New("document is not a StackSet"),
+		},
+
+		{
+			doc: `---
+Kind: StackSet
+TemplatePath: templates/baseline.yaml`,
+			err: errors.New("Missing fields from document: name"),
+		},
+
+		{
+			doc: `---
+Kind: StackSet
+Name: baseline
+TemplatePath: templates/baseline.yaml
+TemplateURL: https://example.com/baseline.yaml`,
+			err: errors.New("only one of template_url, template_body, or template_path can be set"),
+		},
+
+		{
+			doc: `---
+Kind: StackSet
+Name: baseline
+TemplatePath: templates/baseline.yaml
+DeploymentTargets:
+  OrganizationalUnitIds: [ou-abcd-1234]
+Regions: [us-east-1]`,
+			err: errors.New("deployment_targets organizational_unit_ids requires the SERVICE_MANAGED permission_model"),
+		},
+
+		{
+			doc: `---
+Kind: StackSet
+Name: baseline
+TemplatePath: templates/baseline.yaml
+PermissionModel: SERVICE_MANAGED
+DeploymentTargets:
+  Accounts: ["111111111111"]
+Regions: [us-east-1]`,
+			err: errors.New("deployment_targets accounts requires the SELF_MANAGED permission_model"),
+		},
+
+		{
+			doc: `---
+Kind: StackSet
+Name: baseline
+TemplatePath: templates/baseline.yaml
+DeploymentTargets:
+  Accounts: ["111111111111"]`,
+			err: errors.New("regions must be set to deploy to deployment_targets"),
+		},
+
+		{
+			doc: `---
+Kind: StackSet
+Name: baseline
+TemplatePath: templates/baseline.yaml
+OperationPreferences:
+  MaxConcurrentCount: 2
+  MaxConcurrentPercentage: 50`,
+			err: errors.New("max_concurrent_count and max_concurrent_percentage cannot both be set"),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(
+			fmt.Sprintf("#%d", i),
+			func(t *testing.T) {
+				config, err := NewStackSetFromYAML([]byte(test.doc))
+				if !equalErrors(err, test.err) {
+					t.Fatalf("Expected error: %v, got: %v", test.err, err)
+				}
+
+				if test.out != nil && !cmp.Equal(config, test.out) {
+					t.Errorf("Unexpected config: %s", cmp.Diff(test.out, config))
+				}
+			},
+		)
+	}
+
+	_, err := NewStackFromYAML([]byte("Kind: StackSet\nName: baseline\nTemplatePath: baseline.yaml"))
+	expected := errors.New("document is a StackSet, not a Stack")
+	if !equalErrors(err, expected) {
+		t.Errorf("Expected error: %v, got: %v", expected, err)
+	}
+}
@@ -0,0 +1,152 @@
+package stackshot
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// errConsumerClosed is returned when events are passed to a closed
+// AsyncConsumer.
+var errConsumerClosed = errors.New("event consumer is closed")
+
+// MultiConsumer returns an EventConsumer passing every event to each of
+// consumers in order. Like io.MultiWriter, it stops at the first consumer
+// returning an error and returns the error.
+func MultiConsumer(consumers ...EventConsumer) EventConsumer {
+	return EventConsumerFunc(func(event *cloudformation.StackEvent) error {
+		for _, consumer := range consumers {
+			if err := consumer.Consume(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FilterConsumer returns an EventConsumer passing only the events match
+// returns true for to consumer. EventFilter.Match can be used as match.
+func FilterConsumer(match func(*cloudformation.StackEvent) bool, consumer EventConsumer) EventConsumer {
+	return EventConsumerFunc(func(event *cloudformation.StackEvent) error {
+		if !match(event) {
+			return nil
+		}
+		return consumer.Consume(event)
+	})
+}
+
+// BufferedConsumer is an EventConsumer keeping the events passed to it, e.g.
+// to summarize failures once a sync finishes. It's safe for concurrent use.
+type BufferedConsumer struct {
+	mu     sync.Mutex
+	events []*cloudformation.StackEvent
+}
+
+func (b *BufferedConsumer) Consume(event *cloudformation.StackEvent) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, event)
+	return nil
+}
+
+// Events returns the buffered events in the order they were consumed.
+func (b *BufferedConsumer) Events() []*cloudformation.StackEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events := make([]*cloudformation.StackEvent, len(b.events))
+	copy(events, b.events)
+	return events
+}
+
+// Flush passes the buffered events to consumer and empties the buffer. Events
+// after the first one consumer fails on stay buffered.
+func (b *BufferedConsumer) Flush(consumer EventConsumer) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, event := range b.events {
+		if err := consumer.Consume(event); err != nil {
+			b.events = b.events[i:]
+			return err
+		}
+	}
+	b.events = nil
+	return nil
+}
+
+// AsyncConsumer is an EventConsumer passing events to another consumer from
+// its own goroutine so that slow consumers, like ones making HTTP requests,
+// don't hold up polling a stack. Events are queued without bound and passed
+// along in order. It's safe for concurrent use, so a single AsyncConsumer can
+// serialize the events of stacks synced concurrently.
+//
+// Close() must be called once no more events are passed to it.
+type AsyncConsumer struct {
+	consumer EventConsumer
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*cloudformation.StackEvent
+	closed bool
+
+	// err is the first error returned by consumer. It's only read once done
+	// is closed.
+	err  error
+	done chan struct{}
+}
+
+// NewAsyncConsumer starts an AsyncConsumer passing events to consumer.
+func NewAsyncConsumer(consumer EventConsumer) *AsyncConsumer {
+	a := &AsyncConsumer{consumer: consumer, done: make(chan struct{})}
+	a.cond = sync.NewCond(&a.mu)
+	go a.run()
+	return a
+}
+
+// Consume queues event and returns immediately. Errors from the underlying
+// consumer are returned by Close().
+func (a *AsyncConsumer) Consume(event *cloudformation.StackEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return errConsumerClosed
+	}
+	a.queue = append(a.queue, event)
+	a.cond.Signal()
+	return nil
+}
+
+// Close waits until every queued event is passed along and returns the first
+// error the underlying consumer returned. Events after an error are dropped.
+func (a *AsyncConsumer) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	a.cond.Signal()
+	a.mu.Unlock()
+
+	<-a.done
+	return a.err
+}
+
+func (a *AsyncConsumer) run() {
+	defer close(a.done)
+	for {
+		a.mu.Lock()
+		for len(a.queue) == 0 && !a.closed {
+			a.cond.Wait()
+		}
+		events := a.queue
+		a.queue = nil
+		a.mu.Unlock()
+
+		if len(events) == 0 {
+			return
+		}
+		for _, event := range events {
+			if a.err != nil {
+				break
+			}
+			a.err = a.consumer.Consume(event)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package stackshot
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+func eventIds(events []*cfn.StackEvent) []string {
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, aws.StringValue(event.EventId))
+	}
+	return ids
+}
+
+func TestMultiConsumer(t *testing.T) {
+	first, second := &eventCollector{}, &eventCollector{}
+	consumer := MultiConsumer(first, second)
+	if err := consumer.Consume(&cfn.StackEvent{EventId: aws.String("1")}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(first.events) != 1 || len(second.events) != 1 {
+		t.Errorf("Expected every consumer to get the event, got: %d and %d", len(first.events), len(second.events))
+	}
+
+	failure := errors.New("failed")
+	third := &eventCollector{}
+	consumer = MultiConsumer(first, EventConsumerFunc(func(*cfn.StackEvent) error { return failure }), third)
+	if err := consumer.Consume(&cfn.StackEvent{}); err != failure {
+		t.Errorf("Expected the failing consumer's error, got: %v", err)
+	}
+	if len(third.events) != 0 {
+		t.Errorf("Expected consumers after a failure to be skipped")
+	}
+}
+
+func TestFilterConsumer(t *testing.T) {
+	collector := &eventCollector{}
+	filter := EventFilter{Statuses: []string{"FAILED"}}
+	consumer := FilterConsumer(filter.Match, collector)
+	for _, status := range []string{"CREATE_IN_PROGRESS", "CREATE_FAILED", "ROLLBACK_COMPLETE"} {
+		if err := consumer.Consume(&cfn.StackEvent{EventId: aws.String(status), ResourceStatus: aws.String(status)}); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+
+	ids := eventIds(collector.events)
+	if len(ids) != 1 || ids[0] != "CREATE_FAILED" {
+		t.Errorf("Expected only failures, got: %v", ids)
+	}
+}
+
+func TestBufferedConsumer(t *testing.T) {
+	buffer := &BufferedConsumer{}
+	for _, id := range []string{"1", "2", "3"} {
+		buffer.Consume(&cfn.StackEvent{EventId: aws.String(id)})
+	}
+	if ids := eventIds(buffer.Events()); len(ids) != 3 || ids[0] != "1" || ids[2] != "3" {
+		t.Errorf("Unexpected buffered events: %v", ids)
+	}
+
+	failure := errors.New("failed")
+	seen := 0
+	err := buffer.Flush(EventConsumerFunc(func(*cfn.StackEvent) error {
+		seen++
+		if seen == 2 {
+			return failure
+		}
+		return nil
+	}))
+	if err != failure {
+		t.Errorf("Expected the flush to fail, got: %v", err)
+	}
+	if ids := eventIds(buffer.Events()); len(ids) != 2 || ids[0] != "2" {
+		t.Errorf("Expected unflushed events to stay buffered, got: %v", ids)
+	}
+
+	collector := &eventCollector{}
+	if err := buffer.Flush(collector); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(collector.events) != 2 || len(buffer.Events()) != 0 {
+		t.Errorf("Expected the buffer to be flushed, got %d flushed and %d buffered", len(collector.events), len(buffer.Events()))
+	}
+}
+
+func TestAsyncConsumer(t *testing.T) {
+	release := make(chan struct{})
+	collector := &eventCollector{}
+	async := NewAsyncConsumer(EventConsumerFunc(func(event *cfn.StackEvent) error {
+		<-release
+		return collector.Consume(event)
+	}))
+
+	// Consume doesn't wait for the blocked consumer.
+	wg := sync.WaitGroup{}
+	for _, id := range []string{"1", "2", "3"} {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if err := async.Consume(&cfn.StackEvent{EventId: aws.String(id)}); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	close(release)
+	if err := async.Close(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(collector.events) != 3 {
+		t.Errorf("Expected every event to be passed along before Close returns, got: %d", len(collector.events))
+	}
+	if err := async.Consume(&cfn.StackEvent{}); err == nil {
+		t.Errorf("Expected an error consuming after Close")
+	}
+
+	failure := errors.New("failed")
+	calls := 0
+	async = NewAsyncConsumer(EventConsumerFunc(func(*cfn.StackEvent) error {
+		calls++
+		return failure
+	}))
+	async.Consume(&cfn.StackEvent{})
+	async.Consume(&cfn.StackEvent{})
+	if err := async.Close(); err != failure {
+		t.Errorf("Expected the consumer's error from Close, got: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected events after a failure to be dropped, got %d calls", calls)
+	}
+}
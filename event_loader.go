@@ -10,9 +10,11 @@ import (
 // eventLoader is an interface type that loads Stack Events from a
 // Cloudformation Stack. The storeLastEvent() enables clients to store the
 // latest event so that calls to latestEvents() will return all events after
-// the latest event.
+// the latest event. Once setClientRequestToken() is called, latestEvents()
+// only returns the events of the operation started with the token.
 type eventLoader interface {
 	setStackId(*string)
+	setClientRequestToken(string)
 	storeLastEvent() error
 	latestEvents(EventConsumer) error
 }
@@ -22,12 +24,17 @@ type stackEvents struct {
 	stackName         *string
 	stackId           *string
 	lastLoadedEventId *string
+	requestToken      string
 }
 
 func (s *stackEvents) setStackId(id *string) {
 	s.stackId = id
 }
 
+func (s *stackEvents) setClientRequestToken(token string) {
+	s.requestToken = token
+}
+
 func (s *stackEvents) storeLastEvent() error {
 	output, err := s.api.DescribeStackEvents(
 		&cloudformation.DescribeStackEventsInput{
@@ -70,8 +77,14 @@ func (s *stackEvents) latestEvents(consumer EventConsumer) error {
 	// newEvents contains events in the same order DescribeStackEvents returns
 	// them in: reverse chronological order. Therefore, we reverse newEvents to
 	// send all events to the eventConsumer in chronological order.
+	//
+	// Events of other operations, which are polled when they race with the
+	// operation holding requestToken, are skipped.
 	for i := len(newEvents) - 1; i >= 0; i-- {
 		event := newEvents[i]
+		if s.requestToken != "" && aws.StringValue(event.ClientRequestToken) != s.requestToken {
+			continue
+		}
 		err := consumer.Consume(event)
 		if err != nil {
 			return err
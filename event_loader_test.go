@@ -228,4 +228,59 @@ func TestStackEvents(t *testing.T) {
 			}
 		},
 	)
+	t.Run(
+		"latestEvents skips events of other operations",
+		func(t *testing.T) {
+			api := MockAPI{}
+			events := []*cfn.StackEvent{
+				&cfn.StackEvent{
+					EventId:            aws.String("3"),
+					Timestamp:          newTimestamp(),
+					LogicalResourceId:  aws.String(stackName),
+					ResourceStatus:     aws.String("UPDATE_IN_PROGRESS"),
+					ClientRequestToken: aws.String("someone-else"),
+				},
+				&cfn.StackEvent{
+					EventId:            aws.String("2"),
+					Timestamp:          newTimestamp(),
+					LogicalResourceId:  aws.String(stackName),
+					ResourceStatus:     aws.String("UPDATE_IN_PROGRESS"),
+					ClientRequestToken: aws.String("my-token"),
+				},
+				&cfn.StackEvent{
+					EventId:           aws.String("1"),
+					Timestamp:         newTimestamp(),
+					LogicalResourceId: aws.String(stackName),
+					ResourceStatus:    aws.String("UPDATE_COMPLETE"),
+				},
+			}
+			api.DescribeStackEventsPagesFn = GenDescribeStackEventsPagesFn(
+				&cfn.DescribeStackEventsOutput{StackEvents: events},
+				false,
+			)
+			consumer := &eventCollector{}
+
+			stackEvents := &stackEvents{
+				api:       &api,
+				stackName: &stackName,
+			}
+			stackEvents.setClientRequestToken("my-token")
+
+			err := stackEvents.latestEvents(consumer)
+			if err != nil {
+				t.Errorf("Expected latestEvents to succeed. Got error: %s", err)
+			}
+
+			if len(consumer.events) != 1 || aws.StringValue(consumer.events[0].EventId) != "2" {
+				t.Errorf("Expected only event 2 to be consumed. Got: %v", consumer.events)
+			}
+
+			if aws.StringValue(stackEvents.lastLoadedEventId) != "3" {
+				t.Errorf(
+					"Expected lastLoadedEventId to be 3. Got: %s",
+					aws.StringValue(stackEvents.lastLoadedEventId),
+				)
+			}
+		},
+	)
 }
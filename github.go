@@ -0,0 +1,90 @@
+package stackshot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteGitHubSummary writes a Markdown deployment summary of summaries in the
+// format of GitHub Actions' $GITHUB_STEP_SUMMARY file.
+func WriteGitHubSummary(w io.Writer, summaries []*StackSummary) error {
+	buf := bytes.Buffer{}
+	buf.WriteString("## stackshot deployment\n\n")
+	buf.WriteString("| Stack | Region | Result | Duration | Resources changed |\n")
+	buf.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, s := range summaries {
+		fmt.Fprintf(
+			&buf,
+			"| %s | %s | %s | %s | %d |\n",
+			markdownCell(s.Name), markdownCell(s.Region), s.Result, s.Duration.Round(time.Second), len(s.Resources),
+		)
+	}
+
+	for _, s := range summaries {
+		if s.Error == "" && len(s.Resources) == 0 && len(s.Outputs) == 0 {
+			continue
+		}
+
+		name := s.Name
+		if s.Region != "" {
+			name += " (" + s.Region + ")"
+		}
+		fmt.Fprintf(&buf, "\n### %s\n", name)
+
+		if s.Error != "" {
+			fmt.Fprintf(&buf, "\n```\n%s\n```\n", strings.TrimRight(s.Error, "\n"))
+		}
+
+		if len(s.Resources) > 0 {
+			buf.WriteString("\n| Resource | Type | Status |\n| --- | --- | --- |\n")
+			for _, r := range s.Resources {
+				fmt.Fprintf(&buf, "| %s | %s | %s |\n", markdownCell(r.LogicalResourceId), markdownCell(r.ResourceType), r.Status)
+			}
+		}
+
+		if len(s.Outputs) > 0 {
+			buf.WriteString("\n| Output | Value |\n| --- | --- |\n")
+			for _, key := range s.Outputs.Keys() {
+				fmt.Fprintf(&buf, "| %s | %s |\n", markdownCell(key), markdownCell(s.Outputs[key].Value))
+			}
+		}
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// markdownCell escapes value for a Markdown table cell.
+func markdownCell(value string) string {
+	value = strings.Replace(value, "|", `\|`, -1)
+	return strings.Replace(value, "\n", "<br>", -1)
+}
+
+// GitHubError returns a GitHub Actions workflow command annotating file with
+// an error. The message may span multiple lines.
+func GitHubError(file, title, message string) string {
+	properties := []string{}
+	if file != "" {
+		properties = append(properties, "file="+escapeGitHubProperty(file))
+	}
+	if title != "" {
+		properties = append(properties, "title="+escapeGitHubProperty(title))
+	}
+
+	command := "::error"
+	if len(properties) > 0 {
+		command += " " + strings.Join(properties, ",")
+	}
+	return command + "::" + escapeGitHubData(message)
+}
+
+func escapeGitHubData(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+func escapeGitHubProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
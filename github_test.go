@@ -0,0 +1,81 @@
+package stackshot
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteGitHubSummary(t *testing.T) {
+	summaries := []*StackSummary{
+		{
+			Name:     "api",
+			Region:   "us-east-1",
+			Result:   SyncSucceeded,
+			Duration: 92*time.Second + 400*time.Millisecond,
+			Resources: []*ResourceResult{
+				{LogicalResourceId: "MyBucket", ResourceType: "AWS::S3::Bucket", Status: "CREATE_COMPLETE"},
+			},
+			Outputs: Outputs{"Url": {Value: "https://api.example.com"}},
+		},
+		{Name: "web", Result: SyncUnchanged, Duration: 3 * time.Second},
+		{Name: "db", Result: SyncFailed, Duration: time.Second, Error: "stack configuration failed validation:\n  - missing | parameter"},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteGitHubSummary(buf, summaries); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := "## stackshot deployment\n" +
+		"\n" +
+		"| Stack | Region | Result | Duration | Resources changed |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| api | us-east-1 | succeeded | 1m32s | 1 |\n" +
+		"| web |  | unchanged | 3s | 0 |\n" +
+		"| db |  | failed | 1s | 0 |\n" +
+		"\n" +
+		"### api (us-east-1)\n" +
+		"\n" +
+		"| Resource | Type | Status |\n" +
+		"| --- | --- | --- |\n" +
+		"| MyBucket | AWS::S3::Bucket | CREATE_COMPLETE |\n" +
+		"\n" +
+		"| Output | Value |\n" +
+		"| --- | --- |\n" +
+		"| Url | https://api.example.com |\n" +
+		"\n" +
+		"### db\n" +
+		"\n" +
+		"```\n" +
+		"stack configuration failed validation:\n" +
+		"  - missing | parameter\n" +
+		"```\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected summary: %s", cmp.Diff(expected, buf.String()))
+	}
+}
+
+func TestGitHubError(t *testing.T) {
+	tests := []struct {
+		file, title, message string
+		expected             string
+	}{
+		{"", "", "failed", "::error::failed"},
+		{"stacks/api.yaml", "", "failed", "::error file=stacks/api.yaml::failed"},
+		{
+			"stacks/api.yaml",
+			"Failed to sync api, in us-east-1: 100%",
+			"validation failed:\n  - missing",
+			"::error file=stacks/api.yaml,title=Failed to sync api%2C in us-east-1%3A 100%25::validation failed:%0A  - missing",
+		},
+	}
+
+	for _, test := range tests {
+		if command := GitHubError(test.file, test.title, test.message); command != test.expected {
+			t.Errorf("Expected %q, got: %q", test.expected, command)
+		}
+	}
+}
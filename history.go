@@ -0,0 +1,97 @@
+package stackshot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// EventFilter selects the past StackEvents EventHistory() passes along. Zero
+// values don't filter.
+type EventFilter struct {
+	// Since skips events older than it.
+	Since time.Time
+
+	// Statuses match a ResourceStatus exactly or as its suffix, so FAILED
+	// matches CREATE_FAILED and UPDATE_ROLLBACK_FAILED.
+	Statuses []string
+
+	// Resources match the LogicalResourceId of events. The stack's own
+	// events have its name as their LogicalResourceId.
+	Resources []string
+
+	// Limit keeps only the most recent matching events.
+	Limit int
+}
+
+// Match reports whether event passes every filter but Limit.
+func (f *EventFilter) Match(event *cloudformation.StackEvent) bool {
+	if !f.Since.IsZero() && aws.TimeValue(event.Timestamp).Before(f.Since) {
+		return false
+	}
+	if len(f.Statuses) > 0 && !matchesStatus(aws.StringValue(event.ResourceStatus), f.Statuses) {
+		return false
+	}
+	if len(f.Resources) > 0 && !containsString(f.Resources, aws.StringValue(event.LogicalResourceId)) {
+		return false
+	}
+	return true
+}
+
+func matchesStatus(status string, statuses []string) bool {
+	for _, s := range statuses {
+		if status == s || strings.HasSuffix(status, "_"+s) {
+			return true
+		}
+	}
+	return false
+}
+
+// EventHistory passes the stack's past StackEvents matching filter to
+// consumer in chronological order. Unlike the events polled during a sync, it
+// reaches back to the stack's creation, or to filter.Since.
+func (s *Stack) EventHistory(filter EventFilter, consumer EventConsumer) error {
+	if s.cloudStack == nil {
+		return fmt.Errorf(stackDoesNotExistErrorFmt, s.config.Name)
+	}
+
+	// DescribeStackEvents returns the most recent events first, so paging
+	// stops at the first event older than filter.Since or once Limit events
+	// matched.
+	events := []*cloudformation.StackEvent{}
+	err := s.api.DescribeStackEventsPages(
+		&cloudformation.DescribeStackEventsInput{
+			StackName: s.cloudStack.StackId,
+		},
+		func(output *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
+			for _, event := range output.StackEvents {
+				if !filter.Since.IsZero() && aws.TimeValue(event.Timestamp).Before(filter.Since) {
+					return false
+				}
+				if !filter.Match(event) {
+					continue
+				}
+
+				events = append(events, event)
+				if filter.Limit > 0 && len(events) == filter.Limit {
+					return false
+				}
+			}
+			return !lastPage
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to load stack events")
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if err := consumer.Consume(events[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package stackshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEventHistory(t *testing.T) {
+	start := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	event := func(minute int, resource, status string) *cfn.StackEvent {
+		timestamp := start.Add(time.Duration(minute) * time.Minute)
+		return &cfn.StackEvent{
+			EventId:           aws.String(resource + "-" + status),
+			Timestamp:         &timestamp,
+			LogicalResourceId: aws.String(resource),
+			ResourceStatus:    aws.String(status),
+		}
+	}
+
+	// Pages of events, most recent first like DescribeStackEvents.
+	pages := [][]*cfn.StackEvent{
+		{
+			event(50, "mystack", "UPDATE_ROLLBACK_COMPLETE"),
+			event(40, "MyBucket", "UPDATE_FAILED"),
+			event(30, "MyQueue", "UPDATE_COMPLETE"),
+		},
+		{
+			event(20, "mystack", "UPDATE_IN_PROGRESS"),
+			event(10, "MyBucket", "CREATE_FAILED"),
+			event(0, "MyBucket", "CREATE_IN_PROGRESS"),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		filter   EventFilter
+		expected []string
+		pages    int
+	}{
+		{
+			"Every event",
+			EventFilter{},
+			[]string{"MyBucket-CREATE_IN_PROGRESS", "MyBucket-CREATE_FAILED", "mystack-UPDATE_IN_PROGRESS", "MyQueue-UPDATE_COMPLETE", "MyBucket-UPDATE_FAILED", "mystack-UPDATE_ROLLBACK_COMPLETE"},
+			2,
+		},
+		{
+			"Status suffixes",
+			EventFilter{Statuses: []string{"FAILED"}},
+			[]string{"MyBucket-CREATE_FAILED", "MyBucket-UPDATE_FAILED"},
+			2,
+		},
+		{
+			"Resources",
+			EventFilter{Resources: []string{"mystack", "MyQueue"}},
+			[]string{"mystack-UPDATE_IN_PROGRESS", "MyQueue-UPDATE_COMPLETE", "mystack-UPDATE_ROLLBACK_COMPLETE"},
+			2,
+		},
+		{
+			"Since stops paging",
+			EventFilter{Since: start.Add(30 * time.Minute)},
+			[]string{"MyQueue-UPDATE_COMPLETE", "MyBucket-UPDATE_FAILED", "mystack-UPDATE_ROLLBACK_COMPLETE"},
+			2,
+		},
+		{
+			"Limit keeps the most recent events",
+			EventFilter{Resources: []string{"MyBucket"}, Limit: 2},
+			[]string{"MyBucket-CREATE_FAILED", "MyBucket-UPDATE_FAILED"},
+			2,
+		},
+		{
+			"Limit stops paging",
+			EventFilter{Limit: 2},
+			[]string{"MyBucket-UPDATE_FAILED", "mystack-UPDATE_ROLLBACK_COMPLETE"},
+			1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loaded := 0
+			api := &MockAPI{}
+			api.DescribeStackEventsPagesFn = func(input *cfn.DescribeStackEventsInput, fn func(*cfn.DescribeStackEventsOutput, bool) bool) error {
+				if aws.StringValue(input.StackName) != "arn:mystack" {
+					t.Errorf("Expected events of arn:mystack, got: %s", aws.StringValue(input.StackName))
+				}
+				for i, page := range pages {
+					loaded++
+					if !fn(&cfn.DescribeStackEventsOutput{StackEvents: page}, i == len(pages)-1) {
+						break
+					}
+				}
+				return nil
+			}
+
+			stack := &Stack{
+				api:        api,
+				config:     &StackConfig{Name: "mystack"},
+				cloudStack: &cfn.Stack{StackId: aws.String("arn:mystack")},
+			}
+
+			collector := &eventCollector{}
+			if err := stack.EventHistory(test.filter, collector); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			ids := []string{}
+			for _, event := range collector.events {
+				ids = append(ids, aws.StringValue(event.EventId))
+			}
+			if !cmp.Equal(ids, test.expected) {
+				t.Errorf("Unexpected events: %s", cmp.Diff(test.expected, ids))
+			}
+			if loaded != test.pages {
+				t.Errorf("Expected %d pages loaded, got: %d", test.pages, loaded)
+			}
+		})
+	}
+
+	stack := &Stack{config: &StackConfig{Name: "mystack"}}
+	if err := stack.EventHistory(EventFilter{}, &eventCollector{}); err == nil {
+		t.Errorf("Expected an error loading the history of a stack that doesn't exist")
+	}
+}
@@ -0,0 +1,186 @@
+package stackshot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Hook names passed to hook commands in STACKSHOT_HOOK.
+const (
+	HookPreSync     = "PreSync"
+	HookPostSuccess = "PostSuccess"
+	HookPostFailure = "PostFailure"
+)
+
+// Hooks are shell commands run by SyncAndPollEvents() around a sync. Each
+// command is run with `sh -c` in order, and a failing command stops the
+// commands after it.
+//
+// Commands receive the stack's metadata and outputs as environment variables:
+//
+//	STACKSHOT_HOOK          PreSync, PostSuccess, or PostFailure
+//	STACKSHOT_STACK_NAME    the stack's name
+//	STACKSHOT_STACK_ID      the stack's id, once it exists
+//	STACKSHOT_STACK_STATUS  the stack's status, once it exists
+//	STACKSHOT_REGION        the stack's Region, when set
+//	STACKSHOT_RESULT        succeeded, failed, or unchanged in post hooks
+//	STACKSHOT_ERROR         why the sync failed in PostFailure hooks
+//	STACKSHOT_OUTPUT_<Key>  each of the stack's outputs
+type Hooks struct {
+	// PreSync commands run before the stack is synced. A failing command
+	// aborts the sync.
+	PreSync []string
+
+	// PostSuccess commands run after the stack finished syncing, including
+	// when there were no updates to perform. A failing command fails the
+	// sync.
+	PostSuccess []string
+
+	// PostFailure commands run after the stack failed to sync. They can't
+	// change the outcome of the sync.
+	PostFailure []string
+}
+
+func (h *Hooks) verify() error {
+	for name, commands := range map[string][]string{
+		"pre_sync":     h.PreSync,
+		"post_success": h.PostSuccess,
+		"post_failure": h.PostFailure,
+	} {
+		for _, command := range commands {
+			if strings.TrimSpace(command) == "" {
+				return fmt.Errorf("hooks %s cannot contain empty commands", name)
+			}
+		}
+	}
+	return nil
+}
+
+// WithHookOutput sets where hook commands' output and notifiers' errors are
+// written. Every line is prefixed with prefix and the hook's name. Hook output
+// goes to stdout by default.
+func WithHookOutput(w io.Writer, prefix string) StackOption {
+	return func(s *Stack) {
+		s.hookOutput = w
+		s.hookPrefix = prefix
+	}
+}
+
+// runPostHooks runs the PostSuccess or PostFailure hooks depending on the
+// outcome of a sync that returned syncErr. It returns syncErr unless a
+// PostSuccess hook fails.
+func (s *Stack) runPostHooks(syncErr error) error {
+	result := syncOutcome(syncErr)
+	if result == SyncFailed {
+		if err := s.runHooks(HookPostFailure, s.config.Hooks.PostFailure, result, syncErr); err != nil {
+			fmt.Fprintf(s.hookWriter(HookPostFailure), "%s\n", err)
+		}
+		return syncErr
+	}
+
+	if err := s.runHooks(HookPostSuccess, s.config.Hooks.PostSuccess, result, nil); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// runHooks runs hook's commands. result and syncErr describe the outcome of
+// the sync to post hooks.
+func (s *Stack) runHooks(hook string, commands []string, result string, syncErr error) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	env := append(os.Environ(), s.hookEnv(hook, result, syncErr)...)
+	for _, command := range commands {
+		out := s.hookWriter(hook)
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = env
+		cmd.Stdout = out
+		cmd.Stderr = out
+
+		err := cmd.Run()
+		out.Flush()
+		if err != nil {
+			return fmt.Errorf("%s hook `%s` failed: %s", hook, command, err)
+		}
+	}
+	return nil
+}
+
+func (s *Stack) hookEnv(hook, result string, syncErr error) []string {
+	env := []string{
+		"STACKSHOT_HOOK=" + hook,
+		"STACKSHOT_STACK_NAME=" + s.config.Name,
+	}
+	if s.config.Region != "" {
+		env = append(env, "STACKSHOT_REGION="+s.config.Region)
+	}
+	if result != "" {
+		env = append(env, "STACKSHOT_RESULT="+result)
+	}
+	if syncErr != nil {
+		env = append(env, "STACKSHOT_ERROR="+syncErr.Error())
+	}
+	if s.requestToken != "" {
+		env = append(env, "STACKSHOT_CLIENT_REQUEST_TOKEN="+s.requestToken)
+	}
+
+	if s.cloudStack == nil {
+		return env
+	}
+	env = append(
+		env,
+		"STACKSHOT_STACK_ID="+aws.StringValue(s.cloudStack.StackId),
+		"STACKSHOT_STACK_STATUS="+aws.StringValue(s.cloudStack.StackStatus),
+	)
+
+	outputs := s.Outputs()
+	for _, key := range outputs.Keys() {
+		env = append(env, "STACKSHOT_OUTPUT_"+key+"="+outputs[key].Value)
+	}
+	return env
+}
+
+func (s *Stack) hookWriter(hook string) *linePrefixWriter {
+	out := s.hookOutput
+	if out == nil {
+		out = os.Stdout
+	}
+	return &linePrefixWriter{w: out, prefix: fmt.Sprintf("%s[%s] ", s.hookPrefix, hook)}
+}
+
+// linePrefixWriter writes every line written to it to w with prefix. A final
+// line without a newline is written by Flush().
+type linePrefixWriter struct {
+	w      io.Writer
+	prefix string
+	buf    bytes.Buffer
+}
+
+func (l *linePrefixWriter) Write(p []byte) (int, error) {
+	l.buf.Write(p)
+	for {
+		i := bytes.IndexByte(l.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := l.buf.Next(i + 1)
+		if _, err := fmt.Fprintf(l.w, "%s%s", l.prefix, line); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+func (l *linePrefixWriter) Flush() {
+	if l.buf.Len() > 0 {
+		fmt.Fprintf(l.w, "%s%s\n", l.prefix, l.buf.Bytes())
+		l.buf.Reset()
+	}
+}
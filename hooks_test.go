@@ -0,0 +1,130 @@
+package stackshot
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHooks(t *testing.T) {
+	deployed := &cfn.Stack{
+		StackId:     aws.String("arn:mystack"),
+		StackName:   aws.String("mystack"),
+		StackStatus: aws.String("UPDATE_COMPLETE"),
+		Outputs: []*cfn.Output{
+			{OutputKey: aws.String("ApiUrl"), OutputValue: aws.String("https://api.example.com")},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		hooks       Hooks
+		updateErr   error
+		shouldError string
+		updated     bool
+		output      []string
+	}{
+		{
+			name: "Hooks receive the stack's metadata and outputs",
+			hooks: Hooks{
+				PreSync:     []string{"echo $STACKSHOT_HOOK $STACKSHOT_STACK_NAME $STACKSHOT_REGION"},
+				PostSuccess: []string{"echo $STACKSHOT_RESULT $STACKSHOT_STACK_STATUS", "printf $STACKSHOT_OUTPUT_ApiUrl"},
+				PostFailure: []string{"echo not run"},
+			},
+			updated: true,
+			output: []string{
+				"[us-east-1] [PreSync] PreSync mystack us-east-1",
+				"[us-east-1] [PostSuccess] succeeded UPDATE_COMPLETE",
+				"[us-east-1] [PostSuccess] https://api.example.com",
+			},
+		},
+		{
+			name:        "A failing PreSync hook aborts the sync",
+			hooks:       Hooks{PreSync: []string{"echo draining; exit 3", "echo not run"}},
+			shouldError: "PreSync hook `echo draining; exit 3` failed: exit status 3",
+			output:      []string{"[us-east-1] [PreSync] draining"},
+		},
+		{
+			name:        "A failing PostSuccess hook fails the sync",
+			hooks:       Hooks{PostSuccess: []string{"echo smoke tests failed >&2; false"}},
+			shouldError: "PostSuccess hook `echo smoke tests failed >&2; false` failed: exit status 1",
+			updated:     true,
+			output:      []string{"[us-east-1] [PostSuccess] smoke tests failed"},
+		},
+		{
+			name:        "PostSuccess hooks run without updates to perform",
+			hooks:       Hooks{PostSuccess: []string{"echo $STACKSHOT_RESULT"}},
+			updateErr:   awserr.New("ValidationError", "No updates are to be performed.", nil),
+			shouldError: "ValidationError: No updates are to be performed.",
+			updated:     true,
+			output:      []string{"[us-east-1] [PostSuccess] unchanged"},
+		},
+		{
+			name:        "PostFailure hooks run when the sync fails",
+			hooks:       Hooks{PostFailure: []string{"echo $STACKSHOT_RESULT: $STACKSHOT_ERROR", "exit 1"}},
+			updateErr:   errors.New("access denied"),
+			shouldError: "failed to update stack: : access denied",
+			updated:     true,
+			output: []string{
+				"[us-east-1] [PostFailure] failed: failed to update stack: : access denied",
+				"[us-east-1] [PostFailure] PostFailure hook `exit 1` failed: exit status 1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			updated := false
+			api := &MockAPI{}
+			api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+			api.DescribeStacksFn = GenDescribeStacksFn(deployed)
+			api.UpdateStackFn = func(*cfn.UpdateStackInput) (*cfn.UpdateStackOutput, error) {
+				updated = true
+				return &cfn.UpdateStackOutput{}, test.updateErr
+			}
+
+			out := &bytes.Buffer{}
+			stack := &Stack{
+				api: api,
+				config: &StackConfig{
+					Name:        "mystack",
+					Region:      "us-east-1",
+					TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+					Hooks:       test.hooks,
+				},
+				cloudStack:   deployed,
+				eventLoader:  &stubEventLoader{},
+				waiter:       &impatientWaiter{},
+				waitAttempts: 3,
+			}
+			WithHookOutput(out, "[us-east-1] ")(stack)
+
+			err := stack.SyncAndPollEvents(EventConsumerFunc(func(*cfn.StackEvent) error { return nil }))
+			if !equalErrors(err, stringError(test.shouldError)) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if updated != test.updated {
+				t.Errorf("Expected updated to be %t", test.updated)
+			}
+
+			output := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if !cmp.Equal(output, test.output) {
+				t.Errorf("Unexpected hook output: %s", cmp.Diff(test.output, output))
+			}
+		})
+	}
+}
+
+// stringError returns an error with message, or nil when message is empty.
+func stringError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
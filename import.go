@@ -0,0 +1,227 @@
+package stackshot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// ResourceToImport identifies an existing resource to bring under a stack's
+// management. LogicalResourceId must match a resource in the stack's
+// template, and ResourceIdentifier holds the properties that identify the
+// resource, e.g. {BucketName: my-bucket} for an AWS::S3::Bucket.
+type ResourceToImport struct {
+	LogicalResourceId  string
+	ResourceType       string
+	ResourceIdentifier map[string]string
+}
+
+// NewImportFromYAML parses a YAML document listing the resources to import:
+//
+//	ResourcesToImport:
+//	- LogicalResourceId: Bucket
+//	  ResourceType: AWS::S3::Bucket
+//	  ResourceIdentifier:
+//	    BucketName: my-bucket
+func NewImportFromYAML(doc []byte) ([]*ResourceToImport, error) {
+	d := struct{ ResourcesToImport []*ResourceToImport }{}
+	if err := yaml.Unmarshal(doc, &d); err != nil {
+		return nil, errors.Wrap(err, "failed to parse YAML")
+	}
+
+	if len(d.ResourcesToImport) == 0 {
+		return nil, fmt.Errorf("Missing fields from document: resources_to_import")
+	}
+
+	for i, resource := range d.ResourcesToImport {
+		if resource.LogicalResourceId == "" || resource.ResourceType == "" || len(resource.ResourceIdentifier) == 0 {
+			return nil, fmt.Errorf(
+				"resources_to_import #%d requires logical_resource_id, resource_type, and resource_identifier",
+				i+1,
+			)
+		}
+	}
+	return d.ResourcesToImport, nil
+}
+
+// ImportChangeSet is an IMPORT change set created by Stack.PlanImport(). Its
+// Changes describe the resources the change set imports. Nothing changes
+// until ExecuteAndPollEvents() is called.
+type ImportChangeSet struct {
+	stack *Stack
+	id    *string
+
+	Changes []*cloudformation.ResourceChange
+}
+
+// PlanImport creates an IMPORT change set that brings resources under the
+// stack's management using the StackConfig's template and parameters. The
+// template must declare every imported resource with a DeletionPolicy. When
+// the stack doesn't exist, executing the change set creates it from the
+// imported resources.
+//
+// PlanImport waits until Cloudformation finishes creating the change set.
+func (s *Stack) PlanImport(resources []*ResourceToImport) (*ImportChangeSet, error) {
+	if s.config.UsePreviousTemplate {
+		return nil, errors.New("UsePreviousTemplate cannot be used to import resources")
+	}
+
+	input := cloudformation.CreateChangeSetInput{
+		StackName:     aws.String(s.config.Name),
+		ChangeSetName: aws.String(importChangeSetName()),
+		ChangeSetType: aws.String(cloudformation.ChangeSetTypeImport),
+	}
+
+	var err error
+	input.TemplateBody, input.TemplateURL, err = s.template()
+	if err != nil {
+		return nil, err
+	}
+
+	input.Parameters, err = s.parameters(s.cloudStack == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.config.Capabilities) > 0 {
+		input.Capabilities = aws.StringSlice(s.config.Capabilities)
+	}
+
+	for _, resource := range resources {
+		input.ResourcesToImport = append(
+			input.ResourcesToImport,
+			&cloudformation.ResourceToImport{
+				LogicalResourceId:  aws.String(resource.LogicalResourceId),
+				ResourceType:       aws.String(resource.ResourceType),
+				ResourceIdentifier: aws.StringMap(resource.ResourceIdentifier),
+			},
+		)
+	}
+
+	out, err := s.api.CreateChangeSet(&input)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create import change set")
+	}
+
+	changeSet := &ImportChangeSet{stack: s, id: out.Id}
+	if err := changeSet.waitUntilCreated(); err != nil {
+		return nil, err
+	}
+	return changeSet, nil
+}
+
+// importChangeSetName names a new import change set. Names carry a random
+// suffix so imports planned for a stack within the same second don't collide.
+func importChangeSetName() string {
+	suffix := strings.TrimPrefix(newClientRequestToken(), "stackshot-")
+	if len(suffix) > 8 {
+		suffix = suffix[:8]
+	}
+	return "stackshot-import-" + time.Now().UTC().Format("20060102150405") + "-" + suffix
+}
+
+// waitUntilCreated polls the change set until Cloudformation finishes
+// creating it and then loads its changes.
+func (c *ImportChangeSet) waitUntilCreated() error {
+	s := c.stack
+
+	var out *cloudformation.DescribeChangeSetOutput
+	var attempts int
+	for attempts = 0; attempts < s.waitAttempts; attempts++ {
+		var err error
+		out, err = s.api.DescribeChangeSet(
+			&cloudformation.DescribeChangeSetInput{ChangeSetName: c.id},
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to describe import change set")
+		}
+
+		status := aws.StringValue(out.Status)
+		if status == cloudformation.ChangeSetStatusCreateComplete {
+			break
+		}
+		if status == cloudformation.ChangeSetStatusFailed {
+			return fmt.Errorf("failed to create import change set: %s", aws.StringValue(out.StatusReason))
+		}
+
+		if attempts != s.waitAttempts-1 {
+			s.waiter.wait()
+		}
+	}
+
+	if attempts == s.waitAttempts {
+		return errors.New(
+			"Change set failed to create in time. Check your stack's change sets in cloudformation.",
+		)
+	}
+
+	for {
+		for _, change := range out.Changes {
+			c.Changes = append(c.Changes, change.ResourceChange)
+		}
+		if out.NextToken == nil {
+			return nil
+		}
+
+		var err error
+		out, err = s.api.DescribeChangeSet(
+			&cloudformation.DescribeChangeSetInput{ChangeSetName: c.id, NextToken: out.NextToken},
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to describe import change set")
+		}
+	}
+}
+
+// ExecuteAndPollEvents executes the change set and then polls for StackEvents
+// to pass to consumer until the import completes.
+func (c *ImportChangeSet) ExecuteAndPollEvents(consumer EventConsumer) error {
+	err := c.stack.startOperation(func(token *string) error {
+		_, err := c.stack.api.ExecuteChangeSet(
+			&cloudformation.ExecuteChangeSetInput{
+				ChangeSetName:      c.id,
+				ClientRequestToken: token,
+			},
+		)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to execute import change set")
+	}
+
+	if err := c.waitUntilExecuting(); err != nil {
+		return err
+	}
+	return c.stack.waitUntilDone(consumer)
+}
+
+// waitUntilExecuting polls the change set until Cloudformation starts
+// executing it. Until then the stack keeps the status it had before the
+// import, which would end polling for its events straight away.
+func (c *ImportChangeSet) waitUntilExecuting() error {
+	s := c.stack
+	for attempts := 0; attempts < s.waitAttempts; attempts++ {
+		out, err := s.api.DescribeChangeSet(
+			&cloudformation.DescribeChangeSetInput{ChangeSetName: c.id},
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to describe import change set")
+		}
+		if aws.StringValue(out.ExecutionStatus) != cloudformation.ExecutionStatusAvailable {
+			return nil
+		}
+
+		if attempts != s.waitAttempts-1 {
+			s.waiter.wait()
+		}
+	}
+
+	return errors.New(
+		"Change set failed to start executing in time. Check your stack's change sets in cloudformation.",
+	)
+}
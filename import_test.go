@@ -0,0 +1,223 @@
+package stackshot
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestNewImportFromYAML(t *testing.T) {
+	tests := []struct {
+		doc string
+		out []*ResourceToImport
+		err error
+	}{
+		{
+			doc: `---
+ResourcesToImport:
+- LogicalResourceId: Bucket
+  ResourceType: AWS::S3::Bucket
+  ResourceIdentifier:
+    BucketName: my-bucket
+- LogicalResourceId: Table
+  ResourceType: AWS::DynamoDB::Table
+  ResourceIdentifier:
+    TableName: my-table`,
+			out: []*ResourceToImport{
+				{
+					LogicalResourceId:  "Bucket",
+					ResourceType:       "AWS::S3::Bucket",
+					ResourceIdentifier: map[string]string{"BucketName": "my-bucket"},
+				},
+				{
+					LogicalResourceId:  "Table",
+					ResourceType:       "AWS::DynamoDB::Table",
+					ResourceIdentifier: map[string]string{"TableName": "my-table"},
+				},
+			},
+		},
+		{
+			doc: `---
+ResourcesToImport: []`,
+			err: errors.New("Missing fields from document: resources_to_import"),
+		},
+		{
+			doc: `---
+ResourcesToImport:
+- LogicalResourceId: Bucket
+  ResourceType: AWS::S3::Bucket`,
+			err: errors.New("resources_to_import #1 requires logical_resource_id, resource_type, and resource_identifier"),
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("#%d", i), func(t *testing.T) {
+			resources, err := NewImportFromYAML([]byte(test.doc))
+			if !equalErrors(err, test.err) {
+				t.Fatalf("Expected error: %v, got: %v", test.err, err)
+			}
+			if !cmp.Equal(resources, test.out) {
+				t.Errorf("Unexpected resources: %s", cmp.Diff(test.out, resources))
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	config := &StackConfig{
+		Name:         "mystack",
+		TemplateBody: "Resources:\n  Bucket:\n    Type: AWS::S3::Bucket\n    DeletionPolicy: Retain\n",
+		Parameters:   map[string]ParameterValue{"Env": {Value: "production"}},
+	}
+	resources := []*ResourceToImport{
+		{
+			LogicalResourceId:  "Bucket",
+			ResourceType:       "AWS::S3::Bucket",
+			ResourceIdentifier: map[string]string{"BucketName": "my-bucket"},
+		},
+	}
+	bucketChange := &cfn.ResourceChange{
+		Action:             aws.String("Import"),
+		LogicalResourceId:  aws.String("Bucket"),
+		PhysicalResourceId: aws.String("my-bucket"),
+		ResourceType:       aws.String("AWS::S3::Bucket"),
+	}
+
+	changeSetName := regexp.MustCompile(`^stackshot-import-[0-9]{14}-[0-9a-f]{8}$`)
+
+	newAPI := func(changeSetStatuses ...string) (*MockAPI, *[]string) {
+		calls := []string{}
+		api := &MockAPI{}
+		api.DescribeStacksFn = GenErrorDescribeStacksFn(
+			awserr.New("ValidationError", fmt.Sprintf(stackDoesNotExistErrorFmt, config.Name), nil),
+		)
+		api.CreateChangeSetFn = func(input *cfn.CreateChangeSetInput) (*cfn.CreateChangeSetOutput, error) {
+			calls = append(calls, "CreateChangeSet")
+
+			if !changeSetName.MatchString(aws.StringValue(input.ChangeSetName)) {
+				t.Errorf("Unexpected change set name: %s", aws.StringValue(input.ChangeSetName))
+			}
+
+			if aws.StringValue(input.ChangeSetType) != "IMPORT" {
+				t.Errorf("Expected an IMPORT change set, got: %s", aws.StringValue(input.ChangeSetType))
+			}
+			if aws.StringValue(input.TemplateBody) != string(config.TemplateBody) {
+				t.Errorf("Unexpected template body: %s", aws.StringValue(input.TemplateBody))
+			}
+			expected := []*cfn.ResourceToImport{
+				{
+					LogicalResourceId:  aws.String("Bucket"),
+					ResourceType:       aws.String("AWS::S3::Bucket"),
+					ResourceIdentifier: map[string]*string{"BucketName": aws.String("my-bucket")},
+				},
+			}
+			if !cmp.Equal(input.ResourcesToImport, expected) {
+				t.Errorf("Unexpected resources to import: %s", cmp.Diff(expected, input.ResourcesToImport))
+			}
+			return &cfn.CreateChangeSetOutput{Id: aws.String("changeset-001")}, nil
+		}
+
+		describes, executing := 0, false
+		executionStatuses := []string{"AVAILABLE", "EXECUTE_IN_PROGRESS"}
+		api.DescribeChangeSetFn = func(input *cfn.DescribeChangeSetInput) (*cfn.DescribeChangeSetOutput, error) {
+			if executing {
+				calls = append(calls, "DescribeChangeSet "+executionStatuses[0])
+				out := &cfn.DescribeChangeSetOutput{ExecutionStatus: aws.String(executionStatuses[0])}
+				executionStatuses = executionStatuses[1:]
+				return out, nil
+			}
+
+			status := changeSetStatuses[describes]
+			describes++
+
+			out := &cfn.DescribeChangeSetOutput{Status: aws.String(status)}
+			if status == "FAILED" {
+				out.StatusReason = aws.String("Bucket must have a DeletionPolicy")
+			}
+			if status == "CREATE_COMPLETE" {
+				out.Changes = []*cfn.Change{{ResourceChange: bucketChange}}
+			}
+			return out, nil
+		}
+		api.ExecuteChangeSetFn = func(input *cfn.ExecuteChangeSetInput) (*cfn.ExecuteChangeSetOutput, error) {
+			calls = append(calls, "ExecuteChangeSet "+aws.StringValue(input.ChangeSetName))
+			executing = true
+
+			api.DescribeStacksFn = GenDescribeStacksFn(
+				&cfn.Stack{
+					StackId:     aws.String("stack-001"),
+					StackName:   aws.String(config.Name),
+					StackStatus: aws.String("IMPORT_COMPLETE"),
+				},
+			)
+			return &cfn.ExecuteChangeSetOutput{}, nil
+		}
+		return api, &calls
+	}
+
+	t.Run("plans and executes the import", func(t *testing.T) {
+		api, calls := newAPI("CREATE_PENDING", "CREATE_IN_PROGRESS", "CREATE_COMPLETE")
+
+		stack, err := LoadStack(api, config)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		stack.waiter = &impatientWaiter{}
+		stack.eventLoader = &stubEventLoader{}
+
+		changeSet, err := stack.PlanImport(resources)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if !cmp.Equal(changeSet.Changes, []*cfn.ResourceChange{bucketChange}) {
+			t.Errorf("Unexpected changes: %v", changeSet.Changes)
+		}
+
+		events := 0
+		err = changeSet.ExecuteAndPollEvents(EventConsumerFunc(func(*cfn.StackEvent) error {
+			events++
+			return nil
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if events == 0 {
+			t.Errorf("Expected events to be consumed")
+		}
+
+		expected := []string{
+			"CreateChangeSet",
+			"ExecuteChangeSet changeset-001",
+			"DescribeChangeSet AVAILABLE",
+			"DescribeChangeSet EXECUTE_IN_PROGRESS",
+		}
+		if !cmp.Equal(*calls, expected) {
+			t.Errorf("Unexpected calls: %s", cmp.Diff(expected, *calls))
+		}
+	})
+
+	t.Run("failed change set", func(t *testing.T) {
+		api, calls := newAPI("CREATE_PENDING", "FAILED")
+
+		stack, err := LoadStack(api, config)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		stack.waiter = &impatientWaiter{}
+
+		_, err = stack.PlanImport(resources)
+		expected := errors.New("failed to create import change set: Bucket must have a DeletionPolicy")
+		if !equalErrors(err, expected) {
+			t.Errorf("Expected error: %v, got: %v", expected, err)
+		}
+		if len(*calls) != 1 {
+			t.Errorf("Expected the change set not to be executed, got calls: %v", *calls)
+		}
+	})
+}
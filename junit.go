@@ -0,0 +1,109 @@
+package stackshot
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// junitTestSuites is the root of a JUnit XML report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes summaries as a JUnit XML report so CI dashboards show
+// deployments next to tests. Every stack is a test case named after the
+// stack, suffixed with @<region> when it has a Region, and timed by its sync.
+// Stacks without updates to perform are skipped, and failed stacks fail with
+// their FailureReasons.
+//
+// elapsed is the run's wall clock time, which is less than the sum of its
+// stacks' durations when stacks sync concurrently.
+func WriteJUnit(w io.Writer, summaries []*StackSummary, elapsed time.Duration) error {
+	suite := junitTestSuite{Name: "stackshot", Tests: len(summaries), Time: junitSeconds(elapsed)}
+	for _, s := range summaries {
+		name := s.Name
+		if s.Region != "" {
+			name += "@" + s.Region
+		}
+		testCase := junitTestCase{Name: name, ClassName: s.File, Time: junitSeconds(s.Duration)}
+
+		switch s.Result {
+		case SyncUnchanged:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{Message: "No updates to be applied"}
+		case SyncFailed:
+			suite.Failures++
+			message := s.Error
+			if len(s.FailureReasons) > 0 {
+				message = s.FailureReasons[0]
+			}
+			body := append(append([]string{}, s.FailureReasons...), s.Error)
+			testCase.Failure = &junitFailure{
+				Message: message,
+				Type:    "SyncFailed",
+				Body:    strings.Join(body, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	report := junitTestSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
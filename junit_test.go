@@ -0,0 +1,52 @@
+package stackshot
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	summaries := []*StackSummary{
+		{Name: "api", Region: "us-east-1", File: "stacks/api.yaml", Result: SyncSucceeded, Duration: 92*time.Second + 400*time.Millisecond},
+		{Name: "web", File: "stacks/web.yaml", Result: SyncUnchanged, Duration: 2 * time.Second},
+		{
+			Name:     "db",
+			File:     "stacks/db.yaml",
+			Result:   SyncFailed,
+			Duration: 30 * time.Second,
+			Error:    "stacked failed to complete. status: ROLLBACK_COMPLETE",
+			FailureReasons: []string{
+				"Assets (AWS::S3::Bucket) CREATE_FAILED: Bucket <assets> already exists",
+			},
+		},
+		{Name: "queue", File: "stacks/queue.yaml", Result: SyncFailed, Error: "access denied"},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteJUnit(buf, summaries, 100*time.Second); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="stackshot" tests="4" failures="2" skipped="1" time="100.000">
+  <testsuite name="stackshot" tests="4" failures="2" skipped="1" time="100.000">
+    <testcase name="api@us-east-1" classname="stacks/api.yaml" time="92.400"></testcase>
+    <testcase name="web" classname="stacks/web.yaml" time="2.000">
+      <skipped message="No updates to be applied"></skipped>
+    </testcase>
+    <testcase name="db" classname="stacks/db.yaml" time="30.000">
+      <failure message="Assets (AWS::S3::Bucket) CREATE_FAILED: Bucket &lt;assets&gt; already exists" type="SyncFailed">Assets (AWS::S3::Bucket) CREATE_FAILED: Bucket &lt;assets&gt; already exists&#xA;stacked failed to complete. status: ROLLBACK_COMPLETE</failure>
+    </testcase>
+    <testcase name="queue" classname="stacks/queue.yaml" time="0.000">
+      <failure message="access denied" type="SyncFailed">access denied</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected report: %s", cmp.Diff(expected, buf.String()))
+	}
+}
@@ -0,0 +1,372 @@
+// Package lint checks Cloudformation templates for structural problems
+// without calling any AWS APIs.
+//
+// Lint catches mistakes that would otherwise only surface once Cloudformation
+// rejects a template: references to parameters or resources that don't exist,
+// circular dependencies between resources, invalid Fn::Sub variables, and
+// templates too large for Cloudformation to accept.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity denotes whether a Problem prevents a template from deploying.
+type Severity string
+
+const (
+	// Error problems cause Cloudformation to reject the template.
+	Error Severity = "error"
+
+	// Warning problems are likely mistakes that don't prevent deploying.
+	Warning Severity = "warning"
+)
+
+// Rule names reported in Problem.Rule.
+const (
+	RuleParse               = "parse"
+	RuleTemplateSize        = "template-size"
+	RuleUnresolvedRef       = "unresolved-ref"
+	RuleUnresolvedGetAtt    = "unresolved-getatt"
+	RuleUnresolvedDependsOn = "unresolved-depends-on"
+	RuleInvalidSubVariable  = "invalid-sub-variable"
+	RuleOutputReference     = "output-missing-resource"
+	RuleUnusedParameter     = "unused-parameter"
+	RuleCircularDependency  = "circular-dependency"
+)
+
+const (
+	// maxBodySize is the largest template Cloudformation accepts inline.
+	maxBodySize = 51200
+
+	// maxS3Size is the largest template Cloudformation accepts from S3.
+	maxS3Size = 1000000
+)
+
+// Problem is a single issue found in a template.
+type Problem struct {
+	// File is the file the template was read from. Lint leaves it empty for
+	// callers to fill in.
+	File string `json:"file,omitempty"`
+
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+
+	// Path is the dot-separated location of the problem within the
+	// template, e.g. Resources.Bucket.Properties.BucketName.
+	Path string `json:"path,omitempty"`
+
+	// Line is the 1-based line of the problem within the template, or 0 when
+	// the problem applies to the whole template.
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	location := p.File
+	switch {
+	case location != "" && p.Line > 0:
+		location = fmt.Sprintf("%s:%d: ", location, p.Line)
+	case location != "":
+		location += ": "
+	case p.Line > 0:
+		location = fmt.Sprintf("line %d: ", p.Line)
+	}
+	return fmt.Sprintf("%s%s %s: %s", location, p.Severity, p.Rule, p.Message)
+}
+
+// HasErrors reports whether any of problems has the Error severity.
+func HasErrors(problems []Problem) bool {
+	for _, p := range problems {
+		if p.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// pseudoParameters are the parameters Cloudformation predefines for every
+// template.
+var pseudoParameters = map[string]bool{
+	"AWS::AccountId":        true,
+	"AWS::NotificationARNs": true,
+	"AWS::NoValue":          true,
+	"AWS::Partition":        true,
+	"AWS::Region":           true,
+	"AWS::StackId":          true,
+	"AWS::StackName":        true,
+	"AWS::URLSuffix":        true,
+}
+
+// Lint parses a JSON or YAML template and returns every problem found, sorted
+// by line. A template that fails to parse is reported as a single RuleParse
+// problem.
+//
+// Templates declaring a Transform, such as AWS SAM templates, skip the
+// reference checks since the transform creates resources that aren't in the
+// template.
+func Lint(body []byte) []Problem {
+	l := linter{}
+
+	if len(body) > maxS3Size {
+		l.report(Error, RuleTemplateSize, "", 0, "template is %d bytes which exceeds Cloudformation's %d byte limit", len(body), maxS3Size)
+	} else if len(body) > maxBodySize {
+		l.report(Warning, RuleTemplateSize, "", 0, "template is %d bytes which exceeds the %d byte inline limit. Set TemplateBucket to upload it to S3", len(body), maxBodySize)
+	}
+
+	doc := yaml.Node{}
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		l.report(Error, RuleParse, "", 0, "failed to parse template: %s", err)
+		return l.problems
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		l.report(Error, RuleParse, "", 0, "template is not a mapping")
+		return l.problems
+	}
+
+	l.lint(doc.Content[0])
+
+	sort.SliceStable(l.problems, func(i, j int) bool {
+		return l.problems[i].Line < l.problems[j].Line
+	})
+	return l.problems
+}
+
+// linter holds the state of linting a single template. parameters and
+// resources map names to their key nodes in the template.
+type linter struct {
+	parameters map[string]*yaml.Node
+	resources  map[string]*yaml.Node
+	used       map[string]bool
+	problems   []Problem
+}
+
+func (l *linter) report(severity Severity, rule, path string, line int, format string, args ...interface{}) {
+	l.problems = append(l.problems, Problem{
+		Rule:     rule,
+		Severity: severity,
+		Path:     path,
+		Line:     line,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lint(root *yaml.Node) {
+	l.parameters = map[string]*yaml.Node{}
+	l.resources = map[string]*yaml.Node{}
+	l.used = map[string]bool{}
+
+	entries(value(root, "Parameters"), func(name string, key, _ *yaml.Node) {
+		l.parameters[name] = key
+	})
+	entries(value(root, "Resources"), func(name string, key, _ *yaml.Node) {
+		l.resources[name] = key
+	})
+
+	checkReferences := value(root, "Transform") == nil
+	dependencies := map[string][]string{}
+
+	entries(root, func(section string, _, node *yaml.Node) {
+		if section == "Parameters" {
+			return
+		}
+
+		if section != "Resources" {
+			visitReferences(node, section, func(ref reference) {
+				l.resolve(ref, section, checkReferences)
+			})
+			return
+		}
+
+		entries(node, func(name string, _, resource *yaml.Node) {
+			path := "Resources." + name
+			deps := []string{}
+			visitReferences(resource, path, func(ref reference) {
+				l.resolve(ref, section, checkReferences)
+				if _, ok := l.resources[ref.target]; ok {
+					deps = append(deps, ref.target)
+				}
+			})
+
+			dependsOn := value(resource, "DependsOn")
+			for _, target := range scalars(dependsOn) {
+				if _, ok := l.resources[target.Value]; ok {
+					deps = append(deps, target.Value)
+				} else if checkReferences {
+					l.report(Error, RuleUnresolvedDependsOn, path+".DependsOn", target.Line, "DependsOn references missing resource %s", target.Value)
+				}
+			}
+			dependencies[name] = deps
+		})
+	})
+
+	names := make([]string, 0, len(l.parameters))
+	for name := range l.parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !l.used[name] {
+			l.report(Warning, RuleUnusedParameter, "Parameters."+name, l.parameters[name].Line, "parameter %s is never referenced", name)
+		}
+	}
+
+	for _, cycle := range findCycles(dependencies) {
+		l.report(
+			Error,
+			RuleCircularDependency,
+			"Resources."+cycle[0],
+			l.resources[cycle[0]].Line,
+			"circular dependency between resources: %s",
+			strings.Join(append(cycle, cycle[0]), " -> "),
+		)
+	}
+}
+
+// resolve marks the parameter a reference uses and reports references to
+// targets that don't exist.
+func (l *linter) resolve(ref reference, section string, checkReferences bool) {
+	if _, ok := l.parameters[ref.target]; ok && ref.attribute == "" {
+		l.used[ref.target] = true
+		return
+	}
+	if !checkReferences {
+		return
+	}
+	if _, ok := l.resources[ref.target]; ok {
+		return
+	}
+	if pseudoParameters[ref.target] && ref.attribute == "" {
+		return
+	}
+
+	rule := map[string]string{
+		"Ref":        RuleUnresolvedRef,
+		"Fn::GetAtt": RuleUnresolvedGetAtt,
+		"Fn::Sub":    RuleInvalidSubVariable,
+	}[ref.function]
+	if section == "Outputs" {
+		rule = RuleOutputReference
+	}
+
+	switch ref.function {
+	case "Fn::GetAtt":
+		l.report(Error, rule, ref.path, ref.line, "Fn::GetAtt references missing resource %s", ref.target)
+	case "Fn::Sub":
+		l.report(Error, rule, ref.path, ref.line, "Fn::Sub variable ${%s} does not match a parameter, resource, or variable", ref.variable)
+	default:
+		l.report(Error, rule, ref.path, ref.line, "Ref references missing parameter or resource %s", ref.target)
+	}
+}
+
+// findCycles returns every cycle in a resource dependency graph. Each cycle
+// is reported once, starting from its alphabetically first resource.
+func findCycles(dependencies map[string][]string) [][]string {
+	names := make([]string, 0, len(dependencies))
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	stack := []string{}
+	seen := map[string]bool{}
+	cycles := [][]string{}
+
+	var visit func(string)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+
+		deps := append([]string{}, dependencies[name]...)
+		sort.Strings(deps)
+		for _, dep := range deps {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				start := 0
+				for stack[start] != dep {
+					start++
+				}
+				cycle := rotate(append([]string{}, stack[start:]...))
+				key := strings.Join(cycle, ",")
+				if !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, cycle)
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+
+	for _, name := range names {
+		if state[name] == unvisited {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+// rotate reorders a cycle to start with its alphabetically first element.
+func rotate(cycle []string) []string {
+	first := 0
+	for i := range cycle {
+		if cycle[i] < cycle[first] {
+			first = i
+		}
+	}
+	return append(cycle[first:], cycle[:first]...)
+}
+
+// value returns the value for key in a mapping node or nil.
+func value(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// entries calls fn for every key/value pair of a mapping node.
+func entries(node *yaml.Node, fn func(name string, key, value *yaml.Node)) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i].Value, node.Content[i], node.Content[i+1])
+	}
+}
+
+// scalars returns node when it's a scalar or the scalar items of node when
+// it's a sequence.
+func scalars(node *yaml.Node) []*yaml.Node {
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.ScalarNode {
+		return []*yaml.Node{node}
+	}
+	items := []*yaml.Node{}
+	for _, item := range node.Content {
+		if item.Kind == yaml.ScalarNode {
+			items = append(items, item)
+		}
+	}
+	return items
+}
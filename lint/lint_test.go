@@ -0,0 +1,168 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func rules(problems []Problem) []string {
+	names := []string{}
+	for _, p := range problems {
+		names = append(names, p.Rule)
+	}
+	return names
+}
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		rules    []string
+	}{
+		{
+			name: "Valid template",
+			template: `
+Parameters:
+  Environment:
+    Type: String
+  Suffix:
+    Type: String
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub "${AWS::StackName}-${Environment}"
+      Tags:
+        - Key: suffix
+          Value: !Sub ["${Prefix}-${Suffix}", {Prefix: !Ref "AWS::Region"}]
+  Policy:
+    Type: AWS::S3::BucketPolicy
+    DependsOn: Bucket
+    Properties:
+      Bucket: {"Ref": "Bucket"}
+      PolicyDocument:
+        Resource: !Sub "${Bucket.Arn}/${!Literal}"
+Outputs:
+  Arn:
+    Value: !GetAtt Bucket.Arn
+`,
+			rules: []string{},
+		},
+		{
+			name: "Unresolved references",
+			template: `
+Parameters:
+  Unused:
+    Type: String
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    DependsOn: [Missing]
+    Properties:
+      BucketName: !Ref BucketNam
+      Arn: {"Fn::GetAtt": ["Other", "Arn"]}
+      Name: !Sub "${Nope}-${Other.Name}"
+Outputs:
+  Arn:
+    Value: !GetAtt Gone.Arn
+`,
+			rules: []string{
+				RuleUnusedParameter,
+				RuleUnresolvedDependsOn,
+				RuleUnresolvedRef,
+				RuleUnresolvedGetAtt,
+				RuleInvalidSubVariable,
+				RuleInvalidSubVariable,
+				RuleOutputReference,
+			},
+		},
+		{
+			name: "Circular dependencies",
+			template: `
+Resources:
+  A:
+    Type: AWS::SNS::Topic
+    DependsOn: C
+  B:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !GetAtt A.TopicName
+  C:
+    Type: AWS::SNS::Topic
+    Properties:
+      TopicName: !Ref B
+`,
+			rules: []string{RuleCircularDependency},
+		},
+		{
+			name: "Transforms skip reference checks",
+			template: `
+Transform: AWS::Serverless-2016-10-31
+Resources:
+  Function:
+    Type: AWS::Serverless::Function
+    Properties:
+      Role: !GetAtt FunctionRole.Arn
+`,
+			rules: []string{},
+		},
+		{
+			name:     "Parse errors",
+			template: "Resources: [",
+			rules:    []string{RuleParse},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.name,
+			func(t *testing.T) {
+				problems := Lint([]byte(test.template))
+				if !cmp.Equal(rules(problems), test.rules) {
+					t.Errorf("Expected rules: %v\nGot: %v", test.rules, problems)
+				}
+			},
+		)
+	}
+}
+
+func TestCircularDependencyMessage(t *testing.T) {
+	problems := Lint([]byte(`
+Resources:
+  B:
+    Type: AWS::SNS::Topic
+    DependsOn: A
+  A:
+    Type: AWS::SNS::Topic
+    DependsOn: B
+`))
+	if len(problems) != 1 {
+		t.Fatalf("Expected 1 problem. Got: %v", problems)
+	}
+
+	expected := Problem{
+		Rule:     RuleCircularDependency,
+		Severity: Error,
+		Path:     "Resources.A",
+		Line:     6,
+		Message:  "circular dependency between resources: A -> B -> A",
+	}
+	if !cmp.Equal(problems[0], expected) {
+		t.Errorf("Expected:\n%+v\nGot:\n%+v", expected, problems[0])
+	}
+}
+
+func TestTemplateSize(t *testing.T) {
+	template := "Resources: {}\n#" + strings.Repeat("x", maxBodySize)
+	problems := Lint([]byte(template))
+	if len(problems) != 1 || problems[0].Severity != Warning {
+		t.Errorf("Expected a template-size warning. Got: %v", problems)
+	}
+
+	template = "Resources: {}\n#" + strings.Repeat("x", maxS3Size)
+	if !HasErrors(Lint([]byte(template))) {
+		t.Errorf("Expected a template-size error")
+	}
+}
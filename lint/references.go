@@ -0,0 +1,156 @@
+package lint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reference is a use of Ref, Fn::GetAtt, or an Fn::Sub variable.
+type reference struct {
+	// function is Ref, Fn::GetAtt, or Fn::Sub.
+	function string
+
+	// target is the referenced parameter or resource.
+	target string
+
+	// attribute is the attribute of target used by Fn::GetAtt or a
+	// ${Resource.Attribute} Fn::Sub variable.
+	attribute string
+
+	// variable is the Fn::Sub variable as written in the template.
+	variable string
+
+	path string
+	line int
+}
+
+// subVariable matches ${Variable} within an Fn::Sub string.
+var subVariable = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// visitReferences calls fn for every reference within node, which is located
+// at path within the template. Both the short form (!Ref) and the long form
+// ({"Ref": ...}) of intrinsic functions are recognized.
+func visitReferences(node *yaml.Node, path string, fn func(reference)) {
+	if node == nil {
+		return
+	}
+	if node.Kind == yaml.AliasNode {
+		visitReferences(node.Alias, path, fn)
+		return
+	}
+
+	function, args := intrinsic(node)
+	switch function {
+	case "Ref":
+		if args.Kind == yaml.ScalarNode {
+			fn(reference{function: function, target: args.Value, path: path, line: args.Line})
+			return
+		}
+	case "Fn::GetAtt":
+		visitGetAtt(args, path, fn)
+	case "Fn::Sub":
+		visitSub(args, path, fn)
+		return
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			visitReferences(node.Content[i+1], path+"."+node.Content[i].Value, fn)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			visitReferences(item, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
+
+// intrinsic returns the name and arguments of the intrinsic function node
+// represents, or an empty name when node isn't an intrinsic function. Short
+// form tags are normalized to their long form names.
+func intrinsic(node *yaml.Node) (string, *yaml.Node) {
+	if strings.HasPrefix(node.Tag, "!") && !strings.HasPrefix(node.Tag, "!!") {
+		name := strings.TrimPrefix(node.Tag, "!")
+		if name != "Ref" && name != "Condition" {
+			name = "Fn::" + name
+		}
+		return name, node
+	}
+
+	if node.Kind == yaml.MappingNode && len(node.Content) == 2 {
+		name := node.Content[0].Value
+		if name == "Ref" || strings.HasPrefix(name, "Fn::") {
+			return name, node.Content[1]
+		}
+	}
+	return "", nil
+}
+
+// visitGetAtt reports the resource used by Fn::GetAtt, which is written as
+// either "Resource.Attribute" or [Resource, Attribute].
+func visitGetAtt(args *yaml.Node, path string, fn func(reference)) {
+	var target, attribute *yaml.Node
+	switch args.Kind {
+	case yaml.ScalarNode:
+		target = args
+	case yaml.SequenceNode:
+		if len(args.Content) > 0 {
+			target = args.Content[0]
+		}
+		if len(args.Content) > 1 {
+			attribute = args.Content[1]
+		}
+	}
+	if target == nil || target.Kind != yaml.ScalarNode {
+		return
+	}
+
+	ref := reference{function: "Fn::GetAtt", target: target.Value, path: path, line: target.Line}
+	if attribute != nil {
+		ref.attribute = attribute.Value
+	} else if i := strings.Index(ref.target, "."); i >= 0 {
+		ref.target, ref.attribute = ref.target[:i], ref.target[i+1:]
+	}
+	fn(ref)
+}
+
+// visitSub reports the variables used by Fn::Sub, which is written as either
+// "string" or [string, {Variable: value}]. Variables defined by the
+// variable map and ${!Literal} escapes aren't references.
+func visitSub(args *yaml.Node, path string, fn func(reference)) {
+	str := args
+	locals := map[string]bool{}
+	if args.Kind == yaml.SequenceNode {
+		if len(args.Content) == 0 {
+			return
+		}
+		str = args.Content[0]
+		if len(args.Content) > 1 {
+			variables := args.Content[1]
+			entries(variables, func(name string, _, _ *yaml.Node) {
+				locals[name] = true
+			})
+			visitReferences(variables, path+"[1]", fn)
+		}
+	}
+	if str.Kind != yaml.ScalarNode {
+		visitReferences(str, path, fn)
+		return
+	}
+
+	for _, match := range subVariable.FindAllStringSubmatch(str.Value, -1) {
+		variable := strings.TrimSpace(match[1])
+		if strings.HasPrefix(variable, "!") || locals[variable] {
+			continue
+		}
+
+		ref := reference{function: "Fn::Sub", target: variable, variable: variable, path: path, line: str.Line}
+		if i := strings.Index(variable, "."); i >= 0 {
+			ref.target, ref.attribute = variable[:i], variable[i+1:]
+		}
+		fn(ref)
+	}
+}
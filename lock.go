@@ -0,0 +1,288 @@
+package stackshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
+)
+
+// LockInfo describes who holds a deployment lock.
+type LockInfo struct {
+	Holder    string    `json:"holder"`
+	StartedAt time.Time `json:"started_at"`
+	GitSHA    string    `json:"git_sha,omitempty"`
+}
+
+func (i *LockInfo) String() string {
+	s := fmt.Sprintf("%s since %s", i.Holder, i.StartedAt.Format(time.RFC3339))
+	if i.GitSHA != "" {
+		s += fmt.Sprintf(" (git %s)", i.GitSHA)
+	}
+	return s
+}
+
+// Locker acquires deployment locks so concurrent runs don't sync the same
+// stack at once. Locks are named by LockName().
+type Locker interface {
+	// Lock acquires the lock name for info's holder. It returns a
+	// *LockedError without waiting when someone else holds the lock.
+	Lock(name string, info *LockInfo) error
+
+	// Release releases the lock name only while info's holder still holds
+	// it, so a run whose lock was forcibly removed doesn't release a later
+	// run's lock. Releasing a lock held by someone else, or by nobody, does
+	// nothing.
+	Release(name string, info *LockInfo) error
+
+	// Unlock releases the lock name regardless of who holds it. Unlocking a
+	// lock nobody holds isn't an error.
+	Unlock(name string) error
+}
+
+// LockedError is returned by Locker.Lock() when the lock is already held.
+type LockedError struct {
+	Name string
+
+	// Info describes the lock's current holder. It's nil when the holder
+	// couldn't be read.
+	Info *LockInfo
+}
+
+func (e *LockedError) Error() string {
+	if e.Info == nil {
+		return fmt.Sprintf("%s is locked", e.Name)
+	}
+	return fmt.Sprintf("%s is locked by %s", e.Name, e.Info)
+}
+
+// LockName returns the name of the lock guarding the stack config deploys.
+// Stacks deployed to an explicit Region are locked per region so a rollout's
+// regions don't block each other.
+func LockName(config *StackConfig) string {
+	if config.Region == "" {
+		return config.Name
+	}
+	return config.Name + "@" + config.Region
+}
+
+// WithLocker acquires the stack's lock from locker before syncing and
+// releases it once the stack finishes. info describes this run to anyone
+// blocked by the lock; its StartedAt is set when the lock is acquired.
+func WithLocker(locker Locker, info LockInfo) StackOption {
+	return func(s *Stack) {
+		s.locker = locker
+		s.lockInfo = info
+	}
+}
+
+// lock acquires the stack's lock and returns the function releasing it. It
+// does nothing when the stack has no Locker.
+//
+// The stack is reloaded once locked since the lock's previous holder may have
+// changed it.
+func (s *Stack) lock() (func() error, error) {
+	if s.locker == nil {
+		return func() error { return nil }, nil
+	}
+
+	name := LockName(s.config)
+	info := s.lockInfo
+	info.StartedAt = time.Now().UTC()
+	if err := s.locker.Lock(name, &info); err != nil {
+		return nil, err
+	}
+	unlock := func() error { return s.locker.Release(name, &info) }
+
+	err := s.load()
+	if err == nil {
+		err = s.storeLastEvent()
+	}
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// FileLocker locks stacks with lock files in a directory. It only prevents
+// concurrent runs on the same machine or sharing the directory.
+type FileLocker struct {
+	Dir string
+}
+
+// Lock creates name's lock file. The lock file holds info as JSON.
+func (l *FileLocker) Lock(name string, info *LockInfo) error {
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create lock directory")
+	}
+
+	contents, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		locked := &LockedError{Name: name}
+		if existing, err := ioutil.ReadFile(l.path(name)); err == nil {
+			holder := &LockInfo{}
+			if json.Unmarshal(existing, holder) == nil {
+				locked.Info = holder
+			}
+		}
+		return locked
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock %s", name)
+	}
+
+	_, err = file.Write(contents)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(l.path(name))
+		return errors.Wrapf(err, "failed to lock %s", name)
+	}
+	return nil
+}
+
+// Release removes name's lock file if it still holds info.
+func (l *FileLocker) Release(name string, info *LockInfo) error {
+	contents, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ioutil.ReadFile(l.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to unlock %s", name)
+	}
+	if !bytes.Equal(existing, contents) {
+		return nil
+	}
+	return l.Unlock(name)
+}
+
+// Unlock removes name's lock file.
+func (l *FileLocker) Unlock(name string) error {
+	err := os.Remove(l.path(name))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to unlock %s", name)
+	}
+	return nil
+}
+
+func (l *FileLocker) path(name string) string {
+	return filepath.Join(l.Dir, strings.Replace(name, string(filepath.Separator), "_", -1)+".lock")
+}
+
+// dynamoDBLockKey is the DynamoDB table's partition key attribute.
+const dynamoDBLockKey = "LockID"
+
+// DynamoDBLocker locks stacks with items in a DynamoDB table, which lets runs
+// on different machines share locks. The table's partition key must be a
+// string attribute named LockID.
+type DynamoDBLocker struct {
+	api   dynamodbiface.DynamoDBAPI
+	table string
+}
+
+// NewDynamoDBLocker allocates a DynamoDBLocker storing locks in table.
+func NewDynamoDBLocker(api dynamodbiface.DynamoDBAPI, table string) *DynamoDBLocker {
+	return &DynamoDBLocker{api: api, table: table}
+}
+
+// Lock puts an item for name unless one already exists.
+func (l *DynamoDBLocker) Lock(name string, info *LockInfo) error {
+	item := map[string]*dynamodb.AttributeValue{
+		dynamoDBLockKey: {S: aws.String(name)},
+		"Holder":        {S: aws.String(info.Holder)},
+		"StartedAt":     {S: aws.String(info.StartedAt.Format(time.RFC3339))},
+	}
+	if info.GitSHA != "" {
+		item["GitSHA"] = &dynamodb.AttributeValue{S: aws.String(info.GitSHA)}
+	}
+
+	_, err := l.api.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String(l.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(" + dynamoDBLockKey + ")"),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return &LockedError{Name: name, Info: l.holder(name)}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to lock %s", name)
+	}
+	return nil
+}
+
+// holder reads the LockInfo of name's current holder. It returns nil when the
+// lock can't be read, e.g. because it was just released.
+func (l *DynamoDBLocker) holder(name string) *LockInfo {
+	out, err := l.api.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(l.table),
+		Key:            map[string]*dynamodb.AttributeValue{dynamoDBLockKey: {S: aws.String(name)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || out.Item == nil {
+		return nil
+	}
+
+	attribute := func(key string) string {
+		if value, ok := out.Item[key]; ok {
+			return aws.StringValue(value.S)
+		}
+		return ""
+	}
+	info := &LockInfo{Holder: attribute("Holder"), GitSHA: attribute("GitSHA")}
+	info.StartedAt, _ = time.Parse(time.RFC3339, attribute("StartedAt"))
+	return info
+}
+
+// Release deletes name's item if its Holder and StartedAt still match info.
+func (l *DynamoDBLocker) Release(name string, info *LockInfo) error {
+	_, err := l.api.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:           aws.String(l.table),
+		Key:                 map[string]*dynamodb.AttributeValue{dynamoDBLockKey: {S: aws.String(name)}},
+		ConditionExpression: aws.String("Holder = :holder AND StartedAt = :started_at"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":holder":     {S: aws.String(info.Holder)},
+			":started_at": {S: aws.String(info.StartedAt.Format(time.RFC3339))},
+		},
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to unlock %s", name)
+	}
+	return nil
+}
+
+// Unlock deletes name's item.
+func (l *DynamoDBLocker) Unlock(name string) error {
+	_, err := l.api.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key:       map[string]*dynamodb.AttributeValue{dynamoDBLockKey: {S: aws.String(name)}},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to unlock %s", name)
+	}
+	return nil
+}
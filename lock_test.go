@@ -0,0 +1,205 @@
+package stackshot
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/google/go-cmp/cmp"
+)
+
+// MockDynamoDB implements the dynamodbiface.DynamoDBAPI methods used by
+// DynamoDBLocker with an in memory table.
+type MockDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+
+	Items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (m *MockDynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	key := aws.StringValue(input.Item["LockID"].S)
+	if _, ok := m.Items[key]; ok {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	m.Items[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *MockDynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.Items[aws.StringValue(input.Key["LockID"].S)]}, nil
+}
+
+// DeleteItem only understands Release's Holder and StartedAt condition.
+func (m *MockDynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	key := aws.StringValue(input.Key["LockID"].S)
+	if input.ConditionExpression != nil {
+		item, ok := m.Items[key]
+		values := input.ExpressionAttributeValues
+		if !ok ||
+			aws.StringValue(item["Holder"].S) != aws.StringValue(values[":holder"].S) ||
+			aws.StringValue(item["StartedAt"].S) != aws.StringValue(values[":started_at"].S) {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+		}
+	}
+	delete(m.Items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestLockers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackshot-locks")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	lockers := map[string]Locker{
+		"FileLocker":     &FileLocker{Dir: dir},
+		"DynamoDBLocker": NewDynamoDBLocker(&MockDynamoDB{Items: map[string]map[string]*dynamodb.AttributeValue{}}, "locks"),
+	}
+
+	for name, locker := range lockers {
+		t.Run(name, func(t *testing.T) {
+			first := &LockInfo{
+				Holder:    "ci@runner-1",
+				StartedAt: time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC),
+				GitSHA:    "abc123",
+			}
+			if err := locker.Lock("mystack@us-east-1", first); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			err := locker.Lock("mystack@us-east-1", &LockInfo{Holder: "ci@runner-2"})
+			locked, ok := err.(*LockedError)
+			if !ok {
+				t.Fatalf("Expected a LockedError, got: %v", err)
+			}
+			if !cmp.Equal(locked.Info, first) {
+				t.Errorf("Unexpected lock holder: %s", cmp.Diff(first, locked.Info))
+			}
+			expected := "mystack@us-east-1 is locked by ci@runner-1 since 2020-09-01T12:00:00Z (git abc123)"
+			if locked.Error() != expected {
+				t.Errorf("Unexpected error message: %s", locked.Error())
+			}
+
+			if err := locker.Lock("other", &LockInfo{Holder: "ci@runner-2"}); err != nil {
+				t.Errorf("Expected other locks to be independent, got: %s", err)
+			}
+
+			// Releasing someone else's lock leaves it alone.
+			if err := locker.Release("mystack@us-east-1", &LockInfo{Holder: "ci@runner-2"}); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if err := locker.Lock("mystack@us-east-1", &LockInfo{Holder: "ci@runner-2"}); err == nil {
+				t.Errorf("Expected releasing another holder's lock to keep it")
+			}
+			if err := locker.Release("mystack@us-east-1", first); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+			if err := locker.Lock("mystack@us-east-1", first); err != nil {
+				t.Errorf("Expected the lock to be released, got: %s", err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if err := locker.Unlock("mystack@us-east-1"); err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+			}
+			if err := locker.Lock("mystack@us-east-1", &LockInfo{Holder: "ci@runner-2"}); err != nil {
+				t.Errorf("Expected the lock to be released, got: %s", err)
+			}
+		})
+	}
+}
+
+func TestSyncLocking(t *testing.T) {
+	config := &StackConfig{
+		Name:        "mystack",
+		Region:      "us-east-1",
+		TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+	}
+
+	newStack := func(locker Locker) (*Stack, *int) {
+		updates := 0
+		api := &MockAPI{}
+		api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+		api.DescribeStacksFn = GenDescribeStacksFn(&cfn.Stack{
+			StackId:     aws.String("arn:mystack"),
+			StackName:   aws.String("mystack"),
+			StackStatus: aws.String("UPDATE_COMPLETE"),
+		})
+		api.UpdateStackFn = func(*cfn.UpdateStackInput) (*cfn.UpdateStackOutput, error) {
+			updates++
+			return &cfn.UpdateStackOutput{}, nil
+		}
+
+		stack := &Stack{
+			api:          api,
+			config:       config,
+			eventLoader:  &stubEventLoader{},
+			waiter:       &impatientWaiter{},
+			waitAttempts: 3,
+		}
+		WithLocker(locker, LockInfo{Holder: "me"})(stack)
+		return stack, &updates
+	}
+	consumer := EventConsumerFunc(func(*cfn.StackEvent) error { return nil })
+
+	dir, err := ioutil.TempDir("", "stackshot-locks")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	locker := &FileLocker{Dir: dir}
+
+	stack, updates := newStack(locker)
+	if err := stack.SyncAndPollEvents(consumer); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if *updates != 1 {
+		t.Errorf("Expected the stack to be updated")
+	}
+
+	// The lock was released, so someone else can take it and block the
+	// next sync.
+	if err := locker.Lock(LockName(config), &LockInfo{Holder: "someone else"}); err != nil {
+		t.Fatalf("Expected the lock to be released, got: %s", err)
+	}
+
+	stack, updates = newStack(locker)
+	err = stack.SyncAndPollEvents(consumer)
+	if _, ok := err.(*LockedError); !ok {
+		t.Errorf("Expected a LockedError, got: %v", err)
+	}
+	if *updates != 0 {
+		t.Errorf("Expected a locked stack not to be updated")
+	}
+
+	// A sync whose lock was forcibly removed and taken by another run
+	// doesn't release the other run's lock when it finishes.
+	if err := locker.Unlock(LockName(config)); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	stack, _ = newStack(locker)
+	stack.api.(*MockAPI).UpdateStackFn = func(*cfn.UpdateStackInput) (*cfn.UpdateStackOutput, error) {
+		if err := locker.Unlock(LockName(config)); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if err := locker.Lock(LockName(config), &LockInfo{Holder: "later run"}); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return &cfn.UpdateStackOutput{}, nil
+	}
+	if err := stack.SyncAndPollEvents(consumer); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	err = locker.Lock(LockName(config), &LockInfo{Holder: "someone else"})
+	if locked, ok := err.(*LockedError); !ok || locked.Info.Holder != "later run" {
+		t.Errorf("Expected the later run to keep its lock, got: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package stackshot
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Sync outcomes recorded by the stackshot_syncs_total metric and passed to
+// post hooks in STACKSHOT_RESULT.
+const (
+	SyncSucceeded = "succeeded"
+	SyncFailed    = "failed"
+	SyncUnchanged = "unchanged"
+)
+
+var (
+	deployDurationBuckets = []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+	pollsPerDeployBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200}
+)
+
+// Metrics records deployment metrics and writes them in the Prometheus text
+// exposition format. Give a Stack Metrics with WithMetrics() and set
+// Clients.Metrics to count API calls. Every series is labeled with the region
+// it was recorded in so stacks deployed to several regions are told apart.
+//
+// Metrics implements http.Handler so it can be served as a /metrics endpoint.
+// WriteTextfile() writes the metrics for node_exporter's textfile collector
+// instead.
+//
+// A nil *Metrics records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	syncs          *prometheus.CounterVec
+	deployDuration *prometheus.HistogramVec
+	apiCalls       *prometheus.CounterVec
+	events         *prometheus.CounterVec
+	pollsPerDeploy *prometheus.HistogramVec
+}
+
+// NewMetrics allocates Metrics with every metric at zero.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		syncs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "stackshot_syncs_total",
+				Help: "Stack syncs by action and outcome.",
+			},
+			[]string{"stack", "region", "action", "outcome"},
+		),
+		deployDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "stackshot_deploy_duration_seconds",
+				Help:    "Time from starting a stack sync until the stack finished creating or updating.",
+				Buckets: deployDurationBuckets,
+			},
+			[]string{"stack", "region", "action"},
+		),
+		apiCalls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "stackshot_api_calls_total",
+				Help: "AWS API calls by service, operation, and error code. Successful calls have the code OK.",
+			},
+			[]string{"service", "operation", "region", "code"},
+		),
+		events: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "stackshot_events_processed_total",
+				Help: "Stack events passed to event consumers.",
+			},
+			[]string{"stack", "region"},
+		),
+		pollsPerDeploy: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "stackshot_polls_per_deploy",
+				Help:    "Times a stack was polled while waiting for it to finish.",
+				Buckets: pollsPerDeployBuckets,
+			},
+			[]string{"stack", "region"},
+		),
+	}
+	m.registry.MustRegister(m.syncs, m.deployDuration, m.apiCalls, m.events, m.pollsPerDeploy)
+	return m
+}
+
+// WithMetrics records the stack's syncs, deploy durations, polls, and
+// processed events in metrics.
+func WithMetrics(metrics *Metrics) StackOption {
+	return func(s *Stack) {
+		s.metrics = metrics
+	}
+}
+
+// InstrumentSession counts every API call made with clients built from sess.
+// Sessions copied from sess after it's instrumented are counted too.
+func (m *Metrics) InstrumentSession(sess *session.Session) {
+	if m == nil {
+		return
+	}
+
+	sess.Handlers.Complete.PushBack(func(r *request.Request) {
+		code := "OK"
+		if r.Error != nil {
+			code = "Unknown"
+			if awsErr, ok := r.Error.(awserr.Error); ok {
+				code = awsErr.Code()
+			}
+		}
+		m.apiCalls.WithLabelValues(
+			r.ClientInfo.ServiceName,
+			r.Operation.Name,
+			aws.StringValue(r.Config.Region),
+			code,
+		).Inc()
+	})
+}
+
+// observeSync records the outcome of a sync of stack in region that started
+// at started. creating tells whether the sync created the stack.
+func (m *Metrics) observeSync(stack, region string, creating bool, started time.Time, err error) {
+	if m == nil {
+		return
+	}
+
+	action := "update"
+	if creating {
+		action = "create"
+	}
+
+	outcome := syncOutcome(err)
+	m.syncs.WithLabelValues(stack, region, action, outcome).Inc()
+	if outcome != SyncUnchanged {
+		m.deployDuration.WithLabelValues(stack, region, action).Observe(time.Since(started).Seconds())
+	}
+}
+
+// syncOutcome returns SyncSucceeded, SyncFailed, or SyncUnchanged for the
+// error returned by a sync.
+func syncOutcome(err error) string {
+	if awsErr, ok := errors.Cause(err).(awserr.Error); ok && NoStackUpdatesToPerform(awsErr) {
+		return SyncUnchanged
+	}
+	if err != nil {
+		return SyncFailed
+	}
+	return SyncSucceeded
+}
+
+// observePolls records the number of times a stack was loaded while waiting
+// for it to finish.
+func (m *Metrics) observePolls(stack, region string, polls int) {
+	if m == nil {
+		return
+	}
+	m.pollsPerDeploy.WithLabelValues(stack, region).Observe(float64(polls))
+}
+
+// countEvents wraps consumer to count the events passed to it.
+func (m *Metrics) countEvents(stack, region string, consumer EventConsumer) EventConsumer {
+	if m == nil {
+		return consumer
+	}
+	events := m.events.WithLabelValues(stack, region)
+	return EventConsumerFunc(func(event *cloudformation.StackEvent) error {
+		events.Inc()
+		return consumer.Consume(event)
+	})
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return 0, err
+	}
+
+	var written int64
+	for _, family := range families {
+		n, err := expfmt.MetricFamilyToText(w, family)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ServeHTTP responds with the metrics in the Prometheus text exposition
+// format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}).ServeHTTP(w, req)
+}
+
+// WriteTextfile writes the metrics to path for node_exporter's textfile
+// collector. The file is replaced atomically so the collector never reads a
+// partial file.
+func (m *Metrics) WriteTextfile(path string) error {
+	return errors.Wrap(prometheus.WriteToTextfile(path, m.registry), "failed to write metrics")
+}
@@ -0,0 +1,166 @@
+package stackshot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// expectMetrics fails the test unless every line in expected appears in the
+// metrics' output.
+func expectMetrics(t *testing.T, metrics *Metrics, expected ...string) {
+	t.Helper()
+
+	out := &bytes.Buffer{}
+	if _, err := metrics.WriteTo(out); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	lines := map[string]bool{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		lines[line] = true
+	}
+	for _, line := range expected {
+		if !lines[line] {
+			t.Errorf("Expected metric %q in:\n%s", line, out)
+		}
+	}
+}
+
+func TestStackMetrics(t *testing.T) {
+	config := &StackConfig{
+		Name:        "mystack",
+		Region:      "us-east-1",
+		TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+	}
+
+	metrics := NewMetrics()
+	api := &MockAPI{}
+	api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+	api.CreateStackFn = GenCreateStackFn(&cfn.CreateStackOutput{})
+	api.UpdateStackFn = GenErrorUpdateStackFn(awserr.New("ValidationError", "No updates are to be performed.", nil))
+	api.DescribeStacksFn = NewDescribeStackPlayer(
+		NewDescribeStackResponse(&cfn.Stack{StackStatus: aws.String("CREATE_IN_PROGRESS")}),
+		NewDescribeStackResponse(&cfn.Stack{StackStatus: aws.String("CREATE_COMPLETE")}),
+	).DescribeStacksFn
+
+	stack := &Stack{
+		api:          api,
+		config:       config,
+		eventLoader:  &stubEventLoader{},
+		waiter:       &impatientWaiter{},
+		waitAttempts: 5,
+	}
+	WithMetrics(metrics)(stack)
+
+	consumer := EventConsumerFunc(func(*cfn.StackEvent) error { return nil })
+	if err := stack.SyncAndPollEvents(consumer); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := stack.SyncAndPollEvents(consumer); err == nil {
+		t.Fatalf("Expected no updates to perform")
+	}
+
+	expectMetrics(
+		t,
+		metrics,
+		`stackshot_syncs_total{action="create",outcome="succeeded",region="us-east-1",stack="mystack"} 1`,
+		`stackshot_syncs_total{action="update",outcome="unchanged",region="us-east-1",stack="mystack"} 1`,
+		`stackshot_deploy_duration_seconds_bucket{action="create",region="us-east-1",stack="mystack",le="10"} 1`,
+		`stackshot_deploy_duration_seconds_count{action="create",region="us-east-1",stack="mystack"} 1`,
+		`stackshot_polls_per_deploy_bucket{region="us-east-1",stack="mystack",le="1"} 0`,
+		`stackshot_polls_per_deploy_bucket{region="us-east-1",stack="mystack",le="2"} 1`,
+		`stackshot_polls_per_deploy_sum{region="us-east-1",stack="mystack"} 2`,
+		`stackshot_events_processed_total{region="us-east-1",stack="mystack"} 2`,
+	)
+}
+
+func TestInstrumentSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") == "DescribeStacks" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<ErrorResponse><Error><Code>ValidationError</Code><Message>Stack with id x does not exist</Message></Error></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(`<ListStacksResponse><ListStacksResult></ListStacksResult></ListStacksResponse>`))
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	metrics := NewMetrics()
+	metrics.InstrumentSession(sess)
+
+	api := cfn.New(sess)
+	api.ListStacks(&cfn.ListStacksInput{})
+	api.ListStacks(&cfn.ListStacksInput{})
+	api.DescribeStacks(&cfn.DescribeStacksInput{StackName: aws.String("x")})
+
+	expectMetrics(
+		t,
+		metrics,
+		`stackshot_api_calls_total{code="OK",operation="ListStacks",region="us-east-1",service="cloudformation"} 2`,
+		`stackshot_api_calls_total{code="ValidationError",operation="DescribeStacks",region="us-east-1",service="cloudformation"} 1`,
+	)
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackshot-metrics")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	metrics := NewMetrics()
+	metrics.events.WithLabelValues(`quoted "stack"`, "us-east-1").Add(3)
+
+	path := filepath.Join(dir, "stackshot.prom")
+	if err := metrics.WriteTextfile(path); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !strings.Contains(string(contents), `stackshot_events_processed_total{region="us-east-1",stack="quoted \"stack\""} 3`) {
+		t.Errorf("Unexpected textfile contents:\n%s", contents)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Expected the temporary file to be removed, found %d files", len(files))
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var metrics *Metrics
+	metrics.observeSync("mystack", "us-east-1", true, time.Now(), nil)
+	metrics.observePolls("mystack", "us-east-1", 1)
+
+	consumer := EventConsumerFunc(func(*cfn.StackEvent) error { return nil })
+	if err := metrics.countEvents("mystack", "us-east-1", consumer).Consume(&cfn.StackEvent{}); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,374 @@
+package stackshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// Notification events sent by SyncAndPollEvents().
+const (
+	// NotifyStarted is sent once Cloudformation accepted the stack's create
+	// or update.
+	NotifyStarted = "started"
+
+	// NotifyFailing is sent for the first resource that fails to create,
+	// update, or delete, before the stack finishes rolling back.
+	NotifyFailing = "failing"
+
+	NotifySucceeded = "succeeded"
+	NotifyFailed    = "failed"
+)
+
+// Payload formats of NotificationConfig.Format.
+const (
+	NotificationFormatJSON  = "json"
+	NotificationFormatSlack = "slack"
+	NotificationFormatTeams = "teams"
+)
+
+// webhookTimeout bounds how long a sync waits on a webhook.
+const webhookTimeout = 10 * time.Second
+
+// Notification describes a milestone of a stack's sync.
+type Notification struct {
+	Event              string    `json:"event"`
+	StackName          string    `json:"stack_name"`
+	Region             string    `json:"region,omitempty"`
+	StackId            string    `json:"stack_id,omitempty"`
+	StackStatus        string    `json:"stack_status,omitempty"`
+	ClientRequestToken string    `json:"client_request_token,omitempty"`
+	Time               time.Time `json:"time"`
+
+	// Resource is the logical ID of the failed resource in failing
+	// notifications.
+	Resource string `json:"resource,omitempty"`
+
+	// Reason is why the resource or sync failed in failing and failed
+	// notifications.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Text summarizes the notification in a sentence for chat messages.
+func (n *Notification) Text() string {
+	name := n.StackName
+	if n.Region != "" {
+		name += " (" + n.Region + ")"
+	}
+
+	switch n.Event {
+	case NotifyStarted:
+		return fmt.Sprintf("Deploying %s", name)
+	case NotifyFailing:
+		return fmt.Sprintf("%s is failing: %s %s", name, n.Resource, n.Reason)
+	case NotifySucceeded:
+		return fmt.Sprintf("Deployed %s: %s", name, n.StackStatus)
+	case NotifyFailed:
+		return fmt.Sprintf("Failed to deploy %s: %s", name, n.Reason)
+	}
+	return fmt.Sprintf("%s %s", name, n.Event)
+}
+
+// Notifier sends Notifications, e.g. to a chat room.
+type Notifier interface {
+	Notify(*Notification) error
+}
+
+type NotifierFunc func(*Notification) error
+
+func (n NotifierFunc) Notify(notification *Notification) error {
+	return n(notification)
+}
+
+// NotificationConfig configures a webhook notified of a stack's syncs.
+type NotificationConfig struct {
+	// URL is the webhook's URL. URLEnv names an environment variable holding
+	// the URL instead, which keeps secret URLs like Slack's out of
+	// configurations.
+	URL    string
+	URLEnv string
+
+	// Format is json, the default, slack, or teams. Slack and Teams get a
+	// message with the notification's Text().
+	Format string
+
+	// Template is a text/template rendering the json payload from a
+	// Notification. The json function quotes a value, e.g.
+	// {"msg": {{json .Text}}}. The Notification is sent as is without one.
+	Template string
+
+	// Events limits the notifications sent to the webhook. Every event is
+	// sent when it's empty.
+	Events []string
+}
+
+func (n *NotificationConfig) verify() error {
+	if n.URL == "" && n.URLEnv == "" {
+		return errors.New("notifications need a url or url_env")
+	}
+	if n.URL != "" && n.URLEnv != "" {
+		return errors.New("notifications url and url_env cannot both be set")
+	}
+
+	switch n.Format {
+	case "", NotificationFormatJSON:
+	case NotificationFormatSlack, NotificationFormatTeams:
+		if n.Template != "" {
+			return fmt.Errorf("notifications template cannot be used with format %s", n.Format)
+		}
+	default:
+		return fmt.Errorf("notifications format %s must be json, slack, or teams", n.Format)
+	}
+
+	if _, err := n.template(); err != nil {
+		return err
+	}
+
+	for _, event := range n.Events {
+		switch event {
+		case NotifyStarted, NotifyFailing, NotifySucceeded, NotifyFailed:
+		default:
+			return fmt.Errorf("notifications event %s must be started, failing, succeeded, or failed", event)
+		}
+	}
+	return nil
+}
+
+func (n *NotificationConfig) template() (*template.Template, error) {
+	if n.Template == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("notification").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(n.Template)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid notifications template")
+	}
+	return tmpl, nil
+}
+
+// WebhookNotifier posts Notifications to an HTTP webhook.
+type WebhookNotifier struct {
+	// URL is the webhook's URL. When it's empty, the URL is read from the
+	// environment variable named URLEnv for every notification.
+	URL    string
+	URLEnv string
+
+	Format   string
+	Template *template.Template
+
+	// Events are the notification events posted. Every event is posted
+	// when it's empty.
+	Events []string
+
+	Client *http.Client
+}
+
+// NewWebhookNotifier returns a WebhookNotifier configured by config.
+func NewWebhookNotifier(config *NotificationConfig) (*WebhookNotifier, error) {
+	if err := config.verify(); err != nil {
+		return nil, err
+	}
+	tmpl, err := config.template()
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhookNotifier{
+		URL:      config.URL,
+		URLEnv:   config.URLEnv,
+		Format:   config.Format,
+		Template: tmpl,
+		Events:   config.Events,
+		Client:   &http.Client{Timeout: webhookTimeout},
+	}, nil
+}
+
+// Notify posts notification to the webhook unless its event is filtered out.
+// Errors leave out the URL, which is often a secret.
+func (w *WebhookNotifier) Notify(notification *Notification) error {
+	if len(w.Events) > 0 && !containsString(w.Events, notification.Event) {
+		return nil
+	}
+
+	webhookURL := w.URL
+	if webhookURL == "" {
+		webhookURL = os.Getenv(w.URLEnv)
+		if webhookURL == "" {
+			return fmt.Errorf("failed to post notification: %s is not set", w.URLEnv)
+		}
+	}
+
+	body, err := w.payload(notification)
+	if err != nil {
+		return err
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return errors.Wrap(err, "failed to post notification")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post notification: webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *WebhookNotifier) payload(notification *Notification) ([]byte, error) {
+	switch w.Format {
+	case NotificationFormatSlack:
+		return json.Marshal(map[string]string{"text": notification.Text()})
+	case NotificationFormatTeams:
+		color := "2EB886"
+		if notification.Event == NotifyFailing || notification.Event == NotifyFailed {
+			color = "D00000"
+		}
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    notification.Text(),
+			"themeColor": color,
+			"text":       notification.Text(),
+		})
+	}
+
+	if w.Template == nil {
+		return json.Marshal(notification)
+	}
+	buf := bytes.Buffer{}
+	if err := w.Template.Execute(&buf, notification); err != nil {
+		return nil, errors.Wrap(err, "failed to render notification")
+	}
+	return buf.Bytes(), nil
+}
+
+// WithNotifier sends the stack's sync notifications to notifier along with
+// the webhooks in StackConfig.Notifications.
+func WithNotifier(notifier Notifier) StackOption {
+	return func(s *Stack) {
+		s.notifiers = append(s.notifiers, notifier)
+	}
+}
+
+// configNotifiers returns the notifiers of the webhooks in
+// StackConfig.Notifications.
+func configNotifiers(config *StackConfig) ([]Notifier, error) {
+	notifiers := []Notifier{}
+	for i := range config.Notifications {
+		notifier, err := NewWebhookNotifier(&config.Notifications[i])
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers, nil
+}
+
+// notify queues a notification of event for every notifier. Failing notifiers
+// don't affect the sync; their errors are printed with the hooks' output.
+func (s *Stack) notify(event string, fill func(*Notification)) {
+	if len(s.notifiers) == 0 {
+		return
+	}
+
+	notification := &Notification{
+		Event:              event,
+		StackName:          s.config.Name,
+		Region:             s.config.Region,
+		ClientRequestToken: s.requestToken,
+		Time:               time.Now().UTC(),
+	}
+	if s.cloudStack != nil {
+		notification.StackId = aws.StringValue(s.cloudStack.StackId)
+		notification.StackStatus = aws.StringValue(s.cloudStack.StackStatus)
+	}
+	if fill != nil {
+		fill(notification)
+	}
+
+	// Notifications are sent from their own goroutine so slow webhooks
+	// don't hold up polling the stack. Each waits for the one before it so
+	// they're sent in order.
+	previous, done := s.notified, make(chan struct{})
+	s.notified = done
+	go func() {
+		defer close(done)
+		if previous != nil {
+			<-previous
+		}
+		for _, notifier := range s.notifiers {
+			if err := notifier.Notify(notification); err != nil {
+				out := s.hookWriter("Notify")
+				fmt.Fprintf(out, "%s\n", err)
+				out.Flush()
+			}
+		}
+	}()
+}
+
+// flushNotifications waits until every notification queued by notify() has
+// been sent.
+func (s *Stack) flushNotifications() {
+	if s.notified != nil {
+		<-s.notified
+	}
+}
+
+// notifyFirstFailure returns an EventConsumer passing events to consumer that
+// sends a NotifyFailing notification for the first failed resource.
+func (s *Stack) notifyFirstFailure(consumer EventConsumer) EventConsumer {
+	if len(s.notifiers) == 0 {
+		return consumer
+	}
+
+	notified := false
+	return EventConsumerFunc(func(event *cloudformation.StackEvent) error {
+		err := consumer.Consume(event)
+		if !notified && strings.HasSuffix(aws.StringValue(event.ResourceStatus), "_FAILED") {
+			notified = true
+			s.notify(NotifyFailing, func(n *Notification) {
+				n.Resource = aws.StringValue(event.LogicalResourceId)
+				n.Reason = aws.StringValue(event.ResourceStatusReason)
+			})
+		}
+		return err
+	})
+}
+
+// notifyOutcome sends a NotifySucceeded or NotifyFailed notification for a
+// sync that returned syncErr and waits until every notification has been
+// sent. Syncs without updates to perform aren't notified.
+func (s *Stack) notifyOutcome(syncErr error) {
+	defer s.flushNotifications()
+	switch syncOutcome(syncErr) {
+	case SyncSucceeded:
+		s.notify(NotifySucceeded, nil)
+	case SyncFailed:
+		s.notify(NotifyFailed, func(n *Notification) {
+			n.Reason = syncErr.Error()
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package stackshot
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+// webhookRecorder is an HTTP stand-in for webhooks that records the bodies
+// posted to it.
+type webhookRecorder struct {
+	*httptest.Server
+	bodies []string
+	status int
+}
+
+func newWebhookRecorder() *webhookRecorder {
+	w := &webhookRecorder{status: http.StatusOK}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.bodies = append(w.bodies, string(body))
+		rw.WriteHeader(w.status)
+	}))
+	return w
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	notification := &Notification{
+		Event:     NotifyFailed,
+		StackName: "mystack",
+		Region:    "us-east-1",
+		Reason:    "stack failed",
+		Time:      time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name   string
+		config NotificationConfig
+		body   string
+	}{
+		{
+			"JSON",
+			NotificationConfig{},
+			`{"event":"failed","stack_name":"mystack","region":"us-east-1","time":"2020-09-01T12:00:00Z","reason":"stack failed"}`,
+		},
+		{
+			"Templates",
+			NotificationConfig{Template: `{"msg": {{json .Text}}, "stack": "{{.StackName}}"}`},
+			`{"msg": "Failed to deploy mystack (us-east-1): stack failed", "stack": "mystack"}`,
+		},
+		{
+			"Slack",
+			NotificationConfig{Format: NotificationFormatSlack},
+			`{"text":"Failed to deploy mystack (us-east-1): stack failed"}`,
+		},
+		{
+			"Teams",
+			NotificationConfig{Format: NotificationFormatTeams},
+			`{"@context":"https://schema.org/extensions","@type":"MessageCard","summary":"Failed to deploy mystack (us-east-1): stack failed","text":"Failed to deploy mystack (us-east-1): stack failed","themeColor":"D00000"}`,
+		},
+		{
+			"Filtered events",
+			NotificationConfig{Events: []string{NotifyStarted}},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			webhook := newWebhookRecorder()
+			defer webhook.Close()
+
+			test.config.URL = webhook.URL
+			notifier, err := NewWebhookNotifier(&test.config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if err := notifier.Notify(notification); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			var expected []string
+			if test.body != "" {
+				expected = append(expected, test.body)
+			}
+			if !cmp.Equal(webhook.bodies, expected) {
+				t.Errorf("Unexpected payload: %s", cmp.Diff(expected, webhook.bodies))
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierErrors(t *testing.T) {
+	webhook := newWebhookRecorder()
+	defer webhook.Close()
+	webhook.status = http.StatusForbidden
+
+	os.Setenv("STACKSHOT_TEST_WEBHOOK_URL", webhook.URL+"/secret")
+	defer os.Unsetenv("STACKSHOT_TEST_WEBHOOK_URL")
+
+	notifier, err := NewWebhookNotifier(&NotificationConfig{URLEnv: "STACKSHOT_TEST_WEBHOOK_URL"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	err = notifier.Notify(&Notification{Event: NotifyStarted})
+	if !equalErrors(err, errors.New("failed to post notification: webhook responded 403 Forbidden")) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	webhook.Close()
+	err = notifier.Notify(&Notification{Event: NotifyStarted})
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected an error without the webhook's URL, got: %v", err)
+	}
+
+	notifier, err = NewWebhookNotifier(&NotificationConfig{URLEnv: "STACKSHOT_TEST_UNSET_URL"})
+	if err != nil {
+		t.Fatalf("Expected unset url_env variables to be allowed until notifying, got: %s", err)
+	}
+	err = notifier.Notify(&Notification{Event: NotifyStarted})
+	if !equalErrors(err, errors.New("failed to post notification: STACKSHOT_TEST_UNSET_URL is not set")) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// eventsLoader implements eventLoader by passing events along on the first
+// call to latestEvents().
+type eventsLoader struct {
+	events []*cfn.StackEvent
+}
+
+func (e *eventsLoader) storeLastEvent() error        { return nil }
+func (e *eventsLoader) setStackId(*string)           {}
+func (e *eventsLoader) setClientRequestToken(string) {}
+func (e *eventsLoader) latestEvents(consumer EventConsumer) error {
+	for _, event := range e.events {
+		if err := consumer.Consume(event); err != nil {
+			return err
+		}
+	}
+	e.events = nil
+	return nil
+}
+
+func TestSyncNotifications(t *testing.T) {
+	failedEvent := func(resource string) *cfn.StackEvent {
+		return &cfn.StackEvent{
+			LogicalResourceId:    aws.String(resource),
+			ResourceStatus:       aws.String("UPDATE_FAILED"),
+			ResourceStatusReason: aws.String("access denied"),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		status    string
+		events    []*cfn.StackEvent
+		updateErr error
+		expected  []string
+	}{
+		{"Successful updates", "UPDATE_COMPLETE", nil, nil, []string{"started", "succeeded"}},
+		{
+			"Failed updates",
+			"UPDATE_ROLLBACK_COMPLETE",
+			[]*cfn.StackEvent{failedEvent("MyBucket"), failedEvent("MyQueue")},
+			nil,
+			[]string{"started", "failing MyBucket access denied", "failed stacked failed to complete. status: UPDATE_ROLLBACK_COMPLETE"},
+		},
+		{"Rejected updates", "", nil, errors.New("access denied"), []string{"failed failed to update stack: : access denied"}},
+		{"No updates", "", nil, awserr.New("ValidationError", "No updates are to be performed.", nil), []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployed := &cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String("UPDATE_COMPLETE")}
+			api := &MockAPI{}
+			api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+			api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+			if test.updateErr != nil {
+				api.UpdateStackFn = GenErrorUpdateStackFn(test.updateErr)
+			}
+			api.DescribeStacksFn = GenDescribeStacksFn(
+				&cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String(test.status)},
+			)
+
+			notified := []string{}
+			stack := &Stack{
+				api: api,
+				config: &StackConfig{
+					Name:        "mystack",
+					TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+				},
+				cloudStack:   deployed,
+				eventLoader:  &eventsLoader{events: test.events},
+				waiter:       &impatientWaiter{},
+				waitAttempts: 3,
+			}
+			WithNotifier(NotifierFunc(func(n *Notification) error {
+				if n.ClientRequestToken != stack.ClientRequestToken() {
+					t.Errorf("Expected the sync's token, got: %s", n.ClientRequestToken)
+				}
+				summary := n.Event
+				for _, detail := range []string{n.Resource, n.Reason} {
+					if detail != "" {
+						summary += " " + detail
+					}
+				}
+				notified = append(notified, summary)
+				return nil
+			}))(stack)
+
+			stack.SyncAndPollEvents(EventConsumerFunc(func(*cfn.StackEvent) error { return nil }))
+			if !cmp.Equal(notified, test.expected) {
+				t.Errorf("Unexpected notifications: %s", cmp.Diff(test.expected, notified))
+			}
+		})
+	}
+}
+
+func TestNotifierErrorsDontFailSyncs(t *testing.T) {
+	api := &MockAPI{}
+	api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+	api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+	api.DescribeStacksFn = GenDescribeStacksFn(
+		&cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String("UPDATE_COMPLETE")},
+	)
+
+	out := &strings.Builder{}
+	stack := &Stack{
+		api:          api,
+		config:       &StackConfig{Name: "mystack", TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml"},
+		cloudStack:   &cfn.Stack{StackId: aws.String("arn:mystack")},
+		eventLoader:  &stubEventLoader{},
+		waiter:       &impatientWaiter{},
+		waitAttempts: 3,
+	}
+	WithHookOutput(out, "")(stack)
+	WithNotifier(NotifierFunc(func(*Notification) error { return errors.New("chat is down") }))(stack)
+
+	if err := stack.SyncAndPollEvents(EventConsumerFunc(func(*cfn.StackEvent) error { return nil })); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if out.String() != "[Notify] chat is down\n[Notify] chat is down\n" {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
+
+func TestSlowNotifiersDontHoldUpPolling(t *testing.T) {
+	api := &MockAPI{}
+	api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+	api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+	api.DescribeStacksFn = GenDescribeStacksFn(
+		&cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String("UPDATE_COMPLETE")},
+	)
+
+	stack := &Stack{
+		api:          api,
+		config:       &StackConfig{Name: "mystack", TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml"},
+		cloudStack:   &cfn.Stack{StackId: aws.String("arn:mystack")},
+		eventLoader:  &eventsLoader{events: []*cfn.StackEvent{{LogicalResourceId: aws.String("MyBucket")}}},
+		waiter:       &impatientWaiter{},
+		waitAttempts: 3,
+	}
+
+	// The started notification is only sent once the stack's events have
+	// been polled.
+	polled := make(chan struct{})
+	notified := []string{}
+	WithNotifier(NotifierFunc(func(n *Notification) error {
+		if n.Event == NotifyStarted {
+			select {
+			case <-polled:
+			case <-time.After(time.Second):
+				t.Errorf("Expected polling to continue while notifying")
+			}
+		}
+		notified = append(notified, n.Event)
+		return nil
+	}))(stack)
+
+	consumer := EventConsumerFunc(func(*cfn.StackEvent) error {
+		close(polled)
+		return nil
+	})
+	if err := stack.SyncAndPollEvents(consumer); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	expected := []string{NotifyStarted, NotifySucceeded}
+	if !cmp.Equal(notified, expected) {
+		t.Errorf("Unexpected notifications: %s", cmp.Diff(expected, notified))
+	}
+}
+
+func TestLockedSyncNotifications(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackshot-locks")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	locker := &FileLocker{Dir: dir}
+	if err := locker.Lock("mystack", &LockInfo{Holder: "someone else"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	stack := &Stack{
+		api:         &MockAPI{},
+		config:      &StackConfig{Name: "mystack", TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml"},
+		cloudStack:  &cfn.Stack{StackId: aws.String("arn:mystack")},
+		eventLoader: &stubEventLoader{},
+	}
+	WithLocker(locker, LockInfo{Holder: "me"})(stack)
+
+	notified := []*Notification{}
+	WithNotifier(NotifierFunc(func(n *Notification) error {
+		notified = append(notified, n)
+		return nil
+	}))(stack)
+
+	if _, ok := stack.SyncAndPollEvents(EventConsumerFunc(func(*cfn.StackEvent) error { return nil })).(*LockedError); !ok {
+		t.Fatalf("Expected a LockedError")
+	}
+	if len(notified) != 1 || notified[0].Event != NotifyFailed {
+		t.Fatalf("Expected a failed notification, got: %v", notified)
+	}
+	if !strings.Contains(notified[0].Reason, "is locked by someone else") {
+		t.Errorf("Unexpected reason: %s", notified[0].Reason)
+	}
+}
@@ -0,0 +1,82 @@
+package stackshot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Output is a stack output.
+type Output struct {
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	ExportName  string `json:"export_name,omitempty"`
+}
+
+// Outputs maps a stack's output keys to their outputs.
+type Outputs map[string]Output
+
+// Outputs returns the stack's outputs as of the last time the stack was
+// loaded. After SyncAndPollEvents() returns, they're the outputs of the
+// synced stack. A stack that doesn't exist has no outputs.
+func (s *Stack) Outputs() Outputs {
+	outputs := Outputs{}
+	if s.cloudStack == nil {
+		return outputs
+	}
+
+	for _, output := range s.cloudStack.Outputs {
+		outputs[aws.StringValue(output.OutputKey)] = Output{
+			Value:       aws.StringValue(output.OutputValue),
+			Description: aws.StringValue(output.Description),
+			ExportName:  aws.StringValue(output.ExportName),
+		}
+	}
+	return outputs
+}
+
+// Keys returns the output keys sorted.
+func (o Outputs) Keys() []string {
+	keys := make([]string, 0, len(o))
+	for key := range o {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, `$`, `\$`)
+
+// WriteDotenv writes the outputs' values as a dotenv file, one KEY="value"
+// line per output. Each key is prefixed with prefix.
+func (o Outputs) WriteDotenv(w io.Writer, prefix string) error {
+	for _, key := range o.Keys() {
+		_, err := fmt.Fprintf(w, "%s%s=\"%s\"\n", prefix, key, dotenvEscaper.Replace(o[key].Value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteGitHubOutputs writes the outputs' values in the format of GitHub
+// Actions' $GITHUB_OUTPUT file so later steps can read them as
+// steps.<id>.outputs.<prefix><key>. Values may span multiple lines.
+func (o Outputs) WriteGitHubOutputs(w io.Writer, prefix string) error {
+	for _, key := range o.Keys() {
+		value := o[key].Value
+		delimiter := "STACKSHOT_EOF"
+		for strings.Contains(value, delimiter) {
+			delimiter += "_"
+		}
+
+		_, err := fmt.Fprintf(w, "%s%s<<%s\n%s\n%s\n", prefix, key, delimiter, value, delimiter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
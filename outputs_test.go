@@ -0,0 +1,64 @@
+package stackshot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutputs(t *testing.T) {
+	stack := &Stack{config: &StackConfig{Name: "mystack"}}
+	if outputs := stack.Outputs(); len(outputs) != 0 {
+		t.Errorf("Expected a missing stack to have no outputs, got: %v", outputs)
+	}
+
+	stack.cloudStack = &cfn.Stack{
+		Outputs: []*cfn.Output{
+			{
+				OutputKey:   aws.String("ApiUrl"),
+				OutputValue: aws.String("https://api.example.com"),
+				Description: aws.String("The API's URL"),
+				ExportName:  aws.String("mystack-ApiUrl"),
+			},
+			{OutputKey: aws.String("Bucket"), OutputValue: aws.String("my-bucket")},
+		},
+	}
+
+	expected := Outputs{
+		"ApiUrl": {Value: "https://api.example.com", Description: "The API's URL", ExportName: "mystack-ApiUrl"},
+		"Bucket": {Value: "my-bucket"},
+	}
+	if outputs := stack.Outputs(); !cmp.Equal(outputs, expected) {
+		t.Errorf("Unexpected outputs: %s", cmp.Diff(expected, outputs))
+	}
+}
+
+func TestWriteOutputs(t *testing.T) {
+	outputs := Outputs{
+		"Bucket": {Value: "my-bucket"},
+		"Config": {Value: "line \"one\"\n$HOME\\two\nSTACKSHOT_EOF"},
+	}
+
+	dotenv := &bytes.Buffer{}
+	if err := outputs.WriteDotenv(dotenv, "API_"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "API_Bucket=\"my-bucket\"\n" +
+		"API_Config=\"line \\\"one\\\"\\n\\$HOME\\\\two\\nSTACKSHOT_EOF\"\n"
+	if dotenv.String() != expected {
+		t.Errorf("Unexpected dotenv:\n%s", cmp.Diff(expected, dotenv.String()))
+	}
+
+	github := &bytes.Buffer{}
+	if err := outputs.WriteGitHubOutputs(github, ""); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected = "Bucket<<STACKSHOT_EOF\nmy-bucket\nSTACKSHOT_EOF\n" +
+		"Config<<STACKSHOT_EOF_\nline \"one\"\n$HOME\\two\nSTACKSHOT_EOF\nSTACKSHOT_EOF_\n"
+	if github.String() != expected {
+		t.Errorf("Unexpected GitHub outputs:\n%s", cmp.Diff(expected, github.String()))
+	}
+}
@@ -0,0 +1,404 @@
+package stackshot
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// artifactFormat describes how a packaged artifact's S3 location is written
+// back into the template.
+type artifactFormat int
+
+const (
+	// s3URIFormat replaces the property with "s3://bucket/key".
+	s3URIFormat artifactFormat = iota
+
+	// s3ObjectFormat replaces the property with a mapping of bucket and key
+	// properties, e.g. {S3Bucket: bucket, S3Key: key}.
+	s3ObjectFormat
+
+	// templateURLFormat packages the referenced file as a nested template and
+	// replaces the property with the packaged template's HTTPS URL.
+	templateURLFormat
+)
+
+// artifactProperty is a resource property that may reference a local file or
+// directory instead of an S3 location.
+type artifactProperty struct {
+	// path is the property's location within the resource's Properties.
+	path []string
+
+	format artifactFormat
+
+	// zip denotes the artifact must be uploaded as a zip archive.
+	// Directories are always zipped.
+	zip bool
+
+	// bucketKey and keyKey are the property names used by s3ObjectFormat.
+	bucketKey string
+	keyKey    string
+}
+
+// artifactProperties lists the resource properties that are packaged. It
+// mirrors the properties supported by `aws cloudformation package`.
+var artifactProperties = map[string][]artifactProperty{
+	"AWS::ApiGateway::RestApi": {
+		{path: []string{"BodyS3Location"}, format: s3ObjectFormat, bucketKey: "Bucket", keyKey: "Key"},
+	},
+	"AWS::AppSync::GraphQLSchema": {
+		{path: []string{"DefinitionS3Location"}, format: s3URIFormat},
+	},
+	"AWS::AppSync::Resolver": {
+		{path: []string{"RequestMappingTemplateS3Location"}, format: s3URIFormat},
+		{path: []string{"ResponseMappingTemplateS3Location"}, format: s3URIFormat},
+	},
+	"AWS::CloudFormation::Stack": {
+		{path: []string{"TemplateURL"}, format: templateURLFormat},
+	},
+	"AWS::ElasticBeanstalk::ApplicationVersion": {
+		{path: []string{"SourceBundle"}, format: s3ObjectFormat, zip: true, bucketKey: "S3Bucket", keyKey: "S3Key"},
+	},
+	"AWS::Glue::Job": {
+		{path: []string{"Command", "ScriptLocation"}, format: s3URIFormat},
+	},
+	"AWS::Lambda::Function": {
+		{path: []string{"Code"}, format: s3ObjectFormat, zip: true, bucketKey: "S3Bucket", keyKey: "S3Key"},
+	},
+	"AWS::Lambda::LayerVersion": {
+		{path: []string{"Content"}, format: s3ObjectFormat, zip: true, bucketKey: "S3Bucket", keyKey: "S3Key"},
+	},
+	"AWS::Serverless::Api": {
+		{path: []string{"DefinitionUri"}, format: s3URIFormat},
+	},
+	"AWS::Serverless::Application": {
+		{path: []string{"Location"}, format: templateURLFormat},
+	},
+	"AWS::Serverless::Function": {
+		{path: []string{"CodeUri"}, format: s3URIFormat, zip: true},
+	},
+	"AWS::Serverless::HttpApi": {
+		{path: []string{"DefinitionUri"}, format: s3URIFormat},
+	},
+	"AWS::Serverless::LayerVersion": {
+		{path: []string{"ContentUri"}, format: s3URIFormat, zip: true},
+	},
+	"AWS::Serverless::StateMachine": {
+		{path: []string{"DefinitionUri"}, format: s3URIFormat},
+	},
+	"AWS::StepFunctions::StateMachine": {
+		{path: []string{"DefinitionS3Location"}, format: s3ObjectFormat, bucketKey: "Bucket", keyKey: "Key"},
+	},
+}
+
+// zipModTime is the modification time written to every zip entry so that
+// archives of identical content hash to identical S3 keys.
+var zipModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// packager uploads local artifacts referenced by a template to S3 and
+// rewrites the references to point at the uploaded objects, similar to
+// `aws cloudformation package`.
+//
+// A dryRun packager rewrites the template the same way without uploading
+// anything, so the result can be compared with a deployed template.
+type packager struct {
+	bucket   string
+	uploader Uploader
+	reader   localFileReader
+	dryRun   bool
+}
+
+// objectLocator is implemented by Uploaders that can tell an object's URL
+// without uploading it.
+type objectLocator interface {
+	url(bucket, key string) string
+}
+
+// errUnknownLocation is returned by a dryRun packager when a nested
+// template's URL can't be known without uploading it.
+var errUnknownLocation = errors.New("nested template location is unknown without uploading it")
+
+// packageTemplate packages the local artifacts referenced by body. Relative
+// artifact paths are resolved against baseDir. When body doesn't reference any
+// local artifacts, it's returned unmodified.
+func (p *packager) packageTemplate(body []byte, baseDir string) ([]byte, error) {
+	doc, err := parseTemplate(body)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := false
+	var packageErr error
+	mappingEntries(
+		mappingValue(templateRoot(doc), "Resources"),
+		func(logicalId string, resource *yaml.Node) {
+			if packageErr != nil {
+				return
+			}
+
+			resourceType := mappingValue(resource, "Type")
+			if resourceType == nil {
+				return
+			}
+
+			for _, property := range artifactProperties[resourceType.Value] {
+				changed, err := p.packageProperty(resource, property, baseDir)
+				if err != nil {
+					packageErr = errors.Wrapf(err, "failed to package %s", logicalId)
+					return
+				}
+				modified = modified || changed
+			}
+		},
+	)
+
+	if packageErr != nil {
+		return nil, packageErr
+	}
+	if !modified {
+		return body, nil
+	}
+
+	if isJSONTemplate(body) {
+		return encodeJSONTemplate(doc)
+	}
+	return encodeTemplate(doc)
+}
+
+// packageProperty uploads the artifact referenced by a resource's property
+// when it's a local path. It returns true when the property was rewritten.
+func (p *packager) packageProperty(resource *yaml.Node, property artifactProperty, baseDir string) (bool, error) {
+	parent := mappingValue(resource, "Properties")
+	for _, key := range property.path[:len(property.path)-1] {
+		parent = mappingValue(parent, key)
+	}
+	name := property.path[len(property.path)-1]
+
+	value := mappingValue(parent, name)
+	if !isPlainString(value) || !isLocalPath(value.Value) {
+		return false, nil
+	}
+
+	if p.bucket == "" {
+		return false, fmt.Errorf(
+			"%s references local path %s. Set TemplateBucket to upload local artifacts",
+			strings.Join(property.path, "."),
+			value.Value,
+		)
+	}
+	if p.uploader == nil && !p.dryRun {
+		return false, errors.New("template references local artifacts but no uploader is configured")
+	}
+
+	path := value.Value
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+
+	var replacement *yaml.Node
+	if property.format == templateURLFormat {
+		url, err := p.uploadNestedTemplate(path)
+		if err != nil {
+			return false, err
+		}
+		replacement = stringNode(url)
+	} else {
+		key, err := p.uploadArtifact(path, property.zip)
+		if err != nil {
+			return false, err
+		}
+
+		if property.format == s3ObjectFormat {
+			replacement = &yaml.Node{
+				Kind: yaml.MappingNode,
+				Tag:  "!!map",
+				Content: []*yaml.Node{
+					stringNode(property.bucketKey), stringNode(p.bucket),
+					stringNode(property.keyKey), stringNode(key),
+				},
+			}
+		} else {
+			replacement = stringNode(fmt.Sprintf("s3://%s/%s", p.bucket, key))
+		}
+	}
+
+	*value = *replacement
+	return true, nil
+}
+
+// uploadNestedTemplate packages the nested template at path, relative to its
+// own directory, and uploads it. It returns the uploaded template's URL.
+func (p *packager) uploadNestedTemplate(path string) (string, error) {
+	body, err := p.reader.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	packaged, err := p.packageTemplate(body, filepath.Dir(path))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to package nested template %s", path)
+	}
+
+	key := contentKey(packaged, ".template")
+	if p.dryRun {
+		locator, ok := p.uploader.(objectLocator)
+		if !ok {
+			return "", errUnknownLocation
+		}
+		return locator.url(p.bucket, key), nil
+	}
+	return p.uploader.Upload(p.bucket, key, packaged)
+}
+
+// uploadArtifact uploads the file or directory at path and returns its S3
+// key. Directories are always zipped. Files are zipped when zipFiles is true
+// unless they already are zip or jar archives.
+func (p *packager) uploadArtifact(path string, zipFiles bool) (string, error) {
+	info, err := p.reader.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	var body []byte
+	extension := filepath.Ext(path)
+	switch {
+	case info.IsDir():
+		body, err = p.zipDirectory(path)
+		extension = ".zip"
+	case zipFiles && extension != ".zip" && extension != ".jar":
+		body, err = p.zipFile(path, info)
+		extension = ".zip"
+	default:
+		body, err = p.reader.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key := contentKey(body, extension)
+	if p.dryRun {
+		return key, nil
+	}
+	_, err = p.uploader.Upload(p.bucket, key, body)
+	return key, err
+}
+
+// isLocalPath reports whether an artifact property refers to a local path
+// rather than an S3 or HTTP location.
+func isLocalPath(value string) bool {
+	for _, prefix := range []string{"s3://", "http://", "https://"} {
+		if strings.HasPrefix(value, prefix) {
+			return false
+		}
+	}
+	return value != ""
+}
+
+// zipDirectory builds a zip archive of every file within dir. Entries are
+// sorted and written with a fixed modification time so the archive's content,
+// and therefore its S3 key, only changes when the files do.
+func (p *packager) zipDirectory(dir string) ([]byte, error) {
+	files := map[string]os.FileInfo{}
+	var walk func(string) error
+	walk = func(dir string) error {
+		entries, err := p.reader.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if entry.IsDir() {
+				if err := walk(path); err != nil {
+					return err
+				}
+			} else if entry.Mode().IsRegular() {
+				files[path] = entry
+			}
+		}
+		return nil
+	}
+	if err := walk(dir); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	buf := bytes.Buffer{}
+	archive := zip.NewWriter(&buf)
+	for _, path := range paths {
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.addZipEntry(archive, path, filepath.ToSlash(name), files[path]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// zipFile builds a zip archive containing the single file at path.
+func (p *packager) zipFile(path string, info os.FileInfo) ([]byte, error) {
+	buf := bytes.Buffer{}
+	archive := zip.NewWriter(&buf)
+	if err := p.addZipEntry(archive, path, filepath.Base(path), info); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *packager) addZipEntry(archive *zip.Writer, path, name string, info os.FileInfo) error {
+	contents, err := p.reader.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: zipModTime,
+	}
+	// Keep the execute bits, which matter for Lambda runtimes and
+	// binaries, while normalizing everything else.
+	header.SetMode(0644 | (info.Mode() & 0111))
+
+	w, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	return err
+}
+
+// encodeTemplate encodes a template parsed by parseTemplate() back into YAML.
+func encodeTemplate(doc *yaml.Node) ([]byte, error) {
+	buf := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, errors.Wrap(err, "failed to encode template")
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to encode template")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,235 @@
+package stackshot
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeFiles creates files within a new temporary directory. files maps
+// slash-separated paths to file contents.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "stackshot")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %s", err)
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %s", err)
+		}
+	}
+	return dir
+}
+
+func TestPackageTemplate(t *testing.T) {
+	t.Run(
+		"Rewrites local artifacts",
+		func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{
+				"template.yaml": `AWSTemplateFormatVersion: 2010-09-09
+Transform: AWS::Serverless-2016-10-31
+Resources:
+  Function:
+    Type: AWS::Serverless::Function
+    Properties:
+      CodeUri: ./src
+      Handler: !Sub "${AWS::StackName}.handler"
+  Legacy:
+    Type: AWS::Lambda::Function
+    Properties:
+      Code: src/index.js
+  Nested:
+    Type: AWS::CloudFormation::Stack
+    Properties:
+      TemplateURL: nested/child.yaml
+  Remote:
+    Type: AWS::Serverless::Function
+    Properties:
+      CodeUri: s3://bucket/code.zip
+`,
+				"src/index.js":      "exports.handler = () => {}",
+				"nested/child.yaml": "Resources:\n  Fn:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: ../src\n",
+			})
+			defer os.RemoveAll(dir)
+
+			uploader := &recordingUploader{}
+			p := packager{bucket: "artifacts", uploader: uploader, reader: osFileReader{}}
+
+			body, err := ioutil.ReadFile(filepath.Join(dir, "template.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			packaged, err := p.packageTemplate(body, dir)
+			if err != nil {
+				t.Fatalf("Expected packageTemplate() to succeed. Got error: %s", err)
+			}
+
+			srcZip, err := p.zipDirectory(filepath.Join(dir, "src"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			srcKey := contentKey(srcZip, ".zip")
+
+			out := map[string]interface{}{}
+			if err := yaml.Unmarshal(packaged, &out); err != nil {
+				t.Fatalf("Failed to parse packaged template: %s", err)
+			}
+			resources := out["Resources"].(map[string]interface{})
+			properties := func(name string) map[string]interface{} {
+				return resources[name].(map[string]interface{})["Properties"].(map[string]interface{})
+			}
+
+			if uri := properties("Function")["CodeUri"]; uri != "s3://artifacts/"+srcKey {
+				t.Errorf("Expected CodeUri: s3://artifacts/%s. Got: %v", srcKey, uri)
+			}
+
+			code := properties("Legacy")["Code"].(map[string]interface{})
+			if code["S3Bucket"] != "artifacts" || !strings.HasSuffix(code["S3Key"].(string), ".zip") {
+				t.Errorf("Expected Code to reference a zip in artifacts. Got: %v", code)
+			}
+
+			if uri := properties("Remote")["CodeUri"]; uri != "s3://bucket/code.zip" {
+				t.Errorf("Expected remote CodeUri to be unchanged. Got: %v", uri)
+			}
+
+			url, _ := properties("Nested")["TemplateURL"].(string)
+			if !strings.HasPrefix(url, "https://") || !strings.HasSuffix(url, ".template") {
+				t.Errorf("Expected nested TemplateURL to be uploaded. Got: %s", url)
+			}
+
+			child, ok := uploader.objects["artifacts/"+url[strings.Index(url, "stackshot/"):]]
+			if !ok {
+				t.Fatalf("Expected nested template to be uploaded. Got: %v", uploader.objects)
+			}
+			if !strings.Contains(string(child), "S3Key: "+srcKey) {
+				t.Errorf("Expected nested template's Code to be packaged. Got:\n%s", child)
+			}
+
+			if !strings.Contains(string(packaged), `!Sub "${AWS::StackName}.handler"`) {
+				t.Errorf("Expected short-form intrinsic functions to be preserved. Got:\n%s", packaged)
+			}
+		},
+	)
+
+	t.Run(
+		"JSON templates stay JSON",
+		func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"src/index.js": "exports.handler = () => {}"})
+			defer os.RemoveAll(dir)
+
+			body := []byte(`{
+  "Resources": {
+    "Fn": {
+      "Type": "AWS::Lambda::Function",
+      "Properties": {"Code": "src", "MemorySize": 128, "Role": {"Fn::GetAtt": ["Role", "Arn"]}}
+    }
+  }
+}`)
+			p := packager{bucket: "artifacts", uploader: &recordingUploader{}, reader: osFileReader{}}
+
+			packaged, err := p.packageTemplate(body, dir)
+			if err != nil {
+				t.Fatalf("Expected packageTemplate() to succeed. Got error: %s", err)
+			}
+
+			out := map[string]interface{}{}
+			if err := json.Unmarshal(packaged, &out); err != nil {
+				t.Fatalf("Expected packaged template to be JSON. Got error: %s\n%s", err, packaged)
+			}
+			if !strings.Contains(string(packaged), `"MemorySize": 128`) {
+				t.Errorf("Expected numbers to be preserved. Got:\n%s", packaged)
+			}
+		},
+	)
+
+	t.Run(
+		"Reads artifacts through the reader",
+		func(t *testing.T) {
+			body := []byte("Resources:\n  Fn:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: index.js\n")
+			uploader := &recordingUploader{}
+			p := packager{
+				bucket:   "artifacts",
+				uploader: uploader,
+				reader:   &stubFileReader{contents: "exports.handler = () => {}"},
+			}
+
+			if _, err := p.packageTemplate(body, "missing"); err != nil {
+				t.Fatalf("Expected packageTemplate() to succeed. Got error: %s", err)
+			}
+			if len(uploader.objects) != 1 {
+				t.Fatalf("Expected one upload. Got: %v", uploader.objects)
+			}
+			for _, object := range uploader.objects {
+				archive, err := zip.NewReader(bytes.NewReader(object), int64(len(object)))
+				if err != nil {
+					t.Fatalf("Expected a zip archive. Got error: %s", err)
+				}
+				if len(archive.File) != 1 || archive.File[0].Name != "index.js" {
+					t.Errorf("Unexpected archive entries: %v", archive.File)
+				}
+			}
+		},
+	)
+
+	t.Run(
+		"Zips are deterministic",
+		func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"a.py": "a", "lib/b.py": "b"})
+			defer os.RemoveAll(dir)
+
+			p := packager{reader: osFileReader{}}
+			first, err := p.zipDirectory(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := p.zipDirectory(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if contentKey(first, ".zip") != contentKey(second, ".zip") {
+				t.Errorf("Expected identical directories to produce identical zips")
+			}
+		},
+	)
+
+	t.Run(
+		"Templates without local artifacts are unchanged",
+		func(t *testing.T) {
+			body := []byte("# comment\nResources:\n  Bucket:\n    Type: AWS::S3::Bucket\n")
+			p := packager{}
+
+			packaged, err := p.packageTemplate(body, ".")
+			if err != nil {
+				t.Fatalf("Expected packageTemplate() to succeed. Got error: %s", err)
+			}
+			if string(packaged) != string(body) {
+				t.Errorf("Expected template to be unchanged. Got:\n%s", packaged)
+			}
+		},
+	)
+
+	t.Run(
+		"Fails without a bucket",
+		func(t *testing.T) {
+			body := []byte("Resources:\n  Fn:\n    Type: AWS::Serverless::Function\n    Properties:\n      CodeUri: ./src\n")
+			p := packager{uploader: &recordingUploader{}}
+
+			_, err := p.packageTemplate(body, ".")
+			if err == nil {
+				t.Errorf("Expected packageTemplate() to fail. Got success")
+			}
+		},
+	)
+}
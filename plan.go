@@ -0,0 +1,187 @@
+package stackshot
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// Plan actions.
+const (
+	PlanCreate = "create"
+	PlanUpdate = "update"
+	PlanNone   = "none"
+)
+
+// Plan describes what syncing a StackConfig would change.
+type Plan struct {
+	// Action is PlanCreate, PlanUpdate, or PlanNone.
+	Action string `json:"action"`
+
+	// Changes describes each difference between the StackConfig and the
+	// stack, e.g. "parameter InstanceType".
+	Changes []string `json:"changes,omitempty"`
+}
+
+// noEchoValue is the value Cloudformation reports for NoEcho parameters.
+const noEchoValue = "****"
+
+// Plan compares the StackConfig with the Cloudformation Stack without
+// changing anything. The template, parameters, tags, capabilities, stack
+// policy, and termination protection are compared. Stacks left failed or
+// rolled back by their last operation always plan an update since their
+// configuration may match a template that never deployed.
+//
+// Plan never uploads anything. Templates referenced by TemplateURL, or with
+// nested templates whose URLs aren't known until they're uploaded, can't be
+// compared and always plan an update. Syncing such a stack may still find no
+// updates to perform.
+func (s *Stack) Plan() (*Plan, error) {
+	if s.cloudStack == nil {
+		return &Plan{Action: PlanCreate}, nil
+	}
+
+	plan := &Plan{Action: PlanNone}
+
+	status := aws.StringValue(s.cloudStack.StackStatus)
+	if succeeded, ok := stackDoneStatuses[status]; ok && !succeeded {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("stack status %s", status))
+	}
+
+	if !s.config.UsePreviousTemplate {
+		changed, err := s.templateChanged()
+		if err != nil {
+			return nil, err
+		}
+		if changed != "" {
+			plan.Changes = append(plan.Changes, changed)
+		}
+	}
+
+	current := map[string]string{}
+	for _, parameter := range s.cloudStack.Parameters {
+		current[aws.StringValue(parameter.ParameterKey)] = aws.StringValue(parameter.ParameterValue)
+	}
+	keys := make([]string, 0, len(s.config.Parameters))
+	for key := range s.config.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := s.config.Parameters[key]
+		currentValue, ok := current[key]
+		switch {
+		case value.UsePreviousValue, currentValue == noEchoValue:
+			continue
+		case !ok || currentValue != value.Value:
+			plan.Changes = append(plan.Changes, fmt.Sprintf("parameter %s", key))
+		}
+	}
+
+	currentTags := map[string]string{}
+	for _, tag := range s.cloudStack.Tags {
+		currentTags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	desiredTags := map[string]bool{}
+	for _, tag := range s.tags() {
+		key := aws.StringValue(tag.Key)
+		desiredTags[key] = true
+		if value, ok := currentTags[key]; !ok || value != aws.StringValue(tag.Value) {
+			plan.Changes = append(plan.Changes, fmt.Sprintf("tag %s", key))
+		}
+	}
+
+	// UpdateStack only replaces the stack's tags when tags are set.
+	removed := []string{}
+	for key := range currentTags {
+		if len(desiredTags) > 0 && !desiredTags[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("tag %s (removed)", key))
+	}
+
+	if !equalCapabilities(s.cloudStack.Capabilities, s.config.Capabilities) {
+		plan.Changes = append(plan.Changes, "capabilities")
+	}
+
+	if _, changed, err := s.stackPolicyChanged(); err != nil {
+		return nil, errors.Wrap(err, "failed to compare stack policy")
+	} else if changed {
+		plan.Changes = append(plan.Changes, "stack policy")
+	}
+
+	if aws.BoolValue(s.cloudStack.EnableTerminationProtection) != s.config.EnableTerminationProtection {
+		plan.Changes = append(plan.Changes, "termination protection")
+	}
+
+	if len(plan.Changes) > 0 {
+		plan.Action = PlanUpdate
+	}
+	return plan, nil
+}
+
+// templateChanged compares the configured template with the stack's and
+// returns the plan change describing their difference, if any. Local
+// artifacts are packaged without uploading them so planning never writes to
+// S3.
+func (s *Stack) templateChanged() (string, error) {
+	if s.config.TemplateURL != "" {
+		return "template (not compared)", nil
+	}
+
+	contents, baseDir, err := s.localTemplate()
+	if err != nil {
+		return "", err
+	}
+	packager := packager{
+		bucket:   s.config.TemplateBucket,
+		uploader: s.uploader,
+		reader:   s.templateReader,
+		dryRun:   true,
+	}
+	contents, err = packager.packageTemplate(contents, baseDir)
+	if errors.Cause(err) == errUnknownLocation {
+		return "template (not compared)", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	out, err := s.api.GetTemplate(
+		&cloudformation.GetTemplateInput{
+			StackName:     s.cloudStack.StackId,
+			TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+		},
+	)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to load stack template")
+	}
+	if aws.StringValue(out.TemplateBody) != string(contents) {
+		return "template", nil
+	}
+	return "", nil
+}
+
+// equalCapabilities reports whether a stack's capabilities match the
+// configured ones regardless of their order.
+func equalCapabilities(current []*string, desired []string) bool {
+	if len(current) != len(desired) {
+		return false
+	}
+	have := map[string]bool{}
+	for _, capability := range current {
+		have[aws.StringValue(capability)] = true
+	}
+	for _, capability := range desired {
+		if !have[capability] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+package stackshot
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlan(t *testing.T) {
+	template := "Resources:\n  Bucket:\n    Type: AWS::S3::Bucket\n"
+	deployed := func() *cfn.Stack {
+		return &cfn.Stack{
+			StackId:     aws.String("arn:mystack"),
+			StackName:   aws.String("mystack"),
+			StackStatus: aws.String("UPDATE_COMPLETE"),
+			Parameters: []*cfn.Parameter{
+				{ParameterKey: aws.String("Env"), ParameterValue: aws.String("production")},
+				{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+			},
+			Tags: []*cfn.Tag{
+				{Key: aws.String("team"), Value: aws.String("platform")},
+			},
+		}
+	}
+	config := func() *StackConfig {
+		return &StackConfig{
+			Name:         "mystack",
+			TemplateBody: templateBody(template),
+			Parameters: map[string]ParameterValue{
+				"Env":      {Value: "production"},
+				"Password": {Value: "hunter2"},
+			},
+			Tags: map[string]string{"team": "platform"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		stack    *cfn.Stack
+		config   func(*StackConfig)
+		template string
+		policy   string
+		expected *Plan
+	}{
+		{
+			name:     "Missing stacks are created",
+			expected: &Plan{Action: PlanCreate},
+		},
+		{
+			name:     "Matching stacks have nothing to change",
+			stack:    deployed(),
+			template: template,
+			expected: &Plan{Action: PlanNone},
+		},
+		{
+			name:     "Template changes",
+			stack:    deployed(),
+			template: "Resources: {}\n",
+			expected: &Plan{Action: PlanUpdate, Changes: []string{"template"}},
+		},
+		{
+			name:  "Parameter and tag changes",
+			stack: deployed(),
+			config: func(c *StackConfig) {
+				c.Parameters["Env"] = ParameterValue{Value: "staging"}
+				c.Parameters["Size"] = ParameterValue{Value: "large"}
+				c.Tags = map[string]string{"team": "data", "cost-center": "42"}
+			},
+			template: template,
+			expected: &Plan{
+				Action:  PlanUpdate,
+				Changes: []string{"parameter Env", "parameter Size", "tag cost-center", "tag team"},
+			},
+		},
+		{
+			name:     "Removed tags",
+			stack:    deployed(),
+			config:   func(c *StackConfig) { c.Tags = map[string]string{"owner": "me"} },
+			template: template,
+			expected: &Plan{Action: PlanUpdate, Changes: []string{"tag owner", "tag team (removed)"}},
+		},
+		{
+			name:  "Previous values and templates aren't compared",
+			stack: deployed(),
+			config: func(c *StackConfig) {
+				c.UsePreviousTemplate = true
+				c.Parameters["Env"] = ParameterValue{UsePreviousValue: true}
+			},
+			expected: &Plan{Action: PlanNone},
+		},
+		{
+			name:  "Template URLs aren't compared",
+			stack: deployed(),
+			config: func(c *StackConfig) {
+				c.TemplateBody = ""
+				c.TemplateURL = "https://bucket.s3.amazonaws.com/template.yaml"
+			},
+			expected: &Plan{Action: PlanUpdate, Changes: []string{"template (not compared)"}},
+		},
+		{
+			name:  "Stack policy changes",
+			stack: deployed(),
+			config: func(c *StackConfig) {
+				c.StackPolicy = stackPolicy{Body: `{"Statement": [{"Effect": "Deny", "Action": "Update:*"}]}`}
+			},
+			template: template,
+			policy:   `{"Statement":[{"Effect":"Allow","Action":"Update:*"}]}`,
+			expected: &Plan{Action: PlanUpdate, Changes: []string{"stack policy"}},
+		},
+		{
+			name:  "Matching stack policies",
+			stack: deployed(),
+			config: func(c *StackConfig) {
+				c.StackPolicy = stackPolicy{Body: `{"Statement": [{"Effect": "Allow", "Action": "Update:*"}]}`}
+			},
+			template: template,
+			policy:   `{"Statement":[{"Effect":"Allow","Action":"Update:*"}]}`,
+			expected: &Plan{Action: PlanNone},
+		},
+		{
+			name: "Capability changes",
+			stack: func() *cfn.Stack {
+				stack := deployed()
+				stack.Capabilities = aws.StringSlice([]string{"CAPABILITY_IAM"})
+				return stack
+			}(),
+			config: func(c *StackConfig) {
+				c.Capabilities = []string{"CAPABILITY_NAMED_IAM"}
+			},
+			template: template,
+			expected: &Plan{Action: PlanUpdate, Changes: []string{"capabilities"}},
+		},
+		{
+			name: "Termination protection changes",
+			stack: func() *cfn.Stack {
+				stack := deployed()
+				stack.EnableTerminationProtection = aws.Bool(true)
+				return stack
+			}(),
+			template: template,
+			expected: &Plan{Action: PlanUpdate, Changes: []string{"termination protection"}},
+		},
+		{
+			name: "Rolled back stacks",
+			stack: func() *cfn.Stack {
+				stack := deployed()
+				stack.StackStatus = aws.String("ROLLBACK_COMPLETE")
+				return stack
+			}(),
+			template: template,
+			expected: &Plan{Action: PlanUpdate, Changes: []string{"stack status ROLLBACK_COMPLETE"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := config()
+			if test.config != nil {
+				test.config(c)
+			}
+
+			api := &MockAPI{}
+			api.GetTemplateFn = func(input *cfn.GetTemplateInput) (*cfn.GetTemplateOutput, error) {
+				if test.template == "" {
+					t.Errorf("Unexpected call to GetTemplate")
+				}
+				return GenGetTemplateFn(test.template)(input)
+			}
+
+			api.GetStackPolicyFn = func(*cfn.GetStackPolicyInput) (*cfn.GetStackPolicyOutput, error) {
+				if test.policy == "" {
+					t.Errorf("Unexpected call to GetStackPolicy")
+				}
+				return &cfn.GetStackPolicyOutput{StackPolicyBody: aws.String(test.policy)}, nil
+			}
+
+			stack := &Stack{api: api, config: c, cloudStack: test.stack}
+			plan, err := stack.Plan()
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !cmp.Equal(plan, test.expected) {
+				t.Errorf("Unexpected plan: %s", cmp.Diff(test.expected, plan))
+			}
+		})
+	}
+}
+
+func TestPlanDoesNotUpload(t *testing.T) {
+	template := "Resources:\n  Fn:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: index.js\n"
+	reader := &stubFileReader{contents: "exports.handler = () => {}"}
+
+	// The deployed template is the one syncing would have uploaded.
+	deployer := packager{bucket: "artifacts", uploader: &recordingUploader{}, reader: reader}
+	deployed, err := deployer.packageTemplate([]byte(template), ".")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	api := &MockAPI{}
+	api.GetTemplateFn = GenGetTemplateFn(string(deployed))
+	uploader := &recordingUploader{}
+	stack := &Stack{
+		api:            api,
+		config:         &StackConfig{Name: "mystack", TemplateBody: templateBody(template), TemplateBucket: "artifacts"},
+		cloudStack:     &cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String("UPDATE_COMPLETE")},
+		templateReader: reader,
+		uploader:       uploader,
+	}
+
+	plan, err := stack.Plan()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !cmp.Equal(plan, &Plan{Action: PlanNone}) {
+		t.Errorf("Unexpected plan: %v", plan)
+	}
+
+	reader.contents = "exports.handler = () => 42"
+	plan, err = stack.Plan()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !cmp.Equal(plan, &Plan{Action: PlanUpdate, Changes: []string{"template"}}) {
+		t.Errorf("Unexpected plan: %v", plan)
+	}
+
+	if len(uploader.objects) != 0 {
+		t.Errorf("Expected nothing to be uploaded, got: %v", uploader.objects)
+	}
+}
@@ -0,0 +1,138 @@
+package stackshot
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/pkg/errors"
+)
+
+// OwnerTagKey is the tag WithOwner() sets on every stack to record the
+// configuration repository managing it.
+const OwnerTagKey = "stackshot:managed-by"
+
+// OrphanedStack is a stack tagged as managed by an owner that none of the
+// owner's StackConfigs describe anymore.
+type OrphanedStack struct {
+	Name    string
+	StackId string
+	Status  string
+	Account string
+	Region  string
+
+	api cloudformationiface.CloudFormationAPI
+}
+
+// DeleteAndPollEvents deletes the orphaned stack and passes its StackEvents to
+// consumer until the stack is deleted.
+func (o *OrphanedStack) DeleteAndPollEvents(consumer EventConsumer) error {
+	stack, err := LoadStack(o.api, &StackConfig{Name: o.StackId})
+	if err != nil {
+		return err
+	}
+	return stack.DeleteAndPollEvents(consumer)
+}
+
+// FindOrphanedStacks searches every account and region configs target for
+// stacks tagged as managed by owner and returns the stacks configs don't
+// describe. Stacks are matched by account, region, and name, so a stack moved
+// to another region is orphaned in its old one.
+//
+// Only accounts and regions targeted by configs are searched. A StackConfig
+// without a Name adds an account and region to search without describing any
+// stacks, which finds stacks whose last configuration for a region was
+// removed.
+func FindOrphanedStacks(clients *Clients, owner string, configs []*StackConfig) ([]*OrphanedStack, error) {
+	if owner == "" {
+		return nil, errors.New("an owner is required to find orphaned stacks")
+	}
+
+	apis := map[Identity]cloudformationiface.CloudFormationAPI{}
+	described := map[Identity]map[string]bool{}
+	for _, config := range configs {
+		identity, err := clients.Identity(config)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := apis[*identity]; !ok {
+			api, err := clients.CloudFormation(config)
+			if err != nil {
+				return nil, err
+			}
+			apis[*identity] = api
+			described[*identity] = map[string]bool{}
+		}
+		if config.Name != "" {
+			described[*identity][config.Name] = true
+		}
+	}
+
+	identities := make([]Identity, 0, len(apis))
+	for identity := range apis {
+		identities = append(identities, identity)
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		if identities[i].Account != identities[j].Account {
+			return identities[i].Account < identities[j].Account
+		}
+		return identities[i].Region < identities[j].Region
+	})
+
+	orphans := []*OrphanedStack{}
+	for _, identity := range identities {
+		api := apis[identity]
+		stacks, err := ownedStacks(api, owner)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, stack := range stacks {
+			name := aws.StringValue(stack.StackName)
+			if described[identity][name] {
+				continue
+			}
+			orphans = append(orphans, &OrphanedStack{
+				Name:    name,
+				StackId: aws.StringValue(stack.StackId),
+				Status:  aws.StringValue(stack.StackStatus),
+				Account: identity.Account,
+				Region:  identity.Region,
+				api:     api,
+			})
+		}
+	}
+	return orphans, nil
+}
+
+// ownedStacks lists the stacks tagged as managed by owner, sorted by name.
+// Deleted stacks are skipped.
+func ownedStacks(api cloudformationiface.CloudFormationAPI, owner string) ([]*cloudformation.Stack, error) {
+	stacks := []*cloudformation.Stack{}
+	err := api.DescribeStacksPages(
+		&cloudformation.DescribeStacksInput{},
+		func(out *cloudformation.DescribeStacksOutput, lastPage bool) bool {
+			for _, stack := range out.Stacks {
+				if aws.StringValue(stack.StackStatus) == cloudformation.StackStatusDeleteComplete {
+					continue
+				}
+				for _, tag := range stack.Tags {
+					if aws.StringValue(tag.Key) == OwnerTagKey && aws.StringValue(tag.Value) == owner {
+						stacks = append(stacks, stack)
+						break
+					}
+				}
+			}
+			return !lastPage
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list stacks")
+	}
+
+	sort.Slice(stacks, func(i, j int) bool {
+		return aws.StringValue(stacks[i].StackName) < aws.StringValue(stacks[j].StackName)
+	})
+	return stacks, nil
+}
@@ -0,0 +1,211 @@
+package stackshot
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/google/go-cmp/cmp"
+)
+
+// MockSTS implements the stsiface.STSAPI interface for the account of a
+// profile.
+type MockSTS struct {
+	stsiface.STSAPI
+
+	Account string
+}
+
+func (m *MockSTS) GetCallerIdentity(input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{Account: aws.String(m.Account)}, nil
+}
+
+func ownedStack(name, owner, status string) *cfn.Stack {
+	stack := &cfn.Stack{
+		StackId:     aws.String("arn:" + name),
+		StackName:   aws.String(name),
+		StackStatus: aws.String(status),
+	}
+	if owner != "" {
+		stack.Tags = []*cfn.Tag{{Key: aws.String(OwnerTagKey), Value: aws.String(owner)}}
+	}
+	return stack
+}
+
+func TestFindOrphanedStacks(t *testing.T) {
+	// Stacks in each account and region. The default profile's account is
+	// 111111111111 and its region us-east-1.
+	stacks := map[Identity][]*cfn.Stack{
+		{Account: "111111111111", Region: "us-east-1"}: {
+			ownedStack("api", "infra-repo", "UPDATE_COMPLETE"),
+			ownedStack("old-worker", "infra-repo", "CREATE_COMPLETE"),
+			ownedStack("deleted", "infra-repo", "DELETE_COMPLETE"),
+			ownedStack("unowned", "", "CREATE_COMPLETE"),
+			ownedStack("other-repo", "other-repo", "CREATE_COMPLETE"),
+		},
+		{Account: "111111111111", Region: "eu-west-1"}: {
+			ownedStack("api", "infra-repo", "UPDATE_COMPLETE"),
+			ownedStack("cache", "infra-repo", "CREATE_COMPLETE"),
+		},
+		{Account: "222222222222", Region: "us-east-1"}: {
+			ownedStack("old-worker", "infra-repo", "CREATE_COMPLETE"),
+		},
+	}
+	accounts := map[string]string{"": "111111111111", "prod": "111111111111", "other": "222222222222"}
+
+	// Sessions carry their profile as the access key so the mocks can tell
+	// which account they belong to.
+	clients := newTestClients(map[string]int{})
+	newSession := clients.newSession
+	clients.newSession = func(profile, region string) (*session.Session, error) {
+		if region == "" {
+			region = "us-east-1"
+		}
+		return newSession(profile, region)
+	}
+	clients.newSTS = func(sess *session.Session) stsiface.STSAPI {
+		return &MockSTS{Account: accounts[sessionProfile(sess)]}
+	}
+	clients.newCloudFormation = func(sess *session.Session) cloudformationiface.CloudFormationAPI {
+		identity := Identity{Account: accounts[sessionProfile(sess)], Region: aws.StringValue(sess.Config.Region)}
+		api := &MockAPI{}
+		api.DescribeStacksPagesFn = func(input *cfn.DescribeStacksInput, fn func(*cfn.DescribeStacksOutput, bool) bool) error {
+			fn(&cfn.DescribeStacksOutput{Stacks: stacks[identity]}, true)
+			return nil
+		}
+		return api
+	}
+
+	configs := []*StackConfig{
+		// The default profile and region reach the same account and region
+		// as the prod profile in us-east-1.
+		{Name: "api"},
+		{Name: "api", Profile: "prod", Region: "eu-west-1"},
+		{Profile: "other", Region: "us-east-1"},
+	}
+
+	orphans, err := FindOrphanedStacks(clients, "infra-repo", configs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	found := []string{}
+	for _, orphan := range orphans {
+		found = append(found, orphan.Account+"/"+orphan.Region+"/"+orphan.Name+" "+orphan.Status)
+	}
+	expected := []string{
+		"111111111111/eu-west-1/cache CREATE_COMPLETE",
+		"111111111111/us-east-1/old-worker CREATE_COMPLETE",
+		"222222222222/us-east-1/old-worker CREATE_COMPLETE",
+	}
+	if !cmp.Equal(found, expected) {
+		t.Errorf("Unexpected orphans: %s", cmp.Diff(expected, found))
+	}
+
+	if _, err := FindOrphanedStacks(clients, "", configs); err == nil {
+		t.Errorf("Expected an error without an owner")
+	}
+}
+
+// sessionProfile returns the profile a session built by newTestClients() was
+// built for.
+func sessionProfile(sess *session.Session) string {
+	credentials, _ := sess.Config.Credentials.Get()
+	return credentials.AccessKeyID
+}
+
+func TestOwnerTag(t *testing.T) {
+	config := &StackConfig{
+		Name:        "mystack",
+		TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+		Tags:        map[string]string{"team": "platform"},
+	}
+
+	api := &MockAPI{}
+	stack := &Stack{api: api, config: config}
+	WithOwner("infra-repo")(stack)
+
+	input, err := stack.createStackInput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := []*cfn.Tag{
+		{Key: aws.String(OwnerTagKey), Value: aws.String("infra-repo")},
+		{Key: aws.String("team"), Value: aws.String("platform")},
+	}
+	if !cmp.Equal(input.Tags, expected) {
+		t.Errorf("Unexpected tags: %s", cmp.Diff(expected, input.Tags))
+	}
+
+	update, err := stack.updateStackInput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !cmp.Equal(update.Tags, expected) {
+		t.Errorf("Unexpected tags: %s", cmp.Diff(expected, update.Tags))
+	}
+
+	// Updating an owned stack without an owner keeps its ownership tag.
+	stack = &Stack{
+		api:    api,
+		config: config,
+		cloudStack: &cfn.Stack{
+			StackName: aws.String("mystack"),
+			Tags: []*cfn.Tag{
+				{Key: aws.String(OwnerTagKey), Value: aws.String("infra-repo")},
+				{Key: aws.String("team"), Value: aws.String("old-team")},
+			},
+		},
+	}
+	update, err = stack.updateStackInput()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !cmp.Equal(update.Tags, expected) {
+		t.Errorf("Unexpected tags: %s", cmp.Diff(expected, update.Tags))
+	}
+}
+
+func TestDeleteAndPollEvents(t *testing.T) {
+	tests := []struct {
+		status      string
+		shouldError bool
+	}{
+		{"DELETE_COMPLETE", false},
+		{"DELETE_FAILED", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.status, func(t *testing.T) {
+			deleted := ""
+			api := &MockAPI{}
+			api.DescribeStacksFn = GenDescribeStacksFn(ownedStack("mystack", "", test.status))
+			api.DeleteStackFn = func(input *cfn.DeleteStackInput) (*cfn.DeleteStackOutput, error) {
+				deleted = aws.StringValue(input.StackName)
+				return &cfn.DeleteStackOutput{}, nil
+			}
+
+			stack := &Stack{
+				api:          api,
+				config:       &StackConfig{Name: "mystack"},
+				cloudStack:   ownedStack("mystack", "", "CREATE_COMPLETE"),
+				eventLoader:  &stubEventLoader{},
+				waiter:       &impatientWaiter{},
+				waitAttempts: 3,
+			}
+
+			err := stack.DeleteAndPollEvents(EventConsumerFunc(func(*cfn.StackEvent) error { return nil }))
+			if test.shouldError != (err != nil) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if deleted != "arn:mystack" {
+				t.Errorf("Expected the stack to be deleted by id, got: %s", deleted)
+			}
+		})
+	}
+}
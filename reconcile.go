@@ -0,0 +1,255 @@
+package stackshot
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+)
+
+// Reconcile results reported in ReconcileStatus.Result.
+const (
+	ReconcilePending    = "pending"
+	ReconcileInProgress = "in_progress"
+	ReconcileUnchanged  = "unchanged"
+	ReconcileApplied    = "applied"
+	ReconcileFailed     = "failed"
+)
+
+// ReconcileStatus is the outcome of the last reconcile of a stack.
+type ReconcileStatus struct {
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+
+	// Plan is what the reconcile found to change. It's nil until the plan
+	// is computed.
+	Plan *Plan `json:"plan,omitempty"`
+
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+
+	// ClientRequestToken identifies the stack operation the reconcile
+	// started. It's empty when the stack wasn't synced.
+	ClientRequestToken string `json:"client_request_token,omitempty"`
+
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ReconcileReport is the state of a Reconciler: the outcome of the last
+// reconcile of every stack along with the last reconcile as a whole.
+type ReconcileReport struct {
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	// Error is set when the StackConfigs failed to load.
+	Error string `json:"error,omitempty"`
+
+	Stacks []*ReconcileStatus `json:"stacks"`
+}
+
+// Reconciler continuously syncs StackConfigs with their Cloudformation
+// Stacks. Every reconcile reloads the StackConfigs, plans each stack with
+// Stack.Plan(), and syncs the stacks with changes using SyncAndPollEvents().
+//
+// Reconciler implements http.Handler to serve its ReconcileReport as JSON.
+type Reconciler struct {
+	// Load returns the StackConfigs to reconcile. It's called at the start of
+	// every reconcile to pick up configuration changes.
+	Load func() ([]*StackConfig, error)
+
+	Clients *Clients
+
+	// Options are passed to LoadStack() for every stack.
+	Options []StackOption
+
+	// Events returns the EventConsumer a stack's events are passed to.
+	// Events are discarded when it's nil.
+	Events func(*StackConfig) EventConsumer
+
+	// Reconciled is called with the Reconciler's report after every
+	// reconcile run by Run() when it's set.
+	Reconciled func(*ReconcileReport)
+
+	mu     sync.Mutex
+	report ReconcileReport
+}
+
+// Run reconciles immediately and then every interval until stop is closed.
+func (r *Reconciler) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.ReconcileOnce()
+		if r.Reconciled != nil {
+			r.Reconciled(r.Report())
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReconcileOnce reconciles every StackConfig returned by Load one at a time.
+// Stacks deployed to several Regions are reconciled once per region. The
+// returned error is only set when the StackConfigs fail to load. The outcome
+// of each stack is in Report().
+func (r *Reconciler) ReconcileOnce() error {
+	started := time.Now()
+	r.mu.Lock()
+	r.report.StartedAt, r.report.FinishedAt, r.report.Error = &started, nil, ""
+	r.mu.Unlock()
+
+	configs, err := r.load()
+	if err != nil {
+		finished := time.Now()
+		r.mu.Lock()
+		r.report.FinishedAt, r.report.Error = &finished, err.Error()
+		r.mu.Unlock()
+		return err
+	}
+
+	// Keep the previous outcome of every stack until it's reconciled again.
+	previous := map[string]*ReconcileStatus{}
+	for _, status := range r.Report().Stacks {
+		previous[status.Region+"/"+status.Name] = status
+	}
+	statuses := make([]*ReconcileStatus, len(configs))
+	for i, config := range configs {
+		status, ok := previous[config.Region+"/"+config.Name]
+		if !ok {
+			status = &ReconcileStatus{Name: config.Name, Region: config.Region, Result: ReconcilePending}
+		}
+		statuses[i] = status
+	}
+	r.mu.Lock()
+	r.report.Stacks = statuses
+	r.mu.Unlock()
+
+	for i, config := range configs {
+		now := time.Now()
+		r.setStatus(i, &ReconcileStatus{
+			Name:      config.Name,
+			Region:    config.Region,
+			Result:    ReconcileInProgress,
+			StartedAt: &now,
+		})
+
+		status := r.reconcile(config)
+		status.StartedAt = &now
+		finished := time.Now()
+		status.FinishedAt = &finished
+		r.setStatus(i, status)
+	}
+
+	finished := time.Now()
+	r.mu.Lock()
+	r.report.FinishedAt = &finished
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Reconciler) load() ([]*StackConfig, error) {
+	configs, err := r.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load stack configurations")
+	}
+
+	expanded := []*StackConfig{}
+	for _, config := range configs {
+		expanded = append(expanded, config.ExpandRegions()...)
+	}
+	return expanded, nil
+}
+
+// reconcile plans and, when needed, syncs a single stack.
+func (r *Reconciler) reconcile(config *StackConfig) *ReconcileStatus {
+	status := &ReconcileStatus{Name: config.Name, Region: config.Region}
+	fail := func(err error) *ReconcileStatus {
+		status.Result = ReconcileFailed
+		status.Error = err.Error()
+		return status
+	}
+
+	api, err := r.Clients.CloudFormation(config)
+	if err != nil {
+		return fail(err)
+	}
+	uploader, err := r.Clients.Uploader(config)
+	if err != nil {
+		return fail(err)
+	}
+
+	options := append([]StackOption{WithUploader(uploader)}, r.Options...)
+	stack, err := LoadStack(api, config, options...)
+	if err != nil {
+		return fail(err)
+	}
+
+	status.Plan, err = stack.Plan()
+	if err != nil {
+		return fail(err)
+	}
+	if status.Plan.Action == PlanNone {
+		status.Result = ReconcileUnchanged
+		return status
+	}
+
+	consumer := EventConsumer(EventConsumerFunc(discardEvent))
+	if r.Events != nil {
+		consumer = r.Events(config)
+	}
+
+	err = stack.SyncAndPollEvents(consumer)
+	status.ClientRequestToken = stack.ClientRequestToken()
+	if awsErr, ok := errors.Cause(err).(awserr.Error); ok && NoStackUpdatesToPerform(awsErr) {
+		status.Result = ReconcileUnchanged
+		return status
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	status.Result = ReconcileApplied
+	return status
+}
+
+func (r *Reconciler) setStatus(i int, status *ReconcileStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Stacks[i] = status
+}
+
+// Report returns a copy of the Reconciler's current state.
+func (r *Reconciler) Report() *ReconcileReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := r.report
+	report.Stacks = make([]*ReconcileStatus, len(r.report.Stacks))
+	for i, status := range r.report.Stacks {
+		s := *status
+		report.Stacks[i] = &s
+	}
+	return &report
+}
+
+// ServeHTTP responds with the Reconciler's ReconcileReport as JSON.
+func (r *Reconciler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(r.Report())
+}
+
+func discardEvent(*cloudformation.StackEvent) error {
+	return nil
+}
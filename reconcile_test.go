@@ -0,0 +1,139 @@
+package stackshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pkg/errors"
+)
+
+func TestReconciler(t *testing.T) {
+	template := "Resources:\n  Bucket:\n    Type: AWS::S3::Bucket\n"
+	deployed := map[string]*cfn.Stack{
+		"api": {
+			StackId:     aws.String("arn:api"),
+			StackName:   aws.String("api"),
+			StackStatus: aws.String("UPDATE_COMPLETE"),
+		},
+	}
+
+	api := &MockAPI{}
+	api.DescribeStacksFn = func(input *cfn.DescribeStacksInput) (*cfn.DescribeStacksOutput, error) {
+		name := aws.StringValue(input.StackName)
+		if name == "broken" {
+			return nil, awserr.New("AccessDenied", "not allowed", nil)
+		}
+		for _, stack := range deployed {
+			if aws.StringValue(stack.StackName) == name || aws.StringValue(stack.StackId) == name {
+				return &cfn.DescribeStacksOutput{Stacks: []*cfn.Stack{stack}}, nil
+			}
+		}
+		return nil, awserr.New("ValidationError", fmt.Sprintf(stackDoesNotExistErrorFmt, name), nil)
+	}
+	api.GetTemplateFn = GenGetTemplateFn(template)
+	created := []string{}
+	api.CreateStackFn = func(input *cfn.CreateStackInput) (*cfn.CreateStackOutput, error) {
+		name := aws.StringValue(input.StackName)
+		created = append(created, name)
+		deployed[name] = &cfn.Stack{
+			StackId:     aws.String("arn:" + name),
+			StackName:   aws.String(name),
+			StackStatus: aws.String("CREATE_COMPLETE"),
+		}
+		return &cfn.CreateStackOutput{StackId: aws.String("arn:" + name)}, nil
+	}
+
+	clients := newTestClients(map[string]int{})
+	clients.newCloudFormation = func(*session.Session) cloudformationiface.CloudFormationAPI {
+		return api
+	}
+
+	configs := []*StackConfig{
+		{Name: "api", TemplateBody: templateBody(template)},
+		{Name: "web", TemplateBody: templateBody(template)},
+		{Name: "broken", TemplateBody: templateBody(template)},
+	}
+	var loadErr error
+	events := 0
+	reconciler := &Reconciler{
+		Load:    func() ([]*StackConfig, error) { return configs, loadErr },
+		Clients: clients,
+		Options: []StackOption{func(s *Stack) {
+			s.eventLoader = &stubEventLoader{}
+			s.waiter = &impatientWaiter{}
+		}},
+		Events: func(*StackConfig) EventConsumer {
+			return EventConsumerFunc(func(*cfn.StackEvent) error {
+				events++
+				return nil
+			})
+		},
+	}
+
+	results := func() []string {
+		found := []string{}
+		for _, status := range reconciler.Report().Stacks {
+			result := status.Name + " " + status.Result
+			if status.Error != "" {
+				result += ": " + status.Error
+			}
+			found = append(found, result)
+		}
+		return found
+	}
+
+	if err := reconciler.ReconcileOnce(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := []string{"api unchanged", "web applied", "broken failed: AccessDenied: not allowed"}
+	if found := results(); !cmp.Equal(found, expected) {
+		t.Errorf("Unexpected results: %s", cmp.Diff(expected, found))
+	}
+	if !cmp.Equal(created, []string{"web"}) {
+		t.Errorf("Expected only web to be created, got: %v", created)
+	}
+	if events == 0 {
+		t.Errorf("Expected web's events to be consumed")
+	}
+
+	// The second reconcile finds nothing to change and forgets stacks that
+	// were removed from the configurations.
+	configs = configs[:2]
+	if err := reconciler.ReconcileOnce(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected = []string{"api unchanged", "web unchanged"}
+	if found := results(); !cmp.Equal(found, expected) {
+		t.Errorf("Unexpected results: %s", cmp.Diff(expected, found))
+	}
+
+	// Failing to load keeps the previous results.
+	loadErr = errors.New("bad yaml")
+	if err := reconciler.ReconcileOnce(); err == nil {
+		t.Errorf("Expected an error when configurations fail to load")
+	}
+	if found := results(); !cmp.Equal(found, expected) {
+		t.Errorf("Unexpected results: %s", cmp.Diff(expected, found))
+	}
+
+	recorder := httptest.NewRecorder()
+	reconciler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	report := &ReconcileReport{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), report); err != nil {
+		t.Fatalf("Failed to decode report: %s", err)
+	}
+	if report.Error != "failed to load stack configurations: bad yaml" {
+		t.Errorf("Unexpected report error: %s", report.Error)
+	}
+	if len(report.Stacks) != 2 || report.Stacks[1].FinishedAt == nil {
+		t.Errorf("Unexpected report stacks: %+v", report.Stacks)
+	}
+}
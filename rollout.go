@@ -0,0 +1,174 @@
+package stackshot
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"text/tabwriter"
+)
+
+// RegionOverride holds settings that replace a StackConfig's settings in a
+// single region.
+type RegionOverride struct {
+	// Parameters are merged over the StackConfig's parameters.
+	Parameters map[string]ParameterValue
+
+	// TemplateBucket replaces the StackConfig's TemplateBucket, which is
+	// needed for artifacts, like Lambda code, that must be in a bucket within
+	// the stack's region.
+	TemplateBucket string
+}
+
+// RolloutConfig controls how a StackConfig with Regions is deployed.
+type RolloutConfig struct {
+	// WaveSize is the number of regions deployed concurrently. Regions are
+	// deployed one at a time when it's zero or one.
+	WaveSize int
+
+	// FailureTolerance is the number of regions that may fail before the
+	// regions in later waves are skipped.
+	FailureTolerance int
+}
+
+// ExpandRegions returns a StackConfig for every region in Regions with
+// Region set and the region's overrides applied, in the order Regions lists
+// them. A StackConfig without Regions is returned as is.
+func (s *StackConfig) ExpandRegions() []*StackConfig {
+	if len(s.Regions) == 0 {
+		return []*StackConfig{s}
+	}
+
+	configs := make([]*StackConfig, 0, len(s.Regions))
+	for _, region := range s.Regions {
+		config := *s
+		config.Region = region
+		config.Regions = nil
+		config.RegionOverrides = nil
+
+		override := s.RegionOverrides[region]
+		if len(override.Parameters) > 0 {
+			config.Parameters = make(map[string]ParameterValue, len(s.Parameters)+len(override.Parameters))
+			for key, value := range s.Parameters {
+				config.Parameters[key] = value
+			}
+			for key, value := range override.Parameters {
+				config.Parameters[key] = value
+			}
+		}
+		if override.TemplateBucket != "" {
+			config.TemplateBucket = override.TemplateBucket
+		}
+
+		configs = append(configs, &config)
+	}
+	return configs
+}
+
+// RegionResult is the outcome of deploying a stack to a single region.
+type RegionResult struct {
+	Region string
+
+	// Err is the error deploying to the region returned, if any.
+	Err error
+
+	// Skipped denotes the region wasn't deployed to because too many regions
+	// failed before it.
+	Skipped bool
+}
+
+func (r RegionResult) String() string {
+	switch {
+	case r.Skipped:
+		return "skipped"
+	case r.Err != nil:
+		return fmt.Sprintf("failed: %s", r.Err)
+	default:
+		return "succeeded"
+	}
+}
+
+// RolloutReport is the combined outcome of deploying a stack to each of its
+// regions.
+type RolloutReport struct {
+	Name    string
+	Results []RegionResult
+}
+
+// Failed returns the number of regions that failed or were skipped.
+func (r *RolloutReport) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if result.Err != nil || result.Skipped {
+			failed++
+		}
+	}
+	return failed
+}
+
+func (r *RolloutReport) String() string {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "Rollout of %s: %d of %d regions succeeded\n", r.Name, len(r.Results)-r.Failed(), len(r.Results))
+
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	for _, result := range r.Results {
+		fmt.Fprintf(w, "  %s\t%s\n", result.Region, result)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// RollOut deploys config to each of its regions with deploy, following
+// config.Rollout. Regions are deployed in waves of Rollout.WaveSize regions
+// which run concurrently. Once more than Rollout.FailureTolerance regions have
+// failed, the remaining waves are skipped.
+//
+// deploy is called with the StackConfigs returned by ExpandRegions() and
+// must be safe to call concurrently when WaveSize is greater than one.
+func RollOut(config *StackConfig, deploy func(*StackConfig) error) *RolloutReport {
+	configs := config.ExpandRegions()
+	report := &RolloutReport{
+		Name:    config.Name,
+		Results: make([]RegionResult, len(configs)),
+	}
+	for i, c := range configs {
+		report.Results[i].Region = c.Region
+	}
+
+	waveSize := config.Rollout.WaveSize
+	if waveSize < 1 {
+		waveSize = 1
+	}
+
+	failed := 0
+	for start := 0; start < len(configs); start += waveSize {
+		end := start + waveSize
+		if end > len(configs) {
+			end = len(configs)
+		}
+
+		if failed > config.Rollout.FailureTolerance {
+			for i := start; i < end; i++ {
+				report.Results[i].Skipped = true
+			}
+			continue
+		}
+
+		wg := sync.WaitGroup{}
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				report.Results[i].Err = deploy(configs[i])
+			}(i)
+		}
+		wg.Wait()
+
+		for i := start; i < end; i++ {
+			if report.Results[i].Err != nil {
+				failed++
+			}
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,192 @@
+package stackshot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandRegions(t *testing.T) {
+	config := &StackConfig{
+		Name:           "mystack",
+		TemplateURL:    "https://example.com/template.yaml",
+		TemplateBucket: "templates",
+		Parameters: map[string]ParameterValue{
+			"InstanceType": {Value: "t3.micro"},
+			"Env":          {Value: "production"},
+		},
+		Regions: []string{"us-east-1", "eu-west-1"},
+		RegionOverrides: map[string]RegionOverride{
+			"eu-west-1": {
+				Parameters:     map[string]ParameterValue{"InstanceType": {Value: "t3.small"}},
+				TemplateBucket: "templates-eu-west-1",
+			},
+		},
+	}
+
+	expected := []*StackConfig{
+		{
+			Name:           "mystack",
+			TemplateURL:    "https://example.com/template.yaml",
+			TemplateBucket: "templates",
+			Region:         "us-east-1",
+			Parameters: map[string]ParameterValue{
+				"InstanceType": {Value: "t3.micro"},
+				"Env":          {Value: "production"},
+			},
+		},
+		{
+			Name:           "mystack",
+			TemplateURL:    "https://example.com/template.yaml",
+			TemplateBucket: "templates-eu-west-1",
+			Region:         "eu-west-1",
+			Parameters: map[string]ParameterValue{
+				"InstanceType": {Value: "t3.small"},
+				"Env":          {Value: "production"},
+			},
+		},
+	}
+
+	configs := config.ExpandRegions()
+	if !cmp.Equal(configs, expected) {
+		t.Errorf("Unexpected configs: %s", cmp.Diff(expected, configs))
+	}
+
+	if config.Parameters["InstanceType"].Value != "t3.micro" {
+		t.Errorf("ExpandRegions() modified the original parameters")
+	}
+
+	single := &StackConfig{Name: "mystack", Region: "us-west-2"}
+	if configs := single.ExpandRegions(); len(configs) != 1 || configs[0] != single {
+		t.Errorf("Expected a config without Regions to be returned as is, got: %v", configs)
+	}
+}
+
+func TestRollOut(t *testing.T) {
+	regions := []string{"r1", "r2", "r3", "r4", "r5"}
+
+	tests := []struct {
+		description string
+		rollout     RolloutConfig
+		failing     map[string]bool
+		expected    []string
+		waves       [][]string
+	}{
+		{
+			description: "sequential",
+			expected:    []string{"succeeded", "succeeded", "succeeded", "succeeded", "succeeded"},
+			waves:       [][]string{{"r1"}, {"r2"}, {"r3"}, {"r4"}, {"r5"}},
+		},
+		{
+			description: "sequential stops at the first failure",
+			failing:     map[string]bool{"r2": true},
+			expected:    []string{"succeeded", "failed: r2 failed", "skipped", "skipped", "skipped"},
+			waves:       [][]string{{"r1"}, {"r2"}},
+		},
+		{
+			description: "waves",
+			rollout:     RolloutConfig{WaveSize: 2},
+			expected:    []string{"succeeded", "succeeded", "succeeded", "succeeded", "succeeded"},
+			waves:       [][]string{{"r1", "r2"}, {"r3", "r4"}, {"r5"}},
+		},
+		{
+			description: "waves finish before stopping",
+			rollout:     RolloutConfig{WaveSize: 2},
+			failing:     map[string]bool{"r1": true},
+			expected:    []string{"failed: r1 failed", "succeeded", "skipped", "skipped", "skipped"},
+			waves:       [][]string{{"r1", "r2"}},
+		},
+		{
+			description: "failures within tolerance",
+			rollout:     RolloutConfig{WaveSize: 2, FailureTolerance: 1},
+			failing:     map[string]bool{"r1": true, "r4": true},
+			expected:    []string{"failed: r1 failed", "succeeded", "succeeded", "failed: r4 failed", "skipped"},
+			waves:       [][]string{{"r1", "r2"}, {"r3", "r4"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			config := &StackConfig{Name: "mystack", Regions: regions, Rollout: test.rollout}
+
+			waveSize := test.rollout.WaveSize
+			if waveSize < 1 {
+				waveSize = 1
+			}
+
+			// Waves run one after another, so every waveSize deploys start
+			// a new wave.
+			mu := sync.Mutex{}
+			waves := [][]string{}
+			wave := -1
+			deployed := 0
+			report := RollOut(config, func(c *StackConfig) error {
+				mu.Lock()
+				if deployed%waveSize == 0 {
+					waves = append(waves, []string{})
+					wave++
+				}
+				deployed++
+				waves[wave] = append(waves[wave], c.Region)
+				mu.Unlock()
+
+				if test.failing[c.Region] {
+					return errors.New(c.Region + " failed")
+				}
+				return nil
+			})
+
+			outcomes := []string{}
+			for i, result := range report.Results {
+				if result.Region != regions[i] {
+					t.Errorf("Expected result #%d to be for %s, got %s", i, regions[i], result.Region)
+				}
+				outcomes = append(outcomes, result.String())
+			}
+			if !cmp.Equal(outcomes, test.expected) {
+				t.Errorf("Unexpected results: %s", cmp.Diff(test.expected, outcomes))
+			}
+
+			for _, w := range waves {
+				sort.Strings(w)
+			}
+			if !cmp.Equal(waves, test.waves) {
+				t.Errorf("Unexpected waves: %s", cmp.Diff(test.waves, waves))
+			}
+
+			failed := 0
+			for _, outcome := range test.expected {
+				if outcome != "succeeded" {
+					failed++
+				}
+			}
+			if report.Failed() != failed {
+				t.Errorf("Expected %d failed regions, got %d", failed, report.Failed())
+			}
+		})
+	}
+}
+
+func TestRolloutReportString(t *testing.T) {
+	report := &RolloutReport{
+		Name: "mystack",
+		Results: []RegionResult{
+			{Region: "us-east-1"},
+			{Region: "ap-southeast-2", Err: fmt.Errorf("stack failed")},
+			{Region: "eu-west-1", Skipped: true},
+		},
+	}
+
+	expected := `Rollout of mystack: 1 of 3 regions succeeded
+  us-east-1       succeeded
+  ap-southeast-2  failed: stack failed
+  eu-west-1       skipped
+`
+	if report.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, report.String())
+	}
+}
@@ -1,8 +1,16 @@
 package stackshot
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -37,6 +45,15 @@ var stackDoneStatuses = map[string]bool{
 	"DELETE_FAILED":            false,
 	"ROLLBACK_FAILED":          false,
 	"ROLLBACK_COMPLETE":        false,
+	"IMPORT_COMPLETE":          true,
+	"IMPORT_ROLLBACK_COMPLETE": false,
+	"IMPORT_ROLLBACK_FAILED":   false,
+}
+
+// stackDeletedStatuses are the statuses of a stack that finished deleting.
+var stackDeletedStatuses = map[string]bool{
+	"DELETE_COMPLETE": true,
+	"DELETE_FAILED":   false,
 }
 
 // EventConsumer is an interface used by Stack.SyncAndPollEvents() to consume
@@ -68,30 +85,122 @@ func sleepWaiter() {
 // EventPrinter implements EventConsumer interface to print
 // cloudformation.StackEvent to stdout.
 func EventPrinter(event *cloudformation.StackEvent) error {
-	fmt.Printf(
-		"%s %s(%s) %s %s\n",
+	fmt.Println(formatEvent(event))
+	return nil
+}
+
+// PrefixedEventPrinter returns an EventConsumer that prints events like
+// EventPrinter() with prefix at the start of each line. It tells apart the
+// events of stacks deployed concurrently.
+func PrefixedEventPrinter(prefix string) EventConsumer {
+	return EventConsumerFunc(func(event *cloudformation.StackEvent) error {
+		fmt.Println(prefix + formatEvent(event))
+		return nil
+	})
+}
+
+// eventJSON is the line EventJSONPrinter() writes for each event.
+type eventJSON struct {
+	Timestamp            *time.Time `json:"timestamp"`
+	StackName            string     `json:"stack_name"`
+	StackId              string     `json:"stack_id"`
+	EventId              string     `json:"event_id"`
+	LogicalResourceId    string     `json:"logical_resource_id"`
+	PhysicalResourceId   string     `json:"physical_resource_id,omitempty"`
+	ResourceType         string     `json:"resource_type"`
+	ResourceStatus       string     `json:"resource_status"`
+	ResourceStatusReason string     `json:"resource_status_reason,omitempty"`
+	ClientRequestToken   string     `json:"client_request_token,omitempty"`
+}
+
+// EventJSONPrinter returns an EventConsumer that writes each event to w as a
+// line of JSON, for tools like jq.
+func EventJSONPrinter(w io.Writer) EventConsumer {
+	encoder := json.NewEncoder(w)
+	return EventConsumerFunc(func(event *cloudformation.StackEvent) error {
+		return encoder.Encode(&eventJSON{
+			Timestamp:            event.Timestamp,
+			StackName:            aws.StringValue(event.StackName),
+			StackId:              aws.StringValue(event.StackId),
+			EventId:              aws.StringValue(event.EventId),
+			LogicalResourceId:    aws.StringValue(event.LogicalResourceId),
+			PhysicalResourceId:   aws.StringValue(event.PhysicalResourceId),
+			ResourceType:         aws.StringValue(event.ResourceType),
+			ResourceStatus:       aws.StringValue(event.ResourceStatus),
+			ResourceStatusReason: aws.StringValue(event.ResourceStatusReason),
+			ClientRequestToken:   aws.StringValue(event.ClientRequestToken),
+		})
+	})
+}
+
+func formatEvent(event *cloudformation.StackEvent) string {
+	return fmt.Sprintf(
+		"%s %s(%s) %s %s",
 		event.Timestamp,
 		aws.StringValue(event.LogicalResourceId),
 		aws.StringValue(event.ResourceType),
 		aws.StringValue(event.ResourceStatus),
 		aws.StringValue(event.ResourceStatusReason),
 	)
-	return nil
 }
 
+// localFileReader reads the local files a stack's configuration refers to:
+// its template, its stack policy, and the artifacts packaged with the
+// template.
 type localFileReader interface {
 	ReadFile(string) ([]byte, error)
+	Stat(string) (os.FileInfo, error)
+	ReadDir(string) ([]os.FileInfo, error)
 }
 
-type fileReaderFunc func(string) ([]byte, error)
+// osFileReader implements localFileReader with the local filesystem.
+type osFileReader struct{}
 
-func (f fileReaderFunc) ReadFile(filepath string) ([]byte, error) {
-	return f(filepath)
+func (osFileReader) ReadFile(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func (osFileReader) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (osFileReader) ReadDir(path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+// StackOption configures optional behavior of a Stack allocated by
+// LoadStack().
+type StackOption func(*Stack)
+
+// WithUploader sets the Uploader used to upload templates larger than
+// Cloudformation's TemplateBody limit to StackConfig.TemplateBucket.
+func WithUploader(uploader Uploader) StackOption {
+	return func(s *Stack) {
+		s.uploader = uploader
+	}
+}
+
+// WithStackPolicyDuringUpdate sets a temporary stack policy that overrides
+// the stack's policy for the duration of the next update only. policy is a
+// JSON stack policy document.
+func WithStackPolicyDuringUpdate(policy string) StackOption {
+	return func(s *Stack) {
+		s.stackPolicyDuringUpdate = policy
+	}
+}
+
+// WithOwner tags the stack with OwnerTagKey set to owner when it's created or
+// updated. owner identifies the configuration repository managing the stack so
+// stacks removed from the repository can be found with FindOrphanedStacks().
+func WithOwner(owner string) StackOption {
+	return func(s *Stack) {
+		s.owner = owner
+	}
 }
 
 // LoadStack allocates a new Stack used to synchronize a StackConfig's
 // configuration with a new or existing Cloudformation Stack.
-func LoadStack(api cloudformationiface.CloudFormationAPI, config *StackConfig) (*Stack, error) {
+func LoadStack(api cloudformationiface.CloudFormationAPI, config *StackConfig, options ...StackOption) (*Stack, error) {
 	stack := &Stack{
 		api:          api,
 		config:       config,
@@ -102,10 +211,20 @@ func LoadStack(api cloudformationiface.CloudFormationAPI, config *StackConfig) (
 			stackName: aws.String(config.Name),
 		},
 
-		templateReader: fileReaderFunc(ioutil.ReadFile),
+		templateReader: osFileReader{},
+	}
+
+	notifiers, err := configNotifiers(config)
+	if err != nil {
+		return nil, err
+	}
+	stack.notifiers = notifiers
+
+	for _, option := range options {
+		option(stack)
 	}
 
-	err := stack.load()
+	err = stack.load()
 	if err == nil {
 		err = stack.storeLastEvent()
 	}
@@ -133,11 +252,41 @@ type Stack struct {
 	api            cloudformationiface.CloudFormationAPI
 	config         *StackConfig
 	templateReader localFileReader
+	uploader       Uploader
+
+	stackPolicyDuringUpdate string
+	owner                   string
+	metrics                 *Metrics
+	locker                  Locker
+	lockInfo                LockInfo
+	hookOutput              io.Writer
+	hookPrefix              string
+	notifiers               []Notifier
+
+	// notified is closed once the last notification queued by notify() has
+	// been sent.
+	notified chan struct{}
+
+	// requestToken is the ClientRequestToken of the last operation started
+	// on the stack.
+	requestToken string
 
 	waiter       waiter
 	waitAttempts int
 }
 
+// region returns the region the stack is deployed to: its configured Region,
+// or otherwise the region of the client it's managed with.
+func (s *Stack) region() string {
+	if s.config.Region != "" {
+		return s.config.Region
+	}
+	if client, ok := s.api.(*cloudformation.CloudFormation); ok {
+		return aws.StringValue(client.Config.Region)
+	}
+	return ""
+}
+
 func (s *Stack) load() error {
 	input := cloudformation.DescribeStacksInput{}
 	if s.cloudStack == nil {
@@ -193,6 +342,8 @@ func (s *Stack) storeLastEvent() error {
 // Cloudformation Stack does not exist, Sync will create a new Cloudformation
 // Stack. If the Cloudformation Stack does exist, then Sync will update the
 // Cloudformation Stack.
+//
+// Every Sync sends a new ClientRequestToken, see ClientRequestToken().
 func (s *Stack) Sync() error {
 	if s.cloudStack == nil {
 		return s.createStack()
@@ -201,11 +352,68 @@ func (s *Stack) Sync() error {
 	}
 }
 
+// ClientRequestToken returns the token sent with the last operation stackshot
+// started on the stack, or an empty string when it hasn't started any or
+// Cloudformation rejected the last one. Every event caused by the operation
+// carries the token.
+func (s *Stack) ClientRequestToken() string {
+	return s.requestToken
+}
+
+// newClientRequestToken returns a unique token identifying a single
+// operation on a stack.
+func newClientRequestToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand doesn't fail on supported platforms; fall back to the
+		// clock rather than sending no token at all.
+		return fmt.Sprintf("stackshot-%d", time.Now().UnixNano())
+	}
+	return "stackshot-" + hex.EncodeToString(b)
+}
+
+// startOperation starts an operation on the stack by calling send with a new
+// ClientRequestToken. Once Cloudformation accepts the operation, the token is
+// exposed by ClientRequestToken() and only the operation's events are polled.
+// A rejected operation leaves the stack without a token.
+func (s *Stack) startOperation(send func(token *string) error) error {
+	s.setRequestToken("")
+	token := newClientRequestToken()
+	if err := send(aws.String(token)); err != nil {
+		return err
+	}
+	s.setRequestToken(token)
+	return nil
+}
+
+// setRequestToken records the ClientRequestToken of the stack's current
+// operation. Events are filtered by it, or not at all when it's empty.
+func (s *Stack) setRequestToken(token string) {
+	s.requestToken = token
+	if s.eventLoader != nil {
+		s.eventLoader.setClientRequestToken(token)
+	}
+}
+
 func (s *Stack) waitUntilDone(consumer EventConsumer) error {
+	return s.waitForStatus(consumer, stackDoneStatuses)
+}
+
+// waitForStatus polls the stack, passing its events to consumer, until it
+// reaches one of doneStatuses. doneStatuses maps statuses to whether they
+// denote success.
+func (s *Stack) waitForStatus(consumer EventConsumer, doneStatuses map[string]bool) error {
 	var status string
 	var attempts int
 
+	polls := 0
+	consumer = s.metrics.countEvents(s.config.Name, s.region(), consumer)
+	defer func() {
+		s.metrics.observePolls(s.config.Name, s.region(), polls)
+	}()
+
 	for attempts = 0; attempts < s.waitAttempts; attempts++ {
+		polls++
 		err := s.load()
 		if err != nil {
 			return err
@@ -219,7 +427,7 @@ func (s *Stack) waitUntilDone(consumer EventConsumer) error {
 		}
 
 		status = aws.StringValue(s.cloudStack.StackStatus)
-		if _, ok := stackDoneStatuses[status]; ok {
+		if _, ok := doneStatuses[status]; ok {
 			break
 		}
 
@@ -234,7 +442,7 @@ func (s *Stack) waitUntilDone(consumer EventConsumer) error {
 		)
 	}
 
-	isSuccess := stackDoneStatuses[status]
+	isSuccess := doneStatuses[status]
 	if !isSuccess {
 		return errors.New(fmt.Sprintf("stacked failed to complete. status: %s", status))
 	}
@@ -247,24 +455,79 @@ func (s *Stack) waitUntilDone(consumer EventConsumer) error {
 // updating a Cloudformation Stack.
 //
 // StackEvents passed to consumer appear in chronological order.
-func (s *Stack) SyncAndPollEvents(consumer EventConsumer) error {
-	err := s.Sync()
+//
+// When the Stack has a Locker, the stack's lock is held from before syncing
+// until the stack finishes. The StackConfig's Hooks run while the lock is
+// held.
+//
+// Notifiers are told when the stack starts updating, when the first resource
+// fails, and when the stack finishes, including when it fails before starting,
+// e.g. because it's locked.
+func (s *Stack) SyncAndPollEvents(consumer EventConsumer) (err error) {
+	creating, started := s.cloudStack == nil, time.Now()
+	defer func() {
+		s.metrics.observeSync(s.config.Name, s.region(), creating, started, err)
+		s.notifyOutcome(err)
+	}()
+
+	unlock, err := s.lock()
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+	creating = s.cloudStack == nil
 
-	err = s.waitUntilDone(consumer)
+	err = s.runHooks(HookPreSync, s.config.Hooks.PreSync, "", nil)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	err = s.Sync()
+	if err == nil {
+		s.notify(NotifyStarted, nil)
+		err = s.waitUntilDone(s.notifyFirstFailure(consumer))
+	}
+	return s.runPostHooks(err)
+}
+
+// DeleteAndPollEvents deletes the Cloudformation Stack and then polls for
+// StackEvents to pass to consumer until the stack is deleted.
+func (s *Stack) DeleteAndPollEvents(consumer EventConsumer) error {
+	if s.cloudStack == nil {
+		return fmt.Errorf(stackDoesNotExistErrorFmt, s.config.Name)
+	}
+
+	err := s.startOperation(func(token *string) error {
+		_, err := s.api.DeleteStack(
+			&cloudformation.DeleteStackInput{
+				StackName:          s.cloudStack.StackId,
+				ClientRequestToken: token,
+			},
+		)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to delete stack")
+	}
+
+	return s.waitForStatus(consumer, stackDeletedStatuses)
 }
 
 func (s *Stack) createStack() error {
 	input, err := s.createStackInput()
 	if err == nil {
-		_, err = s.api.CreateStack(input)
+		err = s.validateTemplate(input.TemplateBody, input.TemplateURL)
+	}
+	if err == nil {
+		err = s.startOperation(func(token *string) error {
+			input.ClientRequestToken = token
+			_, err := s.api.CreateStack(input)
+			return err
+		})
 	}
 
 	if err != nil {
@@ -280,18 +543,16 @@ func (s *Stack) createStackInput() (*cloudformation.CreateStackInput, error) {
 		EnableTerminationProtection: aws.Bool(s.config.EnableTerminationProtection),
 	}
 
-	if s.config.TemplateURL != "" {
-		input.TemplateURL = aws.String(s.config.TemplateURL)
-	} else if s.config.TemplatePath != "" {
-		body, err := s.templateReader.ReadFile(s.config.TemplatePath)
-		if err != nil {
-			return nil, err
-		}
-		input.TemplateBody = aws.String(string(body))
-	} else {
-		input.TemplateBody = aws.String(string(s.config.TemplateBody))
+	if s.config.UsePreviousTemplate {
+		return nil, fmt.Errorf("UsePreviousTemplate cannot be used to create stack %s", s.config.Name)
 	}
 
+	body, url, err := s.template()
+	if err != nil {
+		return nil, err
+	}
+	input.TemplateBody, input.TemplateURL = body, url
+
 	// TODO: Validate this before making the API request
 	// The cloudformation API only allows setting either OnFailure or
 	// DisableRollback. But not together.
@@ -306,40 +567,49 @@ func (s *Stack) createStackInput() (*cloudformation.CreateStackInput, error) {
 		input.DisableRollback = aws.Bool(s.config.DisableRollback)
 	}
 
-	if len(s.config.Parameters) > 0 {
-		input.Parameters = make([]*cloudformation.Parameter, 0, len(s.config.Parameters))
-		for k, v := range s.config.Parameters {
-			input.Parameters = append(
-				input.Parameters,
-				&cloudformation.Parameter{
-					ParameterKey:   aws.String(k),
-					ParameterValue: aws.String(v),
-				},
-			)
-		}
+	input.Parameters, err = s.parameters(true)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(s.config.Tags) > 0 {
-		input.Tags = make([]*cloudformation.Tag, 0, len(s.config.Tags))
-		for k, v := range s.config.Tags {
-			input.Tags = append(
-				input.Tags,
-				&cloudformation.Tag{Key: aws.String(k), Value: aws.String(v)},
-			)
-		}
-	}
+	input.Tags = s.tags()
 
 	if len(s.config.Capabilities) > 0 {
 		input.Capabilities = aws.StringSlice(s.config.Capabilities)
 	}
 
+	policy, err := s.stackPolicyBody()
+	if err != nil {
+		return nil, err
+	}
+	if policy != "" {
+		input.StackPolicyBody = aws.String(policy)
+	}
+
 	return &input, nil
 }
 
 func (s *Stack) updateStack() error {
+	err := s.syncStackPolicy()
+	if err != nil {
+		return errors.Wrap(err, "failed to set stack policy")
+	}
+
+	err = s.syncTerminationProtection()
+	if err != nil {
+		return errors.Wrap(err, "failed to update termination protection")
+	}
+
 	input, err := s.updateStackInput()
 	if err == nil {
-		_, err = s.api.UpdateStack(input)
+		err = s.validateTemplate(input.TemplateBody, input.TemplateURL)
+	}
+	if err == nil {
+		err = s.startOperation(func(token *string) error {
+			input.ClientRequestToken = token
+			_, err := s.api.UpdateStack(input)
+			return err
+		})
 	}
 
 	if err != nil {
@@ -356,47 +626,261 @@ func (s *Stack) updateStackInput() (*cloudformation.UpdateStackInput, error) {
 		StackName: aws.String(s.config.Name),
 	}
 
-	if s.config.TemplateURL != "" {
-		input.TemplateURL = aws.String(s.config.TemplateURL)
-	} else if s.config.TemplatePath != "" {
-		body, err := s.templateReader.ReadFile(s.config.TemplatePath)
+	var err error
+	if s.config.UsePreviousTemplate {
+		input.UsePreviousTemplate = aws.Bool(true)
+	} else {
+		input.TemplateBody, input.TemplateURL, err = s.template()
 		if err != nil {
 			return nil, err
 		}
-		input.TemplateBody = aws.String(string(body))
-	} else {
-		input.TemplateBody = aws.String(string(s.config.TemplateBody))
-	}
-
-	if len(s.config.Parameters) > 0 {
-		input.Parameters = make([]*cloudformation.Parameter, 0, len(s.config.Parameters))
-		for k, v := range s.config.Parameters {
-			input.Parameters = append(
-				input.Parameters,
-				&cloudformation.Parameter{
-					ParameterKey:   aws.String(k),
-					ParameterValue: aws.String(v),
-				},
-			)
-		}
 	}
 
-	if len(s.config.Tags) > 0 {
-		input.Tags = make([]*cloudformation.Tag, 0, len(s.config.Tags))
-		for k, v := range s.config.Tags {
-			input.Tags = append(
-				input.Tags,
-				&cloudformation.Tag{Key: aws.String(k), Value: aws.String(v)},
-			)
-		}
+	input.Parameters, err = s.parameters(false)
+	if err != nil {
+		return nil, err
 	}
 
+	input.Tags = s.tags()
+
 	if len(s.config.Capabilities) > 0 {
 		input.Capabilities = aws.StringSlice(s.config.Capabilities)
 	}
+
+	if s.stackPolicyDuringUpdate != "" {
+		input.StackPolicyDuringUpdateBody = aws.String(s.stackPolicyDuringUpdate)
+	}
 	return &input, nil
 }
 
+// parameters converts StackConfig.Parameters into Cloudformation parameters.
+// Parameters that use the stack's previous value are only allowed when
+// updating a stack.
+func (s *Stack) parameters(creating bool) ([]*cloudformation.Parameter, error) {
+	return cloudformationParameters(s.config.Parameters, creating, "stack "+s.config.Name)
+}
+
+// tags converts StackConfig.Tags into Cloudformation tags along with the
+// ownership tag set by WithOwner(). Without an owner, an existing stack's
+// ownership tag is kept since updates replace all of a stack's tags.
+func (s *Stack) tags() []*cloudformation.Tag {
+	tags := map[string]string{}
+	for k, v := range s.config.Tags {
+		tags[k] = v
+	}
+	if s.owner != "" {
+		tags[OwnerTagKey] = s.owner
+	} else if s.cloudStack != nil {
+		for _, tag := range s.cloudStack.Tags {
+			if aws.StringValue(tag.Key) == OwnerTagKey {
+				tags[OwnerTagKey] = aws.StringValue(tag.Value)
+			}
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]*cloudformation.Tag, 0, len(tags))
+	for _, k := range keys {
+		out = append(out, &cloudformation.Tag{Key: aws.String(k), Value: aws.String(tags[k])})
+	}
+	return out
+}
+
+// cloudformationParameters converts ParameterValues into Cloudformation
+// parameters. resource names the stack or stack set being created in errors.
+func cloudformationParameters(values map[string]ParameterValue, creating bool, resource string) ([]*cloudformation.Parameter, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	parameters := make([]*cloudformation.Parameter, 0, len(values))
+	for k, v := range values {
+		parameter := &cloudformation.Parameter{ParameterKey: aws.String(k)}
+		if v.UsePreviousValue {
+			if creating {
+				return nil, fmt.Errorf(
+					"parameter %s uses UsePreviousValue which cannot be used to create %s",
+					k,
+					resource,
+				)
+			}
+			parameter.UsePreviousValue = aws.Bool(true)
+		} else {
+			parameter.ParameterValue = aws.String(v.Value)
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters, nil
+}
+
+// template returns either a TemplateBody or a TemplateURL for the configured
+// template. Local artifacts referenced by the template are packaged first.
+// Local templates larger than Cloudformation's TemplateBody limit are uploaded
+// to StackConfig.TemplateBucket and referenced by TemplateURL.
+func (s *Stack) template() (body *string, url *string, err error) {
+	if s.config.TemplateURL != "" {
+		return nil, aws.String(s.config.TemplateURL), nil
+	}
+
+	contents, baseDir, err := s.localTemplate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	packager := packager{
+		bucket:   s.config.TemplateBucket,
+		uploader: s.uploader,
+		reader:   s.templateReader,
+	}
+	contents, err = packager.packageTemplate(contents, baseDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(contents) <= maxTemplateBodySize {
+		return aws.String(string(contents)), nil, nil
+	}
+
+	if s.config.TemplateBucket == "" {
+		return nil, nil, fmt.Errorf(
+			"template is %d bytes which exceeds the %d byte TemplateBody limit. Set TemplateBucket to upload it to S3",
+			len(contents),
+			maxTemplateBodySize,
+		)
+	}
+	if s.uploader == nil {
+		return nil, nil, errors.New("template exceeds the TemplateBody limit but no uploader is configured")
+	}
+
+	location, err := s.uploader.Upload(s.config.TemplateBucket, contentKey(contents, ".template"), contents)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to upload template")
+	}
+	return nil, aws.String(location), nil
+}
+
+// localTemplate returns the unpackaged contents of the configured
+// TemplatePath or TemplateBody, along with the directory the template's
+// relative artifact paths are resolved against.
+func (s *Stack) localTemplate() ([]byte, string, error) {
+	return readLocalTemplate(s.config, s.templateReader)
+}
+
+// readLocalTemplate reads config's TemplatePath with reader, or returns its
+// TemplateBody, along with the directory the template's relative artifact
+// paths are resolved against.
+func readLocalTemplate(config *StackConfig, reader localFileReader) ([]byte, string, error) {
+	if config.TemplatePath == "" {
+		return []byte(config.TemplateBody), ".", nil
+	}
+
+	contents, err := reader.ReadFile(config.TemplatePath)
+	if err != nil {
+		return nil, "", err
+	}
+	return contents, filepath.Dir(config.TemplatePath), nil
+}
+
+// stackPolicyBody returns the configured stack policy document, reading it
+// from disk when StackConfig.StackPolicy is a path. An empty string means no
+// stack policy is configured.
+func (s *Stack) stackPolicyBody() (string, error) {
+	policy := s.config.StackPolicy
+	if policy.Path == "" {
+		return policy.Body, nil
+	}
+
+	body, err := s.templateReader.ReadFile(policy.Path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read stack policy")
+	}
+	return string(body), nil
+}
+
+// syncStackPolicy applies the configured stack policy to an existing
+// Cloudformation Stack. SetStackPolicy is only called when the policy differs
+// from the one returned by GetStackPolicy.
+//
+// The policy is set separately from UpdateStack so that policy changes are
+// applied even when the template and parameters have no updates to perform.
+func (s *Stack) syncStackPolicy() error {
+	policy, changed, err := s.stackPolicyChanged()
+	if err != nil || !changed {
+		return err
+	}
+
+	_, err = s.api.SetStackPolicy(
+		&cloudformation.SetStackPolicyInput{
+			StackName:       aws.String(s.config.Name),
+			StackPolicyBody: aws.String(policy),
+		},
+	)
+	return err
+}
+
+// stackPolicyChanged returns the configured stack policy and whether it
+// differs from the existing stack's policy. Stacks without a configured policy
+// never change.
+func (s *Stack) stackPolicyChanged() (string, bool, error) {
+	if !s.config.StackPolicy.isSet() {
+		return "", false, nil
+	}
+
+	policy, err := s.stackPolicyBody()
+	if err != nil {
+		return "", false, err
+	}
+
+	out, err := s.api.GetStackPolicy(
+		&cloudformation.GetStackPolicyInput{StackName: aws.String(s.config.Name)},
+	)
+	if err != nil {
+		return "", false, err
+	}
+	return policy, !equalStackPolicies(aws.StringValue(out.StackPolicyBody), policy), nil
+}
+
+// syncTerminationProtection enables or disables termination protection on an
+// existing Cloudformation Stack to match
+// StackConfig.EnableTerminationProtection. UpdateStack can't change it.
+func (s *Stack) syncTerminationProtection() error {
+	enabled := s.config.EnableTerminationProtection
+	if aws.BoolValue(s.cloudStack.EnableTerminationProtection) == enabled {
+		return nil
+	}
+
+	_, err := s.api.UpdateTerminationProtection(
+		&cloudformation.UpdateTerminationProtectionInput{
+			StackName:                   s.cloudStack.StackId,
+			EnableTerminationProtection: aws.Bool(enabled),
+		},
+	)
+	if err != nil {
+		return err
+	}
+	s.cloudStack.EnableTerminationProtection = aws.Bool(enabled)
+	return nil
+}
+
+// equalStackPolicies compares two JSON stack policy documents while ignoring
+// formatting differences. Documents that fail to parse are compared as plain
+// strings.
+func equalStackPolicies(a, b string) bool {
+	var aDoc, bDoc interface{}
+	if json.Unmarshal([]byte(a), &aDoc) != nil || json.Unmarshal([]byte(b), &bDoc) != nil {
+		return a == b
+	}
+	return reflect.DeepEqual(aDoc, bDoc)
+}
+
 // NoStackUpdatesToPerform inspects awserr.Error to detect if a Cloudformation
 // Stack does not rquire any updates.
 //
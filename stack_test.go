@@ -1,8 +1,13 @@
 package stackshot
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -27,6 +32,29 @@ type MockAPI struct {
 	CreateStackFn              func(*cfn.CreateStackInput) (*cfn.CreateStackOutput, error)
 	UpdateStackFn              func(*cfn.UpdateStackInput) (*cfn.UpdateStackOutput, error)
 	DescribeStackEventsPagesFn func(*cfn.DescribeStackEventsInput, func(*cfn.DescribeStackEventsOutput, bool) bool) error
+	GetStackPolicyFn           func(*cfn.GetStackPolicyInput) (*cfn.GetStackPolicyOutput, error)
+	SetStackPolicyFn           func(*cfn.SetStackPolicyInput) (*cfn.SetStackPolicyOutput, error)
+	ValidateTemplateFn         func(*cfn.ValidateTemplateInput) (*cfn.ValidateTemplateOutput, error)
+	GetTemplateSummaryFn       func(*cfn.GetTemplateSummaryInput) (*cfn.GetTemplateSummaryOutput, error)
+
+	DescribeStackSetFn                  func(*cfn.DescribeStackSetInput) (*cfn.DescribeStackSetOutput, error)
+	CreateStackSetFn                    func(*cfn.CreateStackSetInput) (*cfn.CreateStackSetOutput, error)
+	UpdateStackSetFn                    func(*cfn.UpdateStackSetInput) (*cfn.UpdateStackSetOutput, error)
+	ListStackInstancesPagesFn           func(*cfn.ListStackInstancesInput, func(*cfn.ListStackInstancesOutput, bool) bool) error
+	CreateStackInstancesFn              func(*cfn.CreateStackInstancesInput) (*cfn.CreateStackInstancesOutput, error)
+	DeleteStackInstancesFn              func(*cfn.DeleteStackInstancesInput) (*cfn.DeleteStackInstancesOutput, error)
+	DescribeStackSetOperationFn         func(*cfn.DescribeStackSetOperationInput) (*cfn.DescribeStackSetOperationOutput, error)
+	ListStackSetOperationResultsPagesFn func(*cfn.ListStackSetOperationResultsInput, func(*cfn.ListStackSetOperationResultsOutput, bool) bool) error
+
+	CreateChangeSetFn   func(*cfn.CreateChangeSetInput) (*cfn.CreateChangeSetOutput, error)
+	DescribeChangeSetFn func(*cfn.DescribeChangeSetInput) (*cfn.DescribeChangeSetOutput, error)
+	ExecuteChangeSetFn  func(*cfn.ExecuteChangeSetInput) (*cfn.ExecuteChangeSetOutput, error)
+
+	DescribeStacksPagesFn func(*cfn.DescribeStacksInput, func(*cfn.DescribeStacksOutput, bool) bool) error
+	DeleteStackFn         func(*cfn.DeleteStackInput) (*cfn.DeleteStackOutput, error)
+
+	GetTemplateFn                 func(*cfn.GetTemplateInput) (*cfn.GetTemplateOutput, error)
+	UpdateTerminationProtectionFn func(*cfn.UpdateTerminationProtectionInput) (*cfn.UpdateTerminationProtectionOutput, error)
 }
 
 func (m *MockAPI) DescribeStacks(input *cfn.DescribeStacksInput) (*cfn.DescribeStacksOutput, error) {
@@ -49,6 +77,92 @@ func (m *MockAPI) DescribeStackEventsPages(input *cfn.DescribeStackEventsInput,
 	return m.DescribeStackEventsPagesFn(input, fn)
 }
 
+func (m *MockAPI) GetStackPolicy(input *cfn.GetStackPolicyInput) (*cfn.GetStackPolicyOutput, error) {
+	return m.GetStackPolicyFn(input)
+}
+
+func (m *MockAPI) SetStackPolicy(input *cfn.SetStackPolicyInput) (*cfn.SetStackPolicyOutput, error) {
+	return m.SetStackPolicyFn(input)
+}
+
+// ValidateTemplate succeeds unless ValidateTemplateFn is set since most tests
+// aren't concerned with template validation.
+func (m *MockAPI) ValidateTemplate(input *cfn.ValidateTemplateInput) (*cfn.ValidateTemplateOutput, error) {
+	if m.ValidateTemplateFn == nil {
+		return &cfn.ValidateTemplateOutput{}, nil
+	}
+	return m.ValidateTemplateFn(input)
+}
+
+// GetTemplateSummary returns a summary without parameters or capabilities
+// unless GetTemplateSummaryFn is set.
+func (m *MockAPI) GetTemplateSummary(input *cfn.GetTemplateSummaryInput) (*cfn.GetTemplateSummaryOutput, error) {
+	if m.GetTemplateSummaryFn == nil {
+		return &cfn.GetTemplateSummaryOutput{}, nil
+	}
+	return m.GetTemplateSummaryFn(input)
+}
+
+func (m *MockAPI) DescribeStackSet(input *cfn.DescribeStackSetInput) (*cfn.DescribeStackSetOutput, error) {
+	return m.DescribeStackSetFn(input)
+}
+
+func (m *MockAPI) CreateStackSet(input *cfn.CreateStackSetInput) (*cfn.CreateStackSetOutput, error) {
+	return m.CreateStackSetFn(input)
+}
+
+func (m *MockAPI) UpdateStackSet(input *cfn.UpdateStackSetInput) (*cfn.UpdateStackSetOutput, error) {
+	return m.UpdateStackSetFn(input)
+}
+
+func (m *MockAPI) ListStackInstancesPages(input *cfn.ListStackInstancesInput, fn func(*cfn.ListStackInstancesOutput, bool) bool) error {
+	return m.ListStackInstancesPagesFn(input, fn)
+}
+
+func (m *MockAPI) CreateStackInstances(input *cfn.CreateStackInstancesInput) (*cfn.CreateStackInstancesOutput, error) {
+	return m.CreateStackInstancesFn(input)
+}
+
+func (m *MockAPI) DeleteStackInstances(input *cfn.DeleteStackInstancesInput) (*cfn.DeleteStackInstancesOutput, error) {
+	return m.DeleteStackInstancesFn(input)
+}
+
+func (m *MockAPI) DescribeStackSetOperation(input *cfn.DescribeStackSetOperationInput) (*cfn.DescribeStackSetOperationOutput, error) {
+	return m.DescribeStackSetOperationFn(input)
+}
+
+func (m *MockAPI) ListStackSetOperationResultsPages(input *cfn.ListStackSetOperationResultsInput, fn func(*cfn.ListStackSetOperationResultsOutput, bool) bool) error {
+	return m.ListStackSetOperationResultsPagesFn(input, fn)
+}
+
+func (m *MockAPI) CreateChangeSet(input *cfn.CreateChangeSetInput) (*cfn.CreateChangeSetOutput, error) {
+	return m.CreateChangeSetFn(input)
+}
+
+func (m *MockAPI) DescribeChangeSet(input *cfn.DescribeChangeSetInput) (*cfn.DescribeChangeSetOutput, error) {
+	return m.DescribeChangeSetFn(input)
+}
+
+func (m *MockAPI) ExecuteChangeSet(input *cfn.ExecuteChangeSetInput) (*cfn.ExecuteChangeSetOutput, error) {
+	return m.ExecuteChangeSetFn(input)
+}
+
+func (m *MockAPI) DescribeStacksPages(input *cfn.DescribeStacksInput, fn func(*cfn.DescribeStacksOutput, bool) bool) error {
+	return m.DescribeStacksPagesFn(input, fn)
+}
+
+func (m *MockAPI) DeleteStack(input *cfn.DeleteStackInput) (*cfn.DeleteStackOutput, error) {
+	return m.DeleteStackFn(input)
+}
+
+func (m *MockAPI) GetTemplate(input *cfn.GetTemplateInput) (*cfn.GetTemplateOutput, error) {
+	return m.GetTemplateFn(input)
+}
+
+func (m *MockAPI) UpdateTerminationProtection(input *cfn.UpdateTerminationProtectionInput) (*cfn.UpdateTerminationProtectionOutput, error) {
+	return m.UpdateTerminationProtectionFn(input)
+}
+
 // Mock helpers
 
 func NewDescribeStackPlayer(responses ...*describeStackResponse) *describeStacksResponsePlayer {
@@ -149,6 +263,31 @@ func GenDescribeStackEventsPagesFn(output *cfn.DescribeStackEventsOutput, lastPa
 	}
 }
 
+func GenGetStackPolicyFn(policy string) func(*cfn.GetStackPolicyInput) (*cfn.GetStackPolicyOutput, error) {
+	return func(input *cfn.GetStackPolicyInput) (*cfn.GetStackPolicyOutput, error) {
+		out := cfn.GetStackPolicyOutput{}
+		if policy != "" {
+			out.StackPolicyBody = aws.String(policy)
+		}
+		return &out, nil
+	}
+}
+
+func GenGetTemplateSummaryFn(capabilities []string, parameters ...*cfn.ParameterDeclaration) func(*cfn.GetTemplateSummaryInput) (*cfn.GetTemplateSummaryOutput, error) {
+	return func(input *cfn.GetTemplateSummaryInput) (*cfn.GetTemplateSummaryOutput, error) {
+		return &cfn.GetTemplateSummaryOutput{
+			Capabilities: aws.StringSlice(capabilities),
+			Parameters:   parameters,
+		}, nil
+	}
+}
+
+func GenGetTemplateFn(body string) func(*cfn.GetTemplateInput) (*cfn.GetTemplateOutput, error) {
+	return func(input *cfn.GetTemplateInput) (*cfn.GetTemplateOutput, error) {
+		return &cfn.GetTemplateOutput{TemplateBody: aws.String(body)}, nil
+	}
+}
+
 // impatientWaiter implements the waiter interface but hates waiting.
 type impatientWaiter struct {
 }
@@ -173,6 +312,9 @@ func (s *stubEventLoader) latestEvents(consumer EventConsumer) error {
 func (s *stubEventLoader) setStackId(id *string) {
 }
 
+func (s *stubEventLoader) setClientRequestToken(token string) {
+}
+
 type stubFileReader struct {
 	contents string
 	err      error
@@ -185,6 +327,31 @@ func (s *stubFileReader) ReadFile(input string) ([]byte, error) {
 	return []byte(s.contents), nil
 }
 
+// Stat describes every path as a regular file holding contents.
+func (s *stubFileReader) Stat(input string) (os.FileInfo, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &stubFileInfo{name: filepath.Base(input), size: int64(len(s.contents))}, nil
+}
+
+func (s *stubFileReader) ReadDir(input string) ([]os.FileInfo, error) {
+	return nil, fmt.Errorf("%s is not a directory", input)
+}
+
+// stubFileInfo describes a regular file for stubFileReader.
+type stubFileInfo struct {
+	name string
+	size int64
+}
+
+func (i *stubFileInfo) Name() string       { return i.name }
+func (i *stubFileInfo) Size() int64        { return i.size }
+func (i *stubFileInfo) Mode() os.FileMode  { return 0644 }
+func (i *stubFileInfo) ModTime() time.Time { return time.Time{} }
+func (i *stubFileInfo) IsDir() bool        { return false }
+func (i *stubFileInfo) Sys() interface{}   { return nil }
+
 func TestLoadStack(t *testing.T) {
 	config := StackConfig{
 		Name:        "mystack",
@@ -314,13 +481,14 @@ func TestSync(t *testing.T) {
 	config := StackConfig{
 		Name:        "mystack",
 		TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
-		Parameters: map[string]string{
-			"MyParam": "MyValue",
+		Parameters: map[string]ParameterValue{
+			"MyParam": {Value: "MyValue"},
 		},
 		Tags: map[string]string{
 			"environment": "production",
 		},
 	}
+	myParam := &cfn.ParameterDeclaration{ParameterKey: aws.String("MyParam")}
 
 	t.Run(
 		"Create new stack",
@@ -328,6 +496,7 @@ func TestSync(t *testing.T) {
 			api := MockAPI{}
 			stubOutput := cfn.CreateStackOutput{}
 			api.CreateStackFn = GenCreateStackFn(&stubOutput)
+			api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil, myParam)
 
 			stack := Stack{
 				api:    &api,
@@ -347,6 +516,7 @@ func TestSync(t *testing.T) {
 			api := MockAPI{}
 			stubErr := errors.New("stub error")
 			api.CreateStackFn = GenErrorCreateStackFn(stubErr)
+			api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil, myParam)
 
 			stack := Stack{
 				api:    &api,
@@ -366,6 +536,7 @@ func TestSync(t *testing.T) {
 			api := MockAPI{}
 			stubOutput := cfn.UpdateStackOutput{}
 			api.UpdateStackFn = GenUpdateStackFn(&stubOutput)
+			api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil, myParam)
 
 			stack := Stack{
 				cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
@@ -386,6 +557,7 @@ func TestSync(t *testing.T) {
 			api := MockAPI{}
 			stubErr := errors.New("stub error")
 			api.UpdateStackFn = GenErrorUpdateStackFn(stubErr)
+			api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil, myParam)
 
 			stack := Stack{
 				cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
@@ -401,6 +573,87 @@ func TestSync(t *testing.T) {
 	)
 }
 
+func TestClientRequestToken(t *testing.T) {
+	config := StackConfig{
+		Name:        "mystack",
+		TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+	}
+
+	tokens := []string{}
+	api := MockAPI{}
+	api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+	api.CreateStackFn = func(input *cfn.CreateStackInput) (*cfn.CreateStackOutput, error) {
+		tokens = append(tokens, aws.StringValue(input.ClientRequestToken))
+		return &cfn.CreateStackOutput{}, nil
+	}
+	api.UpdateStackFn = func(input *cfn.UpdateStackInput) (*cfn.UpdateStackOutput, error) {
+		tokens = append(tokens, aws.StringValue(input.ClientRequestToken))
+		return &cfn.UpdateStackOutput{}, nil
+	}
+	api.DeleteStackFn = func(input *cfn.DeleteStackInput) (*cfn.DeleteStackOutput, error) {
+		tokens = append(tokens, aws.StringValue(input.ClientRequestToken))
+		return &cfn.DeleteStackOutput{}, nil
+	}
+	api.DescribeStacksFn = GenDescribeStacksFn(
+		&cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String("DELETE_COMPLETE")},
+	)
+
+	stack := Stack{api: &api, config: &config, eventLoader: &stubEventLoader{}, waitAttempts: 1}
+	if stack.ClientRequestToken() != "" {
+		t.Errorf("Expected no token before an operation, got: %s", stack.ClientRequestToken())
+	}
+
+	if err := stack.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	stack.cloudStack = &cfn.Stack{StackId: aws.String("arn:mystack")}
+	if err := stack.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := stack.DeleteAndPollEvents(&eventCollector{}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if len(tokens) != 3 {
+		t.Fatalf("Expected 3 operations, got: %d", len(tokens))
+	}
+	for i, token := range tokens {
+		if !strings.HasPrefix(token, "stackshot-") {
+			t.Errorf("Unexpected token: %s", token)
+		}
+		for _, other := range tokens[:i] {
+			if token == other {
+				t.Errorf("Expected a new token for every operation, got %s twice", token)
+			}
+		}
+	}
+	if stack.ClientRequestToken() != tokens[2] {
+		t.Errorf("Expected the last operation's token %s, got: %s", tokens[2], stack.ClientRequestToken())
+	}
+	// Rejected operations, including updates without changes, don't expose
+	// their token or leave events filtered by an earlier operation's.
+	loader := &stackEvents{api: &api}
+	stack.eventLoader = loader
+	api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+	if err := stack.Sync(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if loader.requestToken == "" || loader.requestToken != stack.ClientRequestToken() {
+		t.Errorf("Expected events to be filtered by the update's token, got: %q", loader.requestToken)
+	}
+
+	api.UpdateStackFn = GenErrorUpdateStackFn(awserr.New("ValidationError", "No updates are to be performed.", nil))
+	if err := stack.Sync(); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if stack.ClientRequestToken() != "" {
+		t.Errorf("Expected no token after a rejected operation, got: %s", stack.ClientRequestToken())
+	}
+	if loader.requestToken != "" {
+		t.Errorf("Expected events not to be filtered after a rejected operation, got: %s", loader.requestToken)
+	}
+}
+
 func TestTemplateTypes(t *testing.T) {
 	template := `
 AWSTemplateFormatVersion: 2010-09-09
@@ -465,6 +718,29 @@ Resources:
 
 }
 
+func TestEventJSONPrinter(t *testing.T) {
+	timestamp := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	err := EventJSONPrinter(buf).Consume(&cfn.StackEvent{
+		Timestamp:          &timestamp,
+		StackName:          aws.String("mystack"),
+		StackId:            aws.String("arn:mystack"),
+		EventId:            aws.String("event-id"),
+		LogicalResourceId:  aws.String("MyBucket"),
+		ResourceType:       aws.String("AWS::S3::Bucket"),
+		ResourceStatus:     aws.String("CREATE_IN_PROGRESS"),
+		ClientRequestToken: aws.String("stackshot-token"),
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	expected := `{"timestamp":"2020-09-01T12:00:00Z","stack_name":"mystack","stack_id":"arn:mystack","event_id":"event-id","logical_resource_id":"MyBucket","resource_type":"AWS::S3::Bucket","resource_status":"CREATE_IN_PROGRESS","client_request_token":"stackshot-token"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected JSON: %s", cmp.Diff(expected, buf.String()))
+	}
+}
+
 func TestWaitUntilDone(t *testing.T) {
 	config := StackConfig{
 		Name:        "mystack",
@@ -485,6 +761,9 @@ func TestWaitUntilDone(t *testing.T) {
 		{"DELETE_FAILED", true},
 		{"ROLLBACK_FAILED", true},
 		{"ROLLBACK_COMPLETE", true},
+		{"IMPORT_COMPLETE", false},
+		{"IMPORT_ROLLBACK_COMPLETE", true},
+		{"IMPORT_ROLLBACK_FAILED", true},
 	}
 
 	for _, test := range tests {
@@ -635,3 +914,376 @@ func TestWaitUntilDone(t *testing.T) {
 		},
 	)
 }
+
+func TestStackPolicy(t *testing.T) {
+	policy := `{"Statement":[{"Effect":"Deny","Action":"Update:Replace","Principal":"*","Resource":"LogicalResourceId/Database"}]}`
+
+	t.Run(
+		"Create sets StackPolicyBody",
+		func(t *testing.T) {
+			config := StackConfig{
+				Name:        "mystack",
+				TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+				StackPolicy: stackPolicy{Path: "policy.json"},
+			}
+			stack := Stack{
+				config:         &config,
+				templateReader: &stubFileReader{contents: policy},
+			}
+
+			input, err := stack.createStackInput()
+			if err != nil {
+				t.Fatalf("Expected createStackInput() to succeed. Got error: %s", err)
+			}
+			if aws.StringValue(input.StackPolicyBody) != policy {
+				t.Errorf("Expected StackPolicyBody: %s. Got: %s", policy, aws.StringValue(input.StackPolicyBody))
+			}
+		},
+	)
+
+	tests := []struct {
+		name      string
+		current   string
+		shouldSet bool
+	}{
+		{"Update sets policy when stack has none", "", true},
+		{"Update sets policy when it changed", `{"Statement":[]}`, true},
+		{"Update skips policy when unchanged", "{\n  \"Statement\": [{\"Effect\": \"Deny\", \"Action\": \"Update:Replace\", \"Principal\": \"*\", \"Resource\": \"LogicalResourceId/Database\"}]\n}", false},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.name,
+			func(t *testing.T) {
+				config := StackConfig{
+					Name:        "mystack",
+					TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+					StackPolicy: stackPolicy{Body: policy},
+				}
+
+				var setInput *cfn.SetStackPolicyInput
+				api := MockAPI{}
+				api.GetStackPolicyFn = GenGetStackPolicyFn(test.current)
+				api.SetStackPolicyFn = func(input *cfn.SetStackPolicyInput) (*cfn.SetStackPolicyOutput, error) {
+					setInput = input
+					return &cfn.SetStackPolicyOutput{}, nil
+				}
+				api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+
+				stack := Stack{
+					cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
+					api:        &api,
+					config:     &config,
+				}
+
+				err := stack.Sync()
+				if err != nil {
+					t.Fatalf("Expected Sync() to succeed. Got error: %s", err)
+				}
+
+				if test.shouldSet && setInput == nil {
+					t.Errorf("Expected SetStackPolicy to be called. It was not")
+				}
+				if !test.shouldSet && setInput != nil {
+					t.Errorf("Expected SetStackPolicy to not be called. Got: %+v", setInput)
+				}
+				if setInput != nil && aws.StringValue(setInput.StackPolicyBody) != policy {
+					t.Errorf("Expected StackPolicyBody: %s. Got: %s", policy, aws.StringValue(setInput.StackPolicyBody))
+				}
+			},
+		)
+	}
+
+	t.Run(
+		"Update with policy override",
+		func(t *testing.T) {
+			config := StackConfig{
+				Name:        "mystack",
+				TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+			}
+			stack := Stack{
+				cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
+				config:     &config,
+			}
+			WithStackPolicyDuringUpdate(policy)(&stack)
+
+			input, err := stack.updateStackInput()
+			if err != nil {
+				t.Fatalf("Expected updateStackInput() to succeed. Got error: %s", err)
+			}
+			if aws.StringValue(input.StackPolicyDuringUpdateBody) != policy {
+				t.Errorf(
+					"Expected StackPolicyDuringUpdateBody: %s. Got: %s",
+					policy,
+					aws.StringValue(input.StackPolicyDuringUpdateBody),
+				)
+			}
+		},
+	)
+}
+
+func TestOversizedTemplates(t *testing.T) {
+	template := "AWSTemplateFormatVersion: 2010-09-09\n" + strings.Repeat("#", maxTemplateBodySize)
+
+	t.Run(
+		"Uploaded to TemplateBucket",
+		func(t *testing.T) {
+			config := StackConfig{
+				Name:           "mystack",
+				TemplatePath:   "template.yaml",
+				TemplateBucket: "templates",
+			}
+			uploader := &recordingUploader{}
+			stack := Stack{
+				config:         &config,
+				templateReader: &stubFileReader{contents: template},
+				uploader:       uploader,
+			}
+
+			input, err := stack.createStackInput()
+			if err != nil {
+				t.Fatalf("Expected createStackInput() to succeed. Got error: %s", err)
+			}
+
+			key := contentKey([]byte(template), ".template")
+			if _, ok := uploader.objects["templates/"+key]; !ok {
+				t.Errorf("Expected template to be uploaded to templates/%s. Got: %v", key, uploader.objects)
+			}
+			if input.TemplateBody != nil {
+				t.Errorf("Expected TemplateBody to be nil")
+			}
+			expURL := "https://s3.us-east-1.amazonaws.com/templates/" + key
+			if aws.StringValue(input.TemplateURL) != expURL {
+				t.Errorf("Expected TemplateURL: %s. Got: %s", expURL, aws.StringValue(input.TemplateURL))
+			}
+		},
+	)
+
+	t.Run(
+		"Fails without TemplateBucket",
+		func(t *testing.T) {
+			config := StackConfig{
+				Name:         "mystack",
+				TemplateBody: templateBody(template),
+			}
+			stack := Stack{
+				cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
+				config:     &config,
+				uploader:   &recordingUploader{},
+			}
+
+			_, err := stack.updateStackInput()
+			if err == nil {
+				t.Errorf("Expected updateStackInput() to fail. Got success")
+			}
+		},
+	)
+
+	t.Run(
+		"Small templates are sent inline",
+		func(t *testing.T) {
+			config := StackConfig{
+				Name:           "mystack",
+				TemplateBody:   "AWSTemplateFormatVersion: 2010-09-09",
+				TemplateBucket: "templates",
+			}
+			uploader := &recordingUploader{}
+			stack := Stack{
+				config:   &config,
+				uploader: uploader,
+			}
+
+			input, err := stack.createStackInput()
+			if err != nil {
+				t.Fatalf("Expected createStackInput() to succeed. Got error: %s", err)
+			}
+			if len(uploader.objects) != 0 {
+				t.Errorf("Expected no uploads. Got: %v", uploader.objects)
+			}
+			if aws.StringValue(input.TemplateBody) != string(config.TemplateBody) {
+				t.Errorf("Expected TemplateBody: %s. Got: %s", config.TemplateBody, aws.StringValue(input.TemplateBody))
+			}
+		},
+	)
+}
+
+func TestValidateTemplateBeforeSync(t *testing.T) {
+	config := StackConfig{
+		Name:         "mystack",
+		TemplateBody: `{"Resources": {"Bucket": {"Type": "AWS::S3::Bucket"}}}`,
+	}
+
+	t.Run(
+		"Invalid templates are not created",
+		func(t *testing.T) {
+			api := MockAPI{}
+			api.ValidateTemplateFn = func(input *cfn.ValidateTemplateInput) (*cfn.ValidateTemplateOutput, error) {
+				return nil, awserr.New("ValidationError", "Template format error", nil)
+			}
+			api.CreateStackFn = func(input *cfn.CreateStackInput) (*cfn.CreateStackOutput, error) {
+				t.Errorf("Expected CreateStack to not be called")
+				return nil, nil
+			}
+
+			stack := Stack{api: &api, config: &config}
+			if err := stack.Sync(); err == nil {
+				t.Errorf("Expected Sync() to fail. Got success")
+			}
+		},
+	)
+
+	t.Run(
+		"Templates are validated as sent",
+		func(t *testing.T) {
+			var validated *cfn.ValidateTemplateInput
+			api := MockAPI{}
+			api.ValidateTemplateFn = func(input *cfn.ValidateTemplateInput) (*cfn.ValidateTemplateOutput, error) {
+				validated = input
+				return &cfn.ValidateTemplateOutput{}, nil
+			}
+			api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+
+			stack := Stack{
+				cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
+				api:        &api,
+				config:     &config,
+			}
+			if err := stack.Sync(); err != nil {
+				t.Fatalf("Expected Sync() to succeed. Got error: %s", err)
+			}
+
+			if aws.StringValue(validated.TemplateBody) != string(config.TemplateBody) {
+				t.Errorf("Expected TemplateBody: %s. Got: %s", config.TemplateBody, aws.StringValue(validated.TemplateBody))
+			}
+		},
+	)
+}
+
+func TestUsePrevious(t *testing.T) {
+	config := StackConfig{
+		Name:                "mystack",
+		UsePreviousTemplate: true,
+		Parameters: map[string]ParameterValue{
+			"DbPassword": {UsePreviousValue: true},
+		},
+	}
+
+	t.Run(
+		"Update uses previous template and values",
+		func(t *testing.T) {
+			stack := Stack{
+				cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
+				config:     &config,
+			}
+
+			input, err := stack.updateStackInput()
+			if err != nil {
+				t.Fatalf("Expected updateStackInput() to succeed. Got error: %s", err)
+			}
+
+			expected := &cfn.UpdateStackInput{
+				StackName:           aws.String("mystack"),
+				UsePreviousTemplate: aws.Bool(true),
+				Parameters: []*cfn.Parameter{
+					{ParameterKey: aws.String("DbPassword"), UsePreviousValue: aws.Bool(true)},
+				},
+			}
+			if !cmp.Equal(input, expected) {
+				t.Errorf("Expected:\n%s\nGot:\n%s", expected, input)
+			}
+		},
+	)
+
+	t.Run(
+		"Update summarizes the stack's template",
+		func(t *testing.T) {
+			var summaryInput *cfn.GetTemplateSummaryInput
+			api := MockAPI{}
+			api.ValidateTemplateFn = func(input *cfn.ValidateTemplateInput) (*cfn.ValidateTemplateOutput, error) {
+				t.Errorf("Expected ValidateTemplate to not be called")
+				return nil, nil
+			}
+			api.GetTemplateSummaryFn = func(input *cfn.GetTemplateSummaryInput) (*cfn.GetTemplateSummaryOutput, error) {
+				summaryInput = input
+				return &cfn.GetTemplateSummaryOutput{
+					Parameters: []*cfn.ParameterDeclaration{{ParameterKey: aws.String("DbPassword")}},
+				}, nil
+			}
+			api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+
+			stack := Stack{
+				cloudStack: &cfn.Stack{StackName: aws.String(config.Name)},
+				api:        &api,
+				config:     &config,
+			}
+			if err := stack.Sync(); err != nil {
+				t.Fatalf("Expected Sync() to succeed. Got error: %s", err)
+			}
+			if aws.StringValue(summaryInput.StackName) != config.Name {
+				t.Errorf("Expected GetTemplateSummary for stack %s. Got: %s", config.Name, summaryInput)
+			}
+		},
+	)
+
+	t.Run(
+		"Create rejects previous template",
+		func(t *testing.T) {
+			stack := Stack{config: &config}
+
+			_, err := stack.createStackInput()
+			if err == nil {
+				t.Errorf("Expected createStackInput() to fail. Got success")
+			}
+		},
+	)
+
+	t.Run(
+		"Create rejects previous values",
+		func(t *testing.T) {
+			config := StackConfig{
+				Name:        "mystack",
+				TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml",
+				Parameters: map[string]ParameterValue{
+					"DbPassword": {UsePreviousValue: true},
+				},
+			}
+			stack := Stack{config: &config}
+
+			_, err := stack.createStackInput()
+			expected := "parameter DbPassword uses UsePreviousValue which cannot be used to create stack mystack"
+			if err == nil || err.Error() != expected {
+				t.Errorf("Expected error: %s. Got: %v", expected, err)
+			}
+		},
+	)
+}
+
+func TestSyncTerminationProtection(t *testing.T) {
+	api := &MockAPI{}
+	api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(nil)
+	api.UpdateStackFn = GenUpdateStackFn(&cfn.UpdateStackOutput{})
+
+	updates := []bool{}
+	api.UpdateTerminationProtectionFn = func(input *cfn.UpdateTerminationProtectionInput) (*cfn.UpdateTerminationProtectionOutput, error) {
+		updates = append(updates, aws.BoolValue(input.EnableTerminationProtection))
+		return &cfn.UpdateTerminationProtectionOutput{}, nil
+	}
+
+	stack := &Stack{
+		api: api,
+		config: &StackConfig{
+			Name:                        "mystack",
+			TemplateURL:                 "https://bucket.s3.amazonaws.com/template.yaml",
+			EnableTerminationProtection: true,
+		},
+		cloudStack: &cfn.Stack{StackId: aws.String("arn:mystack")},
+	}
+	for i := 0; i < 2; i++ {
+		if err := stack.Sync(); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	if !cmp.Equal(updates, []bool{true}) {
+		t.Errorf("Expected termination protection to be enabled once, got: %v", updates)
+	}
+}
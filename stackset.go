@@ -0,0 +1,631 @@
+package stackshot
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/pkg/errors"
+)
+
+// stackSetOperationDoneStatuses maps the statuses of finished stack set
+// operations to whether the operation succeeded.
+var stackSetOperationDoneStatuses = map[string]bool{
+	cloudformation.StackSetOperationStatusSucceeded: true,
+	cloudformation.StackSetOperationStatusFailed:    false,
+	cloudformation.StackSetOperationStatusStopped:   false,
+}
+
+// StackSetEvent reports the status of a single stack instance within a stack
+// set operation.
+type StackSetEvent struct {
+	OperationId string
+
+	// Action is the operation's action: CREATE, UPDATE, or DELETE.
+	Action string
+
+	// Account is the instance's account. OrganizationalUnitId is only set
+	// for SERVICE_MANAGED stack sets.
+	Account              string
+	OrganizationalUnitId string
+	Region               string
+
+	// Status is the instance's status within the operation, e.g. RUNNING or
+	// SUCCEEDED.
+	Status       string
+	StatusReason string
+}
+
+// StackSetEventConsumer is an interface used by
+// StackSet.SyncAndPollEvents() to consume the status changes of stack
+// instances polled from stack set operations.
+type StackSetEventConsumer interface {
+	ConsumeStackSetEvent(*StackSetEvent) error
+}
+
+type StackSetEventConsumerFunc func(*StackSetEvent) error
+
+func (f StackSetEventConsumerFunc) ConsumeStackSetEvent(event *StackSetEvent) error {
+	return f(event)
+}
+
+// StackSetEventPrinter implements the StackSetEventConsumer interface to print
+// StackSetEvents to stdout.
+func StackSetEventPrinter(event *StackSetEvent) error {
+	fmt.Printf(
+		"%s %s %s %s %s\n",
+		event.Action,
+		event.Account,
+		event.Region,
+		event.Status,
+		event.StatusReason,
+	)
+	return nil
+}
+
+// LoadStackSet allocates a new StackSet used to synchronize a
+// StackSetConfig's configuration with a new or existing Cloudformation
+// StackSet.
+func LoadStackSet(api cloudformationiface.CloudFormationAPI, config *StackSetConfig) (*StackSet, error) {
+	stackSet := &StackSet{
+		api:            api,
+		config:         config,
+		templateReader: osFileReader{},
+		waitAttempts:   maxWaitAttempts,
+		waiter:         waiterFunc(sleepWaiter),
+	}
+
+	if err := stackSet.load(); err != nil {
+		return nil, err
+	}
+	return stackSet, nil
+}
+
+// StackSet synchronizes a StackSetConfig with the corresponding
+// Cloudformation StackSet and its stack instances.
+//
+// Call SyncAndPollEvents() to create or update the stack set and then add and
+// remove stack instances until they match the StackSetConfig's
+// DeploymentTargets and Regions.
+type StackSet struct {
+	api            cloudformationiface.CloudFormationAPI
+	config         *StackSetConfig
+	cloudStackSet  *cloudformation.StackSet
+	templateReader localFileReader
+
+	waiter       waiter
+	waitAttempts int
+}
+
+func (s *StackSet) load() error {
+	out, err := s.api.DescribeStackSet(
+		&cloudformation.DescribeStackSetInput{StackSetName: aws.String(s.config.Name)},
+	)
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == cloudformation.ErrCodeStackSetNotFoundException {
+			return nil
+		}
+		return err
+	}
+
+	s.cloudStackSet = out.StackSet
+	return nil
+}
+
+// SyncAndPollEvents creates or updates the stack set and then creates and
+// deletes stack instances to match the StackSetConfig. Every stack set
+// operation is polled until it finishes and the status changes of its stack
+// instances are passed to consumer.
+//
+// The stack set is only updated when its template or settings differ from the
+// StackSetConfig. Templates referenced by TemplateURL are always updated.
+func (s *StackSet) SyncAndPollEvents(consumer StackSetEventConsumer) error {
+	body, url, err := s.template()
+	if err != nil {
+		return err
+	}
+
+	if s.cloudStackSet == nil {
+		if err := s.createStackSet(body, url); err != nil {
+			return err
+		}
+	} else if !s.upToDate(body) {
+		if err := s.updateStackSet(body, url, consumer); err != nil {
+			return err
+		}
+	}
+
+	return s.syncInstances(consumer)
+}
+
+func (s *StackSet) createStackSet(body, url *string) error {
+	parameters, err := s.parameters(true)
+	if err != nil {
+		return err
+	}
+
+	input := cloudformation.CreateStackSetInput{
+		StackSetName: aws.String(s.config.Name),
+		TemplateBody: body,
+		TemplateURL:  url,
+		Parameters:   parameters,
+		Tags:         s.tags(),
+	}
+	if s.config.Description != "" {
+		input.Description = aws.String(s.config.Description)
+	}
+	if len(s.config.Capabilities) > 0 {
+		input.Capabilities = aws.StringSlice(s.config.Capabilities)
+	}
+	if s.config.PermissionModel != "" {
+		input.PermissionModel = aws.String(s.config.PermissionModel)
+	}
+	if s.config.AdministrationRoleARN != "" {
+		input.AdministrationRoleARN = aws.String(s.config.AdministrationRoleARN)
+	}
+	if s.config.ExecutionRoleName != "" {
+		input.ExecutionRoleName = aws.String(s.config.ExecutionRoleName)
+	}
+	input.AutoDeployment = s.autoDeployment()
+
+	if _, err := s.api.CreateStackSet(&input); err != nil {
+		return errors.Wrap(err, "failed to create stack set")
+	}
+	return nil
+}
+
+func (s *StackSet) updateStackSet(body, url *string, consumer StackSetEventConsumer) error {
+	parameters, err := s.parameters(false)
+	if err != nil {
+		return err
+	}
+
+	input := cloudformation.UpdateStackSetInput{
+		StackSetName:         aws.String(s.config.Name),
+		TemplateBody:         body,
+		TemplateURL:          url,
+		Parameters:           parameters,
+		Tags:                 s.tags(),
+		OperationPreferences: s.operationPreferences(),
+	}
+	if s.config.Description != "" {
+		input.Description = aws.String(s.config.Description)
+	}
+	if len(s.config.Capabilities) > 0 {
+		input.Capabilities = aws.StringSlice(s.config.Capabilities)
+	}
+	if s.config.AdministrationRoleARN != "" {
+		input.AdministrationRoleARN = aws.String(s.config.AdministrationRoleARN)
+	}
+	if s.config.ExecutionRoleName != "" {
+		input.ExecutionRoleName = aws.String(s.config.ExecutionRoleName)
+	}
+	input.AutoDeployment = s.autoDeployment()
+
+	out, err := s.api.UpdateStackSet(&input)
+	if err != nil {
+		return errors.Wrap(err, "failed to update stack set")
+	}
+	return s.waitForOperation(out.OperationId, consumer)
+}
+
+// upToDate reports whether the stack set's template and settings match the
+// StackSetConfig. body is nil when the template is referenced by URL, which
+// can't be compared.
+func (s *StackSet) upToDate(body *string) bool {
+	current := s.cloudStackSet
+	if body == nil || aws.StringValue(current.TemplateBody) != aws.StringValue(body) {
+		return false
+	}
+
+	if aws.StringValue(current.Description) != s.config.Description {
+		return false
+	}
+
+	if !equalStringSets(aws.StringValueSlice(current.Capabilities), s.config.Capabilities) {
+		return false
+	}
+
+	tags := map[string]string{}
+	for _, tag := range current.Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	if len(tags) != len(s.config.Tags) || (len(tags) > 0 && !reflect.DeepEqual(tags, s.config.Tags)) {
+		return false
+	}
+
+	parameters := map[string]string{}
+	for _, parameter := range current.Parameters {
+		parameters[aws.StringValue(parameter.ParameterKey)] = aws.StringValue(parameter.ParameterValue)
+	}
+	for key, value := range s.config.Parameters {
+		current, ok := parameters[key]
+		if !ok || (!value.UsePreviousValue && current != value.Value) {
+			return false
+		}
+	}
+
+	// Cloudformation reports its default roles when they aren't set, so the
+	// roles are only compared when the StackSetConfig sets them.
+	if s.config.AdministrationRoleARN != "" && aws.StringValue(current.AdministrationRoleARN) != s.config.AdministrationRoleARN {
+		return false
+	}
+	if s.config.ExecutionRoleName != "" && aws.StringValue(current.ExecutionRoleName) != s.config.ExecutionRoleName {
+		return false
+	}
+
+	if autoDeployment := s.autoDeployment(); autoDeployment != nil {
+		if current.AutoDeployment == nil ||
+			aws.BoolValue(current.AutoDeployment.Enabled) != aws.BoolValue(autoDeployment.Enabled) ||
+			aws.BoolValue(current.AutoDeployment.RetainStacksOnAccountRemoval) != aws.BoolValue(autoDeployment.RetainStacksOnAccountRemoval) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// instanceTargets groups the targets, accounts or organizational units, that
+// share the same regions.
+type instanceTargets struct {
+	targets []string
+	regions []string
+}
+
+// syncInstances creates the stack instances missing from the stack set and
+// deletes the instances that are no longer in the StackSetConfig. Instances
+// are grouped so that targets missing from, or removed from, the same regions
+// share an operation.
+func (s *StackSet) syncInstances(consumer StackSetEventConsumer) error {
+	current, err := s.instances()
+	if err != nil {
+		return err
+	}
+
+	desired := map[string]map[string]bool{}
+	for _, target := range s.targets() {
+		for _, region := range s.config.Regions {
+			if desired[region] == nil {
+				desired[region] = map[string]bool{}
+			}
+			desired[region][target] = true
+		}
+	}
+
+	for _, group := range groupInstances(subtractInstances(desired, current)) {
+		out, err := s.api.CreateStackInstances(
+			&cloudformation.CreateStackInstancesInput{
+				StackSetName:         aws.String(s.config.Name),
+				DeploymentTargets:    s.deploymentTargets(group.targets),
+				Accounts:             s.accounts(group.targets),
+				Regions:              aws.StringSlice(group.regions),
+				OperationPreferences: s.operationPreferences(),
+			},
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to create stack instances")
+		}
+		if err := s.waitForOperation(out.OperationId, consumer); err != nil {
+			return err
+		}
+	}
+
+	for _, group := range groupInstances(subtractInstances(current, desired)) {
+		out, err := s.api.DeleteStackInstances(
+			&cloudformation.DeleteStackInstancesInput{
+				StackSetName:         aws.String(s.config.Name),
+				DeploymentTargets:    s.deploymentTargets(group.targets),
+				Accounts:             s.accounts(group.targets),
+				Regions:              aws.StringSlice(group.regions),
+				OperationPreferences: s.operationPreferences(),
+				RetainStacks:         aws.Bool(false),
+			},
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to delete stack instances")
+		}
+		if err := s.waitForOperation(out.OperationId, consumer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// instances returns the stack set's current instances as a map of regions to
+// the targets deployed in the region.
+func (s *StackSet) instances() (map[string]map[string]bool, error) {
+	// A stack set created by this sync doesn't have any instances yet.
+	instances := map[string]map[string]bool{}
+	if s.cloudStackSet == nil {
+		return instances, nil
+	}
+
+	err := s.api.ListStackInstancesPages(
+		&cloudformation.ListStackInstancesInput{StackSetName: aws.String(s.config.Name)},
+		func(out *cloudformation.ListStackInstancesOutput, lastPage bool) bool {
+			for _, instance := range out.Summaries {
+				target := aws.StringValue(instance.Account)
+				if s.serviceManaged() {
+					target = aws.StringValue(instance.OrganizationalUnitId)
+				}
+
+				region := aws.StringValue(instance.Region)
+				if instances[region] == nil {
+					instances[region] = map[string]bool{}
+				}
+				instances[region][target] = true
+			}
+			return !lastPage
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list stack instances")
+	}
+	return instances, nil
+}
+
+// subtractInstances returns the instances in a that aren't in b.
+func subtractInstances(a, b map[string]map[string]bool) map[string]map[string]bool {
+	difference := map[string]map[string]bool{}
+	for region, targets := range a {
+		for target := range targets {
+			if b[region][target] {
+				continue
+			}
+			if difference[region] == nil {
+				difference[region] = map[string]bool{}
+			}
+			difference[region][target] = true
+		}
+	}
+	return difference
+}
+
+// groupInstances groups regions deploying the same targets so that each group
+// is handled by a single operation. Groups are sorted for predictable
+// operations.
+func groupInstances(instances map[string]map[string]bool) []*instanceTargets {
+	groups := map[string]*instanceTargets{}
+	keys := []string{}
+	for region, set := range instances {
+		targets := make([]string, 0, len(set))
+		for target := range set {
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+
+		key := strings.Join(targets, ",")
+		group, ok := groups[key]
+		if !ok {
+			group = &instanceTargets{targets: targets}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.regions = append(group.regions, region)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]*instanceTargets, 0, len(keys))
+	for _, key := range keys {
+		sort.Strings(groups[key].regions)
+		sorted = append(sorted, groups[key])
+	}
+	return sorted
+}
+
+// waitForOperation polls a stack set operation until it finishes. The status
+// changes of the operation's stack instances are passed to consumer.
+func (s *StackSet) waitForOperation(operationId *string, consumer StackSetEventConsumer) error {
+	statuses := map[string]string{}
+
+	var status string
+	var attempts int
+	for attempts = 0; attempts < s.waitAttempts; attempts++ {
+		out, err := s.api.DescribeStackSetOperation(
+			&cloudformation.DescribeStackSetOperationInput{
+				StackSetName: aws.String(s.config.Name),
+				OperationId:  operationId,
+			},
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to describe stack set operation")
+		}
+		status = aws.StringValue(out.StackSetOperation.Status)
+
+		err = s.operationResults(out.StackSetOperation, statuses, consumer)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := stackSetOperationDoneStatuses[status]; ok {
+			break
+		}
+
+		if attempts != s.waitAttempts-1 {
+			s.waiter.wait()
+		}
+	}
+
+	if attempts == s.waitAttempts {
+		return errors.New(
+			"Stack set operation failed to complete in time. Check your stack set's operations in cloudformation.",
+		)
+	}
+
+	if !stackSetOperationDoneStatuses[status] {
+		return fmt.Errorf("stack set operation %s failed to complete. status: %s", aws.StringValue(operationId), status)
+	}
+	return nil
+}
+
+// operationResults passes the stack instances whose status changed since the
+// last call to consumer. statuses tracks the last status of each instance.
+func (s *StackSet) operationResults(operation *cloudformation.StackSetOperation, statuses map[string]string, consumer StackSetEventConsumer) error {
+	events := []*StackSetEvent{}
+	err := s.api.ListStackSetOperationResultsPages(
+		&cloudformation.ListStackSetOperationResultsInput{
+			StackSetName: aws.String(s.config.Name),
+			OperationId:  operation.OperationId,
+		},
+		func(out *cloudformation.ListStackSetOperationResultsOutput, lastPage bool) bool {
+			for _, result := range out.Summaries {
+				key := aws.StringValue(result.Account) + "/" + aws.StringValue(result.Region)
+				status := aws.StringValue(result.Status)
+				if statuses[key] == status {
+					continue
+				}
+				statuses[key] = status
+
+				events = append(events, &StackSetEvent{
+					OperationId:          aws.StringValue(operation.OperationId),
+					Action:               aws.StringValue(operation.Action),
+					Account:              aws.StringValue(result.Account),
+					OrganizationalUnitId: aws.StringValue(result.OrganizationalUnitId),
+					Region:               aws.StringValue(result.Region),
+					Status:               status,
+					StatusReason:         aws.StringValue(result.StatusReason),
+				})
+			}
+			return !lastPage
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed to list stack set operation results")
+	}
+
+	for _, event := range events {
+		if err := consumer.ConsumeStackSetEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// template returns either a TemplateBody or a TemplateURL for the configured
+// template.
+func (s *StackSet) template() (body *string, url *string, err error) {
+	if s.config.TemplateURL != "" {
+		return nil, aws.String(s.config.TemplateURL), nil
+	}
+
+	contents := []byte(s.config.TemplateBody)
+	if s.config.TemplatePath != "" {
+		contents, err = s.templateReader.ReadFile(s.config.TemplatePath)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(contents) > maxTemplateBodySize {
+		return nil, nil, fmt.Errorf(
+			"template is %d bytes which exceeds the %d byte TemplateBody limit. Upload it to S3 and set TemplateURL",
+			len(contents),
+			maxTemplateBodySize,
+		)
+	}
+	return aws.String(string(contents)), nil, nil
+}
+
+// parameters converts StackSetConfig.Parameters into Cloudformation
+// parameters. Parameters that use the stack set's previous value are only
+// allowed when updating a stack set.
+func (s *StackSet) parameters(creating bool) ([]*cloudformation.Parameter, error) {
+	return cloudformationParameters(s.config.Parameters, creating, "stack set "+s.config.Name)
+}
+
+func (s *StackSet) tags() []*cloudformation.Tag {
+	if len(s.config.Tags) == 0 {
+		return nil
+	}
+
+	tags := make([]*cloudformation.Tag, 0, len(s.config.Tags))
+	for k, v := range s.config.Tags {
+		tags = append(tags, &cloudformation.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return tags
+}
+
+func (s *StackSet) autoDeployment() *cloudformation.AutoDeployment {
+	if s.config.AutoDeployment == nil {
+		return nil
+	}
+	return &cloudformation.AutoDeployment{
+		Enabled:                      aws.Bool(s.config.AutoDeployment.Enabled),
+		RetainStacksOnAccountRemoval: aws.Bool(s.config.AutoDeployment.RetainStacksOnAccountRemoval),
+	}
+}
+
+func (s *StackSet) operationPreferences() *cloudformation.StackSetOperationPreferences {
+	preferences := s.config.OperationPreferences
+	if reflect.DeepEqual(preferences, StackSetOperationPreferences{}) {
+		return nil
+	}
+
+	out := cloudformation.StackSetOperationPreferences{}
+	if len(preferences.RegionOrder) > 0 {
+		out.RegionOrder = aws.StringSlice(preferences.RegionOrder)
+	}
+	if preferences.FailureToleranceCount != 0 {
+		out.FailureToleranceCount = aws.Int64(preferences.FailureToleranceCount)
+	}
+	if preferences.FailureTolerancePercentage != 0 {
+		out.FailureTolerancePercentage = aws.Int64(preferences.FailureTolerancePercentage)
+	}
+	if preferences.MaxConcurrentCount != 0 {
+		out.MaxConcurrentCount = aws.Int64(preferences.MaxConcurrentCount)
+	}
+	if preferences.MaxConcurrentPercentage != 0 {
+		out.MaxConcurrentPercentage = aws.Int64(preferences.MaxConcurrentPercentage)
+	}
+	return &out
+}
+
+func (s *StackSet) serviceManaged() bool {
+	return s.config.PermissionModel == cloudformation.PermissionModelsServiceManaged
+}
+
+// targets returns the organizational units of SERVICE_MANAGED stack sets or
+// the accounts of SELF_MANAGED stack sets.
+func (s *StackSet) targets() []string {
+	if s.serviceManaged() {
+		return s.config.DeploymentTargets.OrganizationalUnitIds
+	}
+	return s.config.DeploymentTargets.Accounts
+}
+
+// deploymentTargets returns the DeploymentTargets for the organizational
+// units of SERVICE_MANAGED stack sets.
+func (s *StackSet) deploymentTargets(targets []string) *cloudformation.DeploymentTargets {
+	if !s.serviceManaged() {
+		return nil
+	}
+	return &cloudformation.DeploymentTargets{OrganizationalUnitIds: aws.StringSlice(targets)}
+}
+
+// accounts returns the Accounts for SELF_MANAGED stack sets.
+func (s *StackSet) accounts(targets []string) []*string {
+	if s.serviceManaged() {
+		return nil
+	}
+	return aws.StringSlice(targets)
+}
+
+// equalStringSets reports whether a and b contain the same strings,
+// regardless of order.
+func equalStringSets(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, v := range a {
+		if !containsString(b, v) {
+			return false
+		}
+	}
+	return true
+}
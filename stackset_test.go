@@ -0,0 +1,312 @@
+package stackshot
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+// stackSetOperations simulates stack set operations. Each operation is
+// RUNNING the first time it's described and then finishes with SUCCEEDED, or
+// FAILED when its action is listed in failing.
+type stackSetOperations struct {
+	calls      []string
+	operations map[string]*stackSetOperation
+	failing    map[string]bool
+}
+
+type stackSetOperation struct {
+	action    string
+	accounts  []string
+	regions   []string
+	described int
+}
+
+func newStackSetOperations(api *MockAPI) *stackSetOperations {
+	ops := &stackSetOperations{operations: map[string]*stackSetOperation{}, failing: map[string]bool{}}
+
+	api.CreateStackSetFn = func(input *cfn.CreateStackSetInput) (*cfn.CreateStackSetOutput, error) {
+		ops.calls = append(ops.calls, "CreateStackSet")
+		return &cfn.CreateStackSetOutput{}, nil
+	}
+	api.UpdateStackSetFn = func(input *cfn.UpdateStackSetInput) (*cfn.UpdateStackSetOutput, error) {
+		id := ops.start("UPDATE", []string{"111111111111"}, []string{"us-east-1"})
+		return &cfn.UpdateStackSetOutput{OperationId: id}, nil
+	}
+	api.CreateStackInstancesFn = func(input *cfn.CreateStackInstancesInput) (*cfn.CreateStackInstancesOutput, error) {
+		id := ops.start("CREATE", instanceTargetsOf(input.Accounts, input.DeploymentTargets), aws.StringValueSlice(input.Regions))
+		return &cfn.CreateStackInstancesOutput{OperationId: id}, nil
+	}
+	api.DeleteStackInstancesFn = func(input *cfn.DeleteStackInstancesInput) (*cfn.DeleteStackInstancesOutput, error) {
+		id := ops.start("DELETE", instanceTargetsOf(input.Accounts, input.DeploymentTargets), aws.StringValueSlice(input.Regions))
+		return &cfn.DeleteStackInstancesOutput{OperationId: id}, nil
+	}
+	api.DescribeStackSetOperationFn = func(input *cfn.DescribeStackSetOperationInput) (*cfn.DescribeStackSetOperationOutput, error) {
+		op := ops.operations[aws.StringValue(input.OperationId)]
+		op.described++
+		return &cfn.DescribeStackSetOperationOutput{
+			StackSetOperation: &cfn.StackSetOperation{
+				OperationId: input.OperationId,
+				Action:      aws.String(op.action),
+				Status:      aws.String(ops.status(op)),
+			},
+		}, nil
+	}
+	api.ListStackSetOperationResultsPagesFn = func(input *cfn.ListStackSetOperationResultsInput, fn func(*cfn.ListStackSetOperationResultsOutput, bool) bool) error {
+		op := ops.operations[aws.StringValue(input.OperationId)]
+		out := cfn.ListStackSetOperationResultsOutput{}
+		for _, account := range op.accounts {
+			for _, region := range op.regions {
+				out.Summaries = append(out.Summaries, &cfn.StackSetOperationResultSummary{
+					Account: aws.String(account),
+					Region:  aws.String(region),
+					Status:  aws.String(ops.status(op)),
+				})
+			}
+		}
+		fn(&out, true)
+		return nil
+	}
+
+	return ops
+}
+
+func (o *stackSetOperations) start(action string, accounts, regions []string) *string {
+	id := fmt.Sprintf("op-%d", len(o.operations)+1)
+	o.operations[id] = &stackSetOperation{action: action, accounts: accounts, regions: regions}
+	o.calls = append(o.calls, fmt.Sprintf("%s %v %v", action, accounts, regions))
+	return aws.String(id)
+}
+
+func (o *stackSetOperations) status(op *stackSetOperation) string {
+	switch {
+	case op.described < 2:
+		return "RUNNING"
+	case o.failing[op.action]:
+		return "FAILED"
+	default:
+		return "SUCCEEDED"
+	}
+}
+
+func instanceTargetsOf(accounts []*string, targets *cfn.DeploymentTargets) []string {
+	if targets != nil {
+		return aws.StringValueSlice(targets.OrganizationalUnitIds)
+	}
+	return aws.StringValueSlice(accounts)
+}
+
+func GenListStackInstancesPagesFn(instances ...*cfn.StackInstanceSummary) func(*cfn.ListStackInstancesInput, func(*cfn.ListStackInstancesOutput, bool) bool) error {
+	return func(input *cfn.ListStackInstancesInput, fn func(*cfn.ListStackInstancesOutput, bool) bool) error {
+		fn(&cfn.ListStackInstancesOutput{Summaries: instances}, true)
+		return nil
+	}
+}
+
+func stackInstance(account, region string) *cfn.StackInstanceSummary {
+	return &cfn.StackInstanceSummary{Account: aws.String(account), Region: aws.String(region)}
+}
+
+func TestStackSetSync(t *testing.T) {
+	template := "Resources:\n  Topic:\n    Type: AWS::SNS::Topic\n"
+	notFound := awserr.New(cfn.ErrCodeStackSetNotFoundException, "StackSet baseline not found", nil)
+
+	current := &cfn.StackSet{
+		StackSetName: aws.String("baseline"),
+		TemplateBody: aws.String(template),
+		Parameters: []*cfn.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("production")},
+		},
+	}
+
+	tests := []struct {
+		description string
+		config      *StackSetConfig
+		current     *cfn.StackSet
+		instances   []*cfn.StackInstanceSummary
+		failing     string
+		calls       []string
+		events      []string
+		err         error
+	}{
+		{
+			description: "creates stack set and instances",
+			config: &StackSetConfig{
+				Name:              "baseline",
+				TemplateBody:      templateBody(template),
+				DeploymentTargets: StackSetDeploymentTargets{Accounts: []string{"111111111111", "222222222222"}},
+				Regions:           []string{"us-east-1", "eu-west-1"},
+			},
+			calls: []string{
+				"CreateStackSet",
+				"CREATE [111111111111 222222222222] [eu-west-1 us-east-1]",
+			},
+			events: []string{
+				"CREATE 111111111111 eu-west-1 RUNNING",
+				"CREATE 111111111111 us-east-1 RUNNING",
+				"CREATE 222222222222 eu-west-1 RUNNING",
+				"CREATE 222222222222 us-east-1 RUNNING",
+				"CREATE 111111111111 eu-west-1 SUCCEEDED",
+				"CREATE 111111111111 us-east-1 SUCCEEDED",
+				"CREATE 222222222222 eu-west-1 SUCCEEDED",
+				"CREATE 222222222222 us-east-1 SUCCEEDED",
+			},
+		},
+		{
+			description: "adds and removes instances of an up to date stack set",
+			config: &StackSetConfig{
+				Name:              "baseline",
+				TemplateBody:      templateBody(template),
+				Parameters:        map[string]ParameterValue{"Env": {Value: "production"}},
+				DeploymentTargets: StackSetDeploymentTargets{Accounts: []string{"111111111111", "222222222222"}},
+				Regions:           []string{"us-east-1", "eu-west-1"},
+			},
+			current: current,
+			instances: []*cfn.StackInstanceSummary{
+				stackInstance("111111111111", "us-east-1"),
+				stackInstance("111111111111", "eu-west-1"),
+				stackInstance("222222222222", "us-east-1"),
+				stackInstance("333333333333", "us-east-1"),
+				stackInstance("333333333333", "ap-southeast-2"),
+			},
+			calls: []string{
+				"CREATE [222222222222] [eu-west-1]",
+				"DELETE [333333333333] [ap-southeast-2 us-east-1]",
+			},
+			events: []string{
+				"CREATE 222222222222 eu-west-1 RUNNING",
+				"CREATE 222222222222 eu-west-1 SUCCEEDED",
+				"DELETE 333333333333 ap-southeast-2 RUNNING",
+				"DELETE 333333333333 us-east-1 RUNNING",
+				"DELETE 333333333333 ap-southeast-2 SUCCEEDED",
+				"DELETE 333333333333 us-east-1 SUCCEEDED",
+			},
+		},
+		{
+			description: "updates a changed stack set",
+			config: &StackSetConfig{
+				Name:              "baseline",
+				TemplateBody:      templateBody(template),
+				Parameters:        map[string]ParameterValue{"Env": {Value: "staging"}},
+				DeploymentTargets: StackSetDeploymentTargets{Accounts: []string{"111111111111"}},
+				Regions:           []string{"us-east-1"},
+			},
+			current:   current,
+			instances: []*cfn.StackInstanceSummary{stackInstance("111111111111", "us-east-1")},
+			calls:     []string{"UPDATE [111111111111] [us-east-1]"},
+			events: []string{
+				"UPDATE 111111111111 us-east-1 RUNNING",
+				"UPDATE 111111111111 us-east-1 SUCCEEDED",
+			},
+		},
+		{
+			description: "deploys service managed stack sets to organizational units",
+			config: &StackSetConfig{
+				Name:              "baseline",
+				TemplateBody:      templateBody(template),
+				PermissionModel:   "SERVICE_MANAGED",
+				DeploymentTargets: StackSetDeploymentTargets{OrganizationalUnitIds: []string{"ou-abcd-1234"}},
+				Regions:           []string{"us-east-1"},
+			},
+			calls: []string{
+				"CreateStackSet",
+				"CREATE [ou-abcd-1234] [us-east-1]",
+			},
+			events: []string{
+				"CREATE ou-abcd-1234 us-east-1 RUNNING",
+				"CREATE ou-abcd-1234 us-east-1 SUCCEEDED",
+			},
+		},
+		{
+			description: "failed operation",
+			config: &StackSetConfig{
+				Name:              "baseline",
+				TemplateBody:      templateBody(template),
+				DeploymentTargets: StackSetDeploymentTargets{Accounts: []string{"111111111111"}},
+				Regions:           []string{"us-east-1"},
+			},
+			failing: "CREATE",
+			calls: []string{
+				"CreateStackSet",
+				"CREATE [111111111111] [us-east-1]",
+			},
+			events: []string{
+				"CREATE 111111111111 us-east-1 RUNNING",
+				"CREATE 111111111111 us-east-1 FAILED",
+			},
+			err: fmt.Errorf("stack set operation op-1 failed to complete. status: FAILED"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			api := &MockAPI{}
+			api.DescribeStackSetFn = func(input *cfn.DescribeStackSetInput) (*cfn.DescribeStackSetOutput, error) {
+				if test.current == nil {
+					return nil, notFound
+				}
+				return &cfn.DescribeStackSetOutput{StackSet: test.current}, nil
+			}
+			api.ListStackInstancesPagesFn = GenListStackInstancesPagesFn(test.instances...)
+			ops := newStackSetOperations(api)
+			if test.failing != "" {
+				ops.failing[test.failing] = true
+			}
+
+			stackSet, err := LoadStackSet(api, test.config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			stackSet.waiter = &impatientWaiter{}
+
+			events := []string{}
+			consumer := StackSetEventConsumerFunc(func(event *StackSetEvent) error {
+				target := event.Account
+				if event.OrganizationalUnitId != "" {
+					target = event.OrganizationalUnitId
+				}
+				events = append(events, fmt.Sprintf("%s %s %s %s", event.Action, target, event.Region, event.Status))
+				return nil
+			})
+
+			err = stackSet.SyncAndPollEvents(consumer)
+			if !equalErrors(err, test.err) {
+				t.Fatalf("Expected error: %v, got: %v", test.err, err)
+			}
+
+			if !cmp.Equal(ops.calls, test.calls) {
+				t.Errorf("Unexpected calls: %s", cmp.Diff(test.calls, ops.calls))
+			}
+			if !cmp.Equal(events, test.events) {
+				t.Errorf("Unexpected events: %s", cmp.Diff(test.events, events))
+			}
+		})
+	}
+}
+
+func TestStackSetOperationTimeout(t *testing.T) {
+	api := &MockAPI{}
+	api.DescribeStackSetOperationFn = func(input *cfn.DescribeStackSetOperationInput) (*cfn.DescribeStackSetOperationOutput, error) {
+		return &cfn.DescribeStackSetOperationOutput{
+			StackSetOperation: &cfn.StackSetOperation{OperationId: input.OperationId, Status: aws.String("RUNNING")},
+		}, nil
+	}
+	api.ListStackSetOperationResultsPagesFn = func(input *cfn.ListStackSetOperationResultsInput, fn func(*cfn.ListStackSetOperationResultsOutput, bool) bool) error {
+		return nil
+	}
+
+	stackSet := &StackSet{
+		api:          api,
+		config:       &StackSetConfig{Name: "baseline"},
+		waiter:       &impatientWaiter{},
+		waitAttempts: 3,
+	}
+	err := stackSet.waitForOperation(aws.String("op-1"), StackSetEventConsumerFunc(StackSetEventPrinter))
+	if err == nil {
+		t.Fatalf("Expected an error for an operation that never finishes")
+	}
+}
@@ -0,0 +1,186 @@
+package stackshot
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// StackStatus describes a Cloudformation Stack as of the last time it was
+// loaded, along with how its parameters compare with its StackConfig.
+type StackStatus struct {
+	Name   string `json:"name"`
+	Region string `json:"region,omitempty"`
+
+	// Exists is false when the stack hasn't been created yet. The remaining
+	// fields are empty when it's false.
+	Exists bool `json:"exists"`
+
+	StackId      string     `json:"stack_id,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	StatusReason string     `json:"status_reason,omitempty"`
+	LastUpdated  *time.Time `json:"last_updated,omitempty"`
+
+	// DriftStatus is the result of the last drift detection, or
+	// NOT_CHECKED when drift was never detected.
+	DriftStatus    string     `json:"drift_status,omitempty"`
+	DriftCheckedAt *time.Time `json:"drift_checked_at,omitempty"`
+
+	TerminationProtection bool `json:"termination_protection"`
+
+	Parameters []*ParameterStatus `json:"parameters,omitempty"`
+	Outputs    Outputs            `json:"outputs,omitempty"`
+}
+
+// ParameterStatus compares a deployed parameter value with the StackConfig's.
+type ParameterStatus struct {
+	Key        string `json:"key"`
+	Deployed   string `json:"deployed"`
+	Configured string `json:"configured"`
+
+	// InSync is false when the values differ or the parameter is configured
+	// but not deployed. Parameters the StackConfig doesn't set, which use the
+	// template's defaults, are in sync, as are parameters using
+	// UsePreviousValue and NoEcho parameters, which can't be compared.
+	InSync bool `json:"in_sync"`
+}
+
+// Status describes the stack as of the last time it was loaded.
+func (s *Stack) Status() *StackStatus {
+	status := &StackStatus{Name: s.config.Name, Region: s.config.Region}
+	if s.cloudStack == nil {
+		return status
+	}
+
+	stack := s.cloudStack
+	status.Exists = true
+	status.StackId = aws.StringValue(stack.StackId)
+	status.Status = aws.StringValue(stack.StackStatus)
+	status.StatusReason = aws.StringValue(stack.StackStatusReason)
+	status.LastUpdated = stack.CreationTime
+	if stack.LastUpdatedTime != nil {
+		status.LastUpdated = stack.LastUpdatedTime
+	}
+	if stack.DriftInformation != nil {
+		status.DriftStatus = aws.StringValue(stack.DriftInformation.StackDriftStatus)
+		status.DriftCheckedAt = stack.DriftInformation.LastCheckTimestamp
+	}
+	status.TerminationProtection = aws.BoolValue(stack.EnableTerminationProtection)
+	status.Parameters = s.parameterStatuses()
+	status.Outputs = s.Outputs()
+	return status
+}
+
+// parameterStatuses compares every deployed or configured parameter, sorted
+// by key.
+func (s *Stack) parameterStatuses() []*ParameterStatus {
+	statuses := map[string]*ParameterStatus{}
+	for _, parameter := range s.cloudStack.Parameters {
+		key := aws.StringValue(parameter.ParameterKey)
+		statuses[key] = &ParameterStatus{Key: key, Deployed: aws.StringValue(parameter.ParameterValue), InSync: true}
+	}
+
+	for key, value := range s.config.Parameters {
+		status, deployed := statuses[key]
+		if !deployed {
+			status = &ParameterStatus{Key: key}
+			statuses[key] = status
+		}
+
+		status.Configured = value.Value
+		switch {
+		case value.UsePreviousValue:
+			status.Configured = "(previous value)"
+			status.InSync = deployed
+		case status.Deployed == noEchoValue:
+			status.InSync = true
+		default:
+			status.InSync = deployed && status.Deployed == value.Value
+		}
+	}
+
+	keys := make([]string, 0, len(statuses))
+	for key := range statuses {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]*ParameterStatus, len(keys))
+	for i, key := range keys {
+		sorted[i] = statuses[key]
+	}
+	return sorted
+}
+
+func (s *StackStatus) String() string {
+	buf := bytes.Buffer{}
+	name := s.Name
+	if s.Region != "" {
+		name += " (" + s.Region + ")"
+	}
+	fmt.Fprintf(&buf, "%s\n", name)
+
+	if !s.Exists {
+		fmt.Fprintf(&buf, "  Stack does not exist\n")
+		return buf.String()
+	}
+
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	status := s.Status
+	if s.StatusReason != "" {
+		status += " (" + s.StatusReason + ")"
+	}
+	fmt.Fprintf(w, "  Status:\t%s\n", status)
+	if s.LastUpdated != nil {
+		fmt.Fprintf(w, "  Last updated:\t%s\n", s.LastUpdated.Format(time.RFC3339))
+	}
+	drift := s.DriftStatus
+	if s.DriftCheckedAt != nil {
+		drift += fmt.Sprintf(" (checked %s)", s.DriftCheckedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "  Drift:\t%s\n", drift)
+	protection := "disabled"
+	if s.TerminationProtection {
+		protection = "enabled"
+	}
+	fmt.Fprintf(w, "  Termination protection:\t%s\n", protection)
+	w.Flush()
+
+	if len(s.Parameters) > 0 {
+		fmt.Fprintf(&buf, "  Parameters:\n")
+		table := bytes.Buffer{}
+		w = tabwriter.NewWriter(&table, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "    KEY\tDEPLOYED\tCONFIGURED\t\n")
+		for _, parameter := range s.Parameters {
+			differs := ""
+			if !parameter.InSync {
+				differs = "differs"
+			}
+			fmt.Fprintf(w, "    %s\t%s\t%s\t%s\n", parameter.Key, parameter.Deployed, parameter.Configured, differs)
+		}
+		w.Flush()
+
+		// The last column is only filled for parameters that differ.
+		for _, line := range strings.SplitAfter(table.String(), "\n") {
+			buf.WriteString(strings.TrimRight(line, " \n"))
+			if line != "" {
+				buf.WriteString("\n")
+			}
+		}
+	}
+
+	if len(s.Outputs) > 0 {
+		fmt.Fprintf(&buf, "  Outputs:\n")
+		w = tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		for _, key := range s.Outputs.Keys() {
+			fmt.Fprintf(w, "    %s\t%s\n", key, s.Outputs[key].Value)
+		}
+		w.Flush()
+	}
+	return buf.String()
+}
@@ -0,0 +1,100 @@
+package stackshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatus(t *testing.T) {
+	config := &StackConfig{
+		Name:   "mystack",
+		Region: "us-east-1",
+		Parameters: map[string]ParameterValue{
+			"Env":      {Value: "production"},
+			"Size":     {Value: "large"},
+			"Password": {Value: "hunter2"},
+			"VpcId":    {UsePreviousValue: true},
+			"Added":    {Value: "new"},
+		},
+	}
+
+	stack := &Stack{config: config}
+	missing := stack.Status()
+	if !cmp.Equal(missing, &StackStatus{Name: "mystack", Region: "us-east-1"}) {
+		t.Errorf("Unexpected status of a missing stack: %+v", missing)
+	}
+	if missing.String() != "mystack (us-east-1)\n  Stack does not exist\n" {
+		t.Errorf("Unexpected status:\n%s", missing)
+	}
+
+	created := time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2020, 9, 2, 12, 0, 0, 0, time.UTC)
+	stack.cloudStack = &cfn.Stack{
+		StackId:                     aws.String("arn:mystack"),
+		StackStatus:                 aws.String("UPDATE_COMPLETE"),
+		CreationTime:                &created,
+		LastUpdatedTime:             &updated,
+		EnableTerminationProtection: aws.Bool(true),
+		DriftInformation: &cfn.StackDriftInformation{
+			StackDriftStatus: aws.String("NOT_CHECKED"),
+		},
+		Parameters: []*cfn.Parameter{
+			{ParameterKey: aws.String("Env"), ParameterValue: aws.String("production")},
+			{ParameterKey: aws.String("Size"), ParameterValue: aws.String("small")},
+			{ParameterKey: aws.String("Password"), ParameterValue: aws.String("****")},
+			{ParameterKey: aws.String("VpcId"), ParameterValue: aws.String("vpc-123")},
+			{ParameterKey: aws.String("Default"), ParameterValue: aws.String("default")},
+		},
+		Outputs: []*cfn.Output{
+			{OutputKey: aws.String("ApiUrl"), OutputValue: aws.String("https://api.example.com")},
+		},
+	}
+
+	status := stack.Status()
+	expected := &StackStatus{
+		Name:                  "mystack",
+		Region:                "us-east-1",
+		Exists:                true,
+		StackId:               "arn:mystack",
+		Status:                "UPDATE_COMPLETE",
+		LastUpdated:           &updated,
+		DriftStatus:           "NOT_CHECKED",
+		TerminationProtection: true,
+		Parameters: []*ParameterStatus{
+			{Key: "Added", Configured: "new"},
+			{Key: "Default", Deployed: "default", InSync: true},
+			{Key: "Env", Deployed: "production", Configured: "production", InSync: true},
+			{Key: "Password", Deployed: "****", Configured: "hunter2", InSync: true},
+			{Key: "Size", Deployed: "small", Configured: "large"},
+			{Key: "VpcId", Deployed: "vpc-123", Configured: "(previous value)", InSync: true},
+		},
+		Outputs: Outputs{"ApiUrl": {Value: "https://api.example.com"}},
+	}
+	if !cmp.Equal(status, expected) {
+		t.Errorf("Unexpected status: %s", cmp.Diff(expected, status))
+	}
+
+	text := `mystack (us-east-1)
+  Status:                  UPDATE_COMPLETE
+  Last updated:            2020-09-02T12:00:00Z
+  Drift:                   NOT_CHECKED
+  Termination protection:  enabled
+  Parameters:
+    KEY       DEPLOYED    CONFIGURED
+    Added                 new               differs
+    Default   default
+    Env       production  production
+    Password  ****        hunter2
+    Size      small       large             differs
+    VpcId     vpc-123     (previous value)
+  Outputs:
+    ApiUrl  https://api.example.com
+`
+	if status.String() != text {
+		t.Errorf("Unexpected status:\n%s", cmp.Diff(text, status.String()))
+	}
+}
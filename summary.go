@@ -0,0 +1,93 @@
+package stackshot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// StackSummary summarizes the sync of a single stack or stack set for a
+// deployment summary.
+type StackSummary struct {
+	Name   string
+	Region string
+
+	// File is the configuration file the stack was read from.
+	File string
+
+	// Result is SyncSucceeded, SyncFailed, or SyncUnchanged.
+	Result   string
+	Error    string
+	Duration time.Duration
+
+	Resources []*ResourceResult
+	Outputs   Outputs
+
+	// FailureReasons are the root causes of a failed sync found in the
+	// stack's events. See FailureReasons().
+	FailureReasons []string
+}
+
+// ResourceResult is the last status of a resource changed by a sync.
+type ResourceResult struct {
+	LogicalResourceId string
+	ResourceType      string
+	Status            string
+}
+
+// ResourceResults returns the last status of every resource in a stack's
+// events, sorted by logical ID. The stack's own events are left out.
+func ResourceResults(events []*cloudformation.StackEvent) []*ResourceResult {
+	results := map[string]*ResourceResult{}
+	for _, event := range events {
+		if aws.StringValue(event.ResourceType) == "AWS::CloudFormation::Stack" &&
+			aws.StringValue(event.LogicalResourceId) == aws.StringValue(event.StackName) {
+			continue
+		}
+
+		id := aws.StringValue(event.LogicalResourceId)
+		results[id] = &ResourceResult{
+			LogicalResourceId: id,
+			ResourceType:      aws.StringValue(event.ResourceType),
+			Status:            aws.StringValue(event.ResourceStatus),
+		}
+	}
+
+	ids := make([]string, 0, len(results))
+	for id := range results {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	sorted := make([]*ResourceResult, len(ids))
+	for i, id := range ids {
+		sorted[i] = results[id]
+	}
+	return sorted
+}
+
+// FailureReasons returns why resources failed in a stack's events, in the
+// order they failed. Resources cancelled because another resource failed are
+// left out since their reasons don't point at the root cause.
+func FailureReasons(events []*cloudformation.StackEvent) []string {
+	reasons := []string{}
+	for _, event := range events {
+		status := aws.StringValue(event.ResourceStatus)
+		reason := aws.StringValue(event.ResourceStatusReason)
+		if !strings.HasSuffix(status, "_FAILED") || reason == "" || strings.Contains(reason, "cancelled") {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf(
+			"%s (%s) %s: %s",
+			aws.StringValue(event.LogicalResourceId),
+			aws.StringValue(event.ResourceType),
+			status,
+			reason,
+		))
+	}
+	return reasons
+}
@@ -0,0 +1,64 @@
+package stackshot
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResourceResults(t *testing.T) {
+	event := func(resource, resourceType, status string) *cfn.StackEvent {
+		return &cfn.StackEvent{
+			StackName:         aws.String("mystack"),
+			LogicalResourceId: aws.String(resource),
+			ResourceType:      aws.String(resourceType),
+			ResourceStatus:    aws.String(status),
+		}
+	}
+
+	results := ResourceResults([]*cfn.StackEvent{
+		event("mystack", "AWS::CloudFormation::Stack", "UPDATE_IN_PROGRESS"),
+		event("MyQueue", "AWS::SQS::Queue", "UPDATE_IN_PROGRESS"),
+		event("MyBucket", "AWS::S3::Bucket", "CREATE_IN_PROGRESS"),
+		event("MyQueue", "AWS::SQS::Queue", "UPDATE_COMPLETE"),
+		event("MyBucket", "AWS::S3::Bucket", "CREATE_COMPLETE"),
+		event("mystack", "AWS::CloudFormation::Stack", "UPDATE_COMPLETE"),
+	})
+
+	expected := []*ResourceResult{
+		{LogicalResourceId: "MyBucket", ResourceType: "AWS::S3::Bucket", Status: "CREATE_COMPLETE"},
+		{LogicalResourceId: "MyQueue", ResourceType: "AWS::SQS::Queue", Status: "UPDATE_COMPLETE"},
+	}
+	if !cmp.Equal(results, expected) {
+		t.Errorf("Unexpected results: %s", cmp.Diff(expected, results))
+	}
+}
+
+func TestFailureReasons(t *testing.T) {
+	event := func(resource, status, reason string) *cfn.StackEvent {
+		return &cfn.StackEvent{
+			LogicalResourceId:    aws.String(resource),
+			ResourceType:         aws.String("AWS::S3::Bucket"),
+			ResourceStatus:       aws.String(status),
+			ResourceStatusReason: aws.String(reason),
+		}
+	}
+
+	reasons := FailureReasons([]*cfn.StackEvent{
+		event("Logs", "CREATE_IN_PROGRESS", "Resource creation Initiated"),
+		event("Assets", "CREATE_FAILED", "Bucket assets already exists"),
+		event("Logs", "CREATE_FAILED", "Resource creation cancelled"),
+		event("Backups", "DELETE_FAILED", "The bucket you tried to delete is not empty"),
+		event("Archive", "UPDATE_FAILED", ""),
+	})
+
+	expected := []string{
+		"Assets (AWS::S3::Bucket) CREATE_FAILED: Bucket assets already exists",
+		"Backups (AWS::S3::Bucket) DELETE_FAILED: The bucket you tried to delete is not empty",
+	}
+	if !cmp.Equal(reasons, expected) {
+		t.Errorf("Unexpected reasons: %s", cmp.Diff(expected, reasons))
+	}
+}
@@ -0,0 +1,134 @@
+package stackshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// parseTemplate parses a JSON or YAML Cloudformation template into a yaml.Node
+// tree. Unlike converting the template to JSON, the node tree keeps short-form
+// intrinsic function tags (!Ref, !Sub, ...), comments, and key order, so the
+// template can be re-encoded without losing anything the author wrote.
+func parseTemplate(body []byte) (*yaml.Node, error) {
+	doc := yaml.Node{}
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to parse template")
+	}
+
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("failed to parse template: template is not a mapping")
+	}
+	return &doc, nil
+}
+
+// templateRoot returns the top-level mapping of a document parsed by
+// parseTemplate().
+func templateRoot(doc *yaml.Node) *yaml.Node {
+	return doc.Content[0]
+}
+
+// mappingValue returns the value for key in a mapping node or nil when node
+// isn't a mapping or doesn't contain key.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingEntries calls fn for every key/value pair of a mapping node in the
+// order they appear in the template.
+func mappingEntries(node *yaml.Node, fn func(key string, value *yaml.Node)) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i].Value, node.Content[i+1])
+	}
+}
+
+// isPlainString reports whether node is an untagged string scalar, i.e. not
+// an intrinsic function like !Ref or !Sub.
+func isPlainString(node *yaml.Node) bool {
+	return node != nil && node.Kind == yaml.ScalarNode && node.Tag == "!!str"
+}
+
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// isJSONTemplate reports whether a template is written in JSON rather than
+// YAML.
+func isJSONTemplate(body []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))
+}
+
+// encodeJSONTemplate encodes a template parsed by parseTemplate() as indented
+// JSON, preserving key order.
+func encodeJSONTemplate(doc *yaml.Node) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if err := writeJSONNode(&buf, templateRoot(doc)); err != nil {
+		return nil, errors.Wrap(err, "failed to encode template")
+	}
+
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return nil, errors.Wrap(err, "failed to encode template")
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!int", "!!float", "!!bool", "!!null":
+			buf.WriteString(node.Value)
+		case "!!str":
+			value, _ := json.Marshal(node.Value)
+			buf.Write(value)
+		default:
+			return fmt.Errorf("line %d: %s tags cannot be written as JSON", node.Line, node.Tag)
+		}
+	case yaml.AliasNode:
+		return writeJSONNode(buf, node.Alias)
+	default:
+		return fmt.Errorf("line %d: unsupported YAML node", node.Line)
+	}
+	return nil
+}
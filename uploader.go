@@ -0,0 +1,90 @@
+package stackshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+)
+
+// maxTemplateBodySize is the largest template, in bytes, Cloudformation
+// accepts inline as TemplateBody. Larger templates must be uploaded to S3 and
+// referenced with TemplateURL.
+const maxTemplateBodySize = 51200
+
+// Uploader is an interface used by Stack to upload templates that are too
+// large to send inline to Cloudformation. Upload stores body at key within
+// bucket and returns a URL Cloudformation can read the object from.
+type Uploader interface {
+	Upload(bucket, key string, body []byte) (string, error)
+}
+
+// S3Uploader implements Uploader by storing objects in S3. Objects that
+// already exist are not uploaded again.
+type S3Uploader struct {
+	api    s3iface.S3API
+	region string
+}
+
+// NewS3Uploader allocates an S3Uploader. region is the region of the buckets
+// objects are uploaded to and is used to build the returned object URLs.
+func NewS3Uploader(api s3iface.S3API, region string) *S3Uploader {
+	return &S3Uploader{api: api, region: region}
+}
+
+func (u *S3Uploader) Upload(bucket, key string, body []byte) (string, error) {
+	_, err := u.api.HeadObject(
+		&s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		},
+	)
+	if err != nil {
+		if !objectDoesNotExist(err) {
+			return "", errors.Wrapf(err, "failed to check for s3://%s/%s", bucket, key)
+		}
+
+		_, err = u.api.PutObject(
+			&s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+				Body:   bytes.NewReader(body),
+			},
+		)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to upload s3://%s/%s", bucket, key)
+		}
+	}
+
+	return u.url(bucket, key), nil
+}
+
+// url returns a path-style URL so that bucket names containing dots remain
+// valid hostnames.
+func (u *S3Uploader) url(bucket, key string) string {
+	return fmt.Sprintf("https://s3.%s.amazonaws.com/%s/%s", u.region, bucket, key)
+}
+
+// contentKey returns an S3 key derived from the SHA-256 of body. Identical
+// content always maps to the same key, which lets uploads be skipped when the
+// object already exists.
+func contentKey(body []byte, extension string) string {
+	sum := sha256.Sum256(body)
+	return "stackshot/" + hex.EncodeToString(sum[:]) + extension
+}
+
+// objectDoesNotExist inspects an error returned by HeadObject. HeadObject
+// responses have no body, so a missing object is reported with the generic
+// "NotFound" code rather than s3.ErrCodeNoSuchKey.
+func objectDoesNotExist(err error) bool {
+	if awsErr, ok := errors.Cause(err).(awserr.Error); ok {
+		return awsErr.Code() == "NotFound" || awsErr.Code() == s3.ErrCodeNoSuchKey
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package stackshot
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/pkg/errors"
+)
+
+// MockS3API implements the s3iface.S3API interface. Like MockAPI, each
+// required method has a corresponding <method>Fn field.
+type MockS3API struct {
+	s3iface.S3API
+
+	HeadObjectFn func(*s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	PutObjectFn  func(*s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+func (m *MockS3API) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return m.HeadObjectFn(input)
+}
+
+func (m *MockS3API) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return m.PutObjectFn(input)
+}
+
+// recordingUploader implements Uploader and records the uploaded objects.
+type recordingUploader struct {
+	objects map[string][]byte
+}
+
+func (r *recordingUploader) Upload(bucket, key string, body []byte) (string, error) {
+	if r.objects == nil {
+		r.objects = map[string][]byte{}
+	}
+	r.objects[bucket+"/"+key] = body
+	return "https://s3.us-east-1.amazonaws.com/" + bucket + "/" + key, nil
+}
+
+func TestS3Uploader(t *testing.T) {
+	body := []byte("AWSTemplateFormatVersion: 2010-09-09")
+	key := contentKey(body, ".template")
+
+	t.Run(
+		"Uploads missing objects",
+		func(t *testing.T) {
+			var put *s3.PutObjectInput
+			api := MockS3API{}
+			api.HeadObjectFn = func(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+				return nil, awserr.New("NotFound", "Not Found", nil)
+			}
+			api.PutObjectFn = func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+				put = input
+				return &s3.PutObjectOutput{}, nil
+			}
+
+			url, err := NewS3Uploader(&api, "us-west-2").Upload("templates", key, body)
+			if err != nil {
+				t.Fatalf("Expected Upload() to succeed. Got error: %s", err)
+			}
+
+			expURL := "https://s3.us-west-2.amazonaws.com/templates/" + key
+			if url != expURL {
+				t.Errorf("Expected URL: %s. Got: %s", expURL, url)
+			}
+			if put == nil {
+				t.Fatalf("Expected PutObject to be called. It was not")
+			}
+			if aws.StringValue(put.Key) != key {
+				t.Errorf("Expected key: %s. Got: %s", key, aws.StringValue(put.Key))
+			}
+			uploaded, _ := ioutil.ReadAll(put.Body)
+			if string(uploaded) != string(body) {
+				t.Errorf("Expected body: %s. Got: %s", body, uploaded)
+			}
+		},
+	)
+
+	t.Run(
+		"Skips existing objects",
+		func(t *testing.T) {
+			api := MockS3API{}
+			api.HeadObjectFn = func(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+				return &s3.HeadObjectOutput{}, nil
+			}
+			api.PutObjectFn = func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+				t.Errorf("Expected PutObject to not be called")
+				return nil, nil
+			}
+
+			_, err := NewS3Uploader(&api, "us-west-2").Upload("templates", key, body)
+			if err != nil {
+				t.Errorf("Expected Upload() to succeed. Got error: %s", err)
+			}
+		},
+	)
+
+	t.Run(
+		"Fails when HeadObject fails",
+		func(t *testing.T) {
+			api := MockS3API{}
+			api.HeadObjectFn = func(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+				return nil, awserr.New("Forbidden", "Forbidden", errors.New("orig error"))
+			}
+
+			_, err := NewS3Uploader(&api, "us-west-2").Upload("templates", key, body)
+			if err == nil {
+				t.Errorf("Expected Upload() to fail. Got success")
+			}
+		},
+	)
+}
@@ -0,0 +1,317 @@
+package stackshot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationErrors is returned when a StackConfig doesn't satisfy its
+// template. It lists every problem found so they can be fixed at once rather
+// than one failed deploy at a time.
+type ValidationErrors []string
+
+func (v ValidationErrors) Error() string {
+	return fmt.Sprintf(
+		"stack configuration failed validation:\n  - %s",
+		strings.Join(v, "\n  - "),
+	)
+}
+
+// templateParameter is a parameter declared by a template.
+type templateParameter struct {
+	Key           string
+	Type          string
+	HasDefault    bool
+	AllowedValues []string
+}
+
+// templateSummary describes what a template requires from a StackConfig.
+type templateSummary struct {
+	Parameters   []*templateParameter
+	Capabilities []string
+}
+
+// Validate checks the StackConfig against its template without creating or
+// updating the stack. The template is validated by Cloudformation and its
+// declared parameters and required capabilities are compared with the
+// StackConfig. All problems are returned together as ValidationErrors.
+//
+// Validate has no side effects: local artifacts aren't packaged and nothing is
+// uploaded. Local templates too large to send inline are checked the way
+// ValidateOffline() checks them instead.
+func (s *Stack) Validate() error {
+	if s.config.UsePreviousTemplate {
+		if s.cloudStack == nil {
+			return fmt.Errorf("UsePreviousTemplate cannot be used to create stack %s", s.config.Name)
+		}
+		return s.validateTemplate(nil, nil)
+	}
+
+	if s.config.TemplateURL != "" {
+		return s.validateTemplate(nil, aws.String(s.config.TemplateURL))
+	}
+
+	body, _, err := s.localTemplate()
+	if err != nil {
+		return err
+	}
+	if len(body) > maxTemplateBodySize {
+		return validateBodyOffline(s.config, body)
+	}
+	return s.validateTemplate(aws.String(string(body)), nil)
+}
+
+// validateTemplate checks the template with Cloudformation's ValidateTemplate
+// and cross-checks the StackConfig with GetTemplateSummary so problems are
+// reported before creating or updating the stack.
+//
+// When body and url are both nil, the stack's current template is
+// cross-checked instead. It was validated when it was deployed.
+func (s *Stack) validateTemplate(body, url *string) error {
+	summaryInput := cloudformation.GetTemplateSummaryInput{
+		TemplateBody: body,
+		TemplateURL:  url,
+	}
+
+	if body == nil && url == nil {
+		summaryInput.StackName = aws.String(s.config.Name)
+	} else {
+		_, err := s.api.ValidateTemplate(
+			&cloudformation.ValidateTemplateInput{
+				TemplateBody: body,
+				TemplateURL:  url,
+			},
+		)
+		if err != nil {
+			return errors.Wrap(err, "template failed validation")
+		}
+	}
+
+	out, err := s.api.GetTemplateSummary(&summaryInput)
+	if err != nil {
+		return errors.Wrap(err, "failed to load template summary")
+	}
+
+	summary := templateSummary{Capabilities: aws.StringValueSlice(out.Capabilities)}
+	for _, declaration := range out.Parameters {
+		parameter := &templateParameter{
+			Key:        aws.StringValue(declaration.ParameterKey),
+			Type:       aws.StringValue(declaration.ParameterType),
+			HasDefault: declaration.DefaultValue != nil,
+		}
+		if declaration.ParameterConstraints != nil {
+			parameter.AllowedValues = aws.StringValueSlice(declaration.ParameterConstraints.AllowedValues)
+		}
+		summary.Parameters = append(summary.Parameters, parameter)
+	}
+
+	if problems := checkStackConfig(s.config, &summary); len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// ValidateOffline checks a StackConfig against its local template without
+// calling any AWS APIs. The template's declared parameters are compared with
+// the StackConfig and the capabilities the template's resources require are
+// inferred. Templates referenced by TemplateURL cannot be validated offline.
+func ValidateOffline(config *StackConfig) error {
+	return validateOffline(config, osFileReader{})
+}
+
+// validateOffline implements ValidateOffline() reading TemplatePath with
+// reader.
+func validateOffline(config *StackConfig, reader localFileReader) error {
+	switch {
+	case config.UsePreviousTemplate:
+		return errors.New("stacks using UsePreviousTemplate cannot be validated offline")
+	case config.TemplateURL != "":
+		return errors.New("templates referenced by TemplateURL cannot be validated offline")
+	}
+
+	body, _, err := readLocalTemplate(config, reader)
+	if err != nil {
+		return err
+	}
+	return validateBodyOffline(config, body)
+}
+
+// validateBodyOffline checks config against the local template body.
+func validateBodyOffline(config *StackConfig, body []byte) error {
+	doc, err := parseTemplate(body)
+	if err != nil {
+		return ValidationErrors{err.Error()}
+	}
+
+	if problems := checkStackConfig(config, summarizeTemplate(doc)); len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// summarizeTemplate builds a templateSummary from a local template. Required
+// capabilities are inferred from the template's resources the same way
+// Cloudformation does for IAM resources and macros.
+func summarizeTemplate(doc *yaml.Node) *templateSummary {
+	root := templateRoot(doc)
+	summary := templateSummary{}
+
+	mappingEntries(mappingValue(root, "Parameters"), func(key string, declaration *yaml.Node) {
+		parameter := &templateParameter{
+			Key:        key,
+			HasDefault: mappingValue(declaration, "Default") != nil,
+		}
+		if parameterType := mappingValue(declaration, "Type"); parameterType != nil {
+			parameter.Type = parameterType.Value
+		}
+		if allowed := mappingValue(declaration, "AllowedValues"); allowed != nil {
+			for _, value := range allowed.Content {
+				parameter.AllowedValues = append(parameter.AllowedValues, value.Value)
+			}
+		}
+		summary.Parameters = append(summary.Parameters, parameter)
+	})
+
+	capabilities := map[string]bool{}
+	if mappingValue(root, "Transform") != nil {
+		capabilities[cloudformation.CapabilityCapabilityAutoExpand] = true
+	}
+	mappingEntries(mappingValue(root, "Resources"), func(_ string, resource *yaml.Node) {
+		resourceType := mappingValue(resource, "Type")
+		if resourceType == nil {
+			return
+		}
+		properties := mappingValue(resource, "Properties")
+
+		if nameProperty, ok := iamResources[resourceType.Value]; ok {
+			if nameProperty != "" && mappingValue(properties, nameProperty) != nil {
+				capabilities[cloudformation.CapabilityCapabilityNamedIam] = true
+			} else {
+				capabilities[cloudformation.CapabilityCapabilityIam] = true
+			}
+		}
+
+		// SAM creates an execution role for functions without one.
+		if resourceType.Value == "AWS::Serverless::Function" && mappingValue(properties, "Role") == nil {
+			capabilities[cloudformation.CapabilityCapabilityIam] = true
+		}
+	})
+
+	for capability := range capabilities {
+		summary.Capabilities = append(summary.Capabilities, capability)
+	}
+	sort.Strings(summary.Capabilities)
+	return &summary
+}
+
+// iamResources maps IAM resource types to the property that gives the
+// resource a custom name. Named IAM resources require CAPABILITY_NAMED_IAM
+// while the rest require CAPABILITY_IAM.
+var iamResources = map[string]string{
+	"AWS::IAM::AccessKey":           "",
+	"AWS::IAM::Group":               "GroupName",
+	"AWS::IAM::InstanceProfile":     "InstanceProfileName",
+	"AWS::IAM::ManagedPolicy":       "ManagedPolicyName",
+	"AWS::IAM::Policy":              "",
+	"AWS::IAM::Role":                "RoleName",
+	"AWS::IAM::User":                "UserName",
+	"AWS::IAM::UserToGroupAddition": "",
+}
+
+// checkStackConfig compares a StackConfig with what its template declares and
+// returns every problem found.
+func checkStackConfig(config *StackConfig, summary *templateSummary) ValidationErrors {
+	problems := ValidationErrors{}
+
+	declared := map[string]*templateParameter{}
+	for _, parameter := range summary.Parameters {
+		declared[parameter.Key] = parameter
+
+		value, ok := config.Parameters[parameter.Key]
+		if !ok {
+			if !parameter.HasDefault {
+				problems = append(
+					problems,
+					fmt.Sprintf("parameter %s is required by the template but not set", parameter.Key),
+				)
+			}
+			continue
+		}
+
+		if len(parameter.AllowedValues) > 0 && !value.UsePreviousValue {
+			for _, v := range parameterValues(parameter.Type, value.Value) {
+				if !containsString(parameter.AllowedValues, v) {
+					problems = append(
+						problems,
+						fmt.Sprintf(
+							"parameter %s has value %q which is not one of the allowed values: %s",
+							parameter.Key,
+							v,
+							strings.Join(parameter.AllowedValues, ", "),
+						),
+					)
+				}
+			}
+		}
+	}
+
+	unknown := []string{}
+	for key := range config.Parameters {
+		if _, ok := declared[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		problems = append(problems, fmt.Sprintf("parameter %s is not declared by the template", key))
+	}
+
+	for _, capability := range summary.Capabilities {
+		if !hasCapability(config.Capabilities, capability) {
+			problems = append(
+				problems,
+				fmt.Sprintf("template requires %s but it is not in Capabilities", capability),
+			)
+		}
+	}
+
+	return problems
+}
+
+// parameterValues splits list parameter values into the individual values
+// AllowedValues applies to.
+func parameterValues(parameterType, value string) []string {
+	if parameterType == "CommaDelimitedList" || strings.HasPrefix(parameterType, "List<") {
+		values := strings.Split(value, ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		return values
+	}
+	return []string{value}
+}
+
+// hasCapability reports whether capabilities satisfy required.
+// CAPABILITY_NAMED_IAM also satisfies CAPABILITY_IAM.
+func hasCapability(capabilities []string, required string) bool {
+	if containsString(capabilities, required) {
+		return true
+	}
+	return required == cloudformation.CapabilityCapabilityIam &&
+		containsString(capabilities, cloudformation.CapabilityCapabilityNamedIam)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package stackshot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCheckStackConfig(t *testing.T) {
+	summary := &templateSummary{
+		Parameters: []*templateParameter{
+			{Key: "Environment", AllowedValues: []string{"staging", "production"}},
+			{Key: "Subnets", Type: "List<AWS::EC2::Subnet::Id>", AllowedValues: []string{"subnet-a", "subnet-b"}},
+			{Key: "InstanceType", HasDefault: true},
+			{Key: "VpcId"},
+		},
+		Capabilities: []string{"CAPABILITY_IAM"},
+	}
+
+	tests := []struct {
+		name     string
+		config   StackConfig
+		problems ValidationErrors
+	}{
+		{
+			name: "Valid configuration",
+			config: StackConfig{
+				Parameters: map[string]ParameterValue{
+					"Environment": {Value: "production"},
+					"Subnets":     {Value: "subnet-a, subnet-b"},
+					"VpcId":       {UsePreviousValue: true},
+				},
+				Capabilities: []string{"CAPABILITY_NAMED_IAM"},
+			},
+			problems: ValidationErrors{},
+		},
+		{
+			name: "Every problem is reported",
+			config: StackConfig{
+				Parameters: map[string]ParameterValue{
+					"Environment": {Value: "prod"},
+					"Subnets":     {Value: "subnet-a,subnet-c"},
+					"VpcID":       {Value: "vpc-123"},
+				},
+			},
+			problems: ValidationErrors{
+				`parameter Environment has value "prod" which is not one of the allowed values: staging, production`,
+				`parameter Subnets has value "subnet-c" which is not one of the allowed values: subnet-a, subnet-b`,
+				"parameter VpcId is required by the template but not set",
+				"parameter VpcID is not declared by the template",
+				"template requires CAPABILITY_IAM but it is not in Capabilities",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(
+			test.name,
+			func(t *testing.T) {
+				problems := checkStackConfig(&test.config, summary)
+				if !cmp.Equal(problems, test.problems) {
+					t.Errorf("Expected problems:\n%v\nGot:\n%v", test.problems, problems)
+				}
+			},
+		)
+	}
+}
+
+func TestSummarizeTemplate(t *testing.T) {
+	template := `
+Transform: AWS::Serverless-2016-10-31
+Parameters:
+  Environment:
+    Type: String
+    AllowedValues: [staging, production]
+  Memory:
+    Type: Number
+    Default: 128
+Resources:
+  Role:
+    Type: AWS::IAM::Role
+    Properties:
+      RoleName: !Sub "${AWS::StackName}-role"
+  Function:
+    Type: AWS::Serverless::Function
+    Properties:
+      Role: !GetAtt Role.Arn
+`
+	doc, err := parseTemplate([]byte(template))
+	if err != nil {
+		t.Fatalf("Failed to parse template: %s", err)
+	}
+
+	summary := summarizeTemplate(doc)
+	expected := &templateSummary{
+		Parameters: []*templateParameter{
+			{Key: "Environment", Type: "String", AllowedValues: []string{"staging", "production"}},
+			{Key: "Memory", Type: "Number", HasDefault: true},
+		},
+		Capabilities: []string{"CAPABILITY_AUTO_EXPAND", "CAPABILITY_NAMED_IAM"},
+	}
+	if !cmp.Equal(summary, expected) {
+		t.Errorf("Expected:\n%#v\nGot:\n%#v", expected, summary)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	config := StackConfig{
+		Name:         "mystack",
+		TemplateBody: "Resources: {}",
+		Parameters:   map[string]ParameterValue{"Unknown": {Value: "value"}},
+	}
+
+	api := MockAPI{}
+	api.GetTemplateSummaryFn = GenGetTemplateSummaryFn(
+		[]string{"CAPABILITY_IAM"},
+		&cfn.ParameterDeclaration{ParameterKey: aws.String("Required")},
+	)
+	stack := Stack{api: &api, config: &config}
+
+	err := stack.Validate()
+	problems, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected ValidationErrors. Got: %#v", err)
+	}
+	if len(problems) != 3 {
+		t.Errorf("Expected 3 problems. Got: %v", problems)
+	}
+
+	// Local artifacts aren't packaged or uploaded.
+	template := "Resources:\n  Function:\n    Type: AWS::Lambda::Function\n    Properties:\n      Code: ./src\n"
+	config = StackConfig{Name: "mystack", TemplateBody: templateBody(template), TemplateBucket: "artifacts"}
+	api = MockAPI{}
+	api.ValidateTemplateFn = func(input *cfn.ValidateTemplateInput) (*cfn.ValidateTemplateOutput, error) {
+		if aws.StringValue(input.TemplateBody) != template {
+			t.Errorf("Expected the unpackaged template. Got: %s", aws.StringValue(input.TemplateBody))
+		}
+		return &cfn.ValidateTemplateOutput{}, nil
+	}
+	uploader := &recordingUploader{}
+	stack = Stack{api: &api, config: &config, uploader: uploader}
+	if err := stack.Validate(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(uploader.objects) != 0 {
+		t.Errorf("Expected nothing to be uploaded. Got: %v", uploader.objects)
+	}
+}
+
+func TestValidateOffline(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"template.yaml": "Parameters:\n  BucketName:\n    Type: String\nResources:\n  Bucket:\n    Type: AWS::S3::Bucket\n",
+	})
+	defer os.RemoveAll(dir)
+
+	config := StackConfig{
+		Name:         "mystack",
+		TemplatePath: filepath.Join(dir, "template.yaml"),
+	}
+	if err := ValidateOffline(&config); err == nil {
+		t.Errorf("Expected ValidateOffline() to fail for missing parameter. Got success")
+	}
+
+	config.Parameters = map[string]ParameterValue{"BucketName": {Value: "my-bucket"}}
+	if err := ValidateOffline(&config); err != nil {
+		t.Errorf("Expected ValidateOffline() to succeed. Got error: %s", err)
+	}
+
+	config = StackConfig{Name: "mystack", TemplateURL: "https://bucket.s3.amazonaws.com/template.yaml"}
+	if err := ValidateOffline(&config); err == nil {
+		t.Errorf("Expected ValidateOffline() to fail for TemplateURL. Got success")
+	}
+	// Templates are read through the stack's file reader.
+	config = StackConfig{Name: "mystack", TemplatePath: "template.yaml"}
+	reader := &stubFileReader{contents: "Parameters:\n  Env:\n    Type: String\nResources: {}\n"}
+	err := validateOffline(&config, reader)
+	expected := ValidationErrors{"parameter Env is required by the template but not set"}
+	if !cmp.Equal(err, expected) {
+		t.Errorf("Expected: %v. Got: %v", expected, err)
+	}
+}
@@ -0,0 +1,67 @@
+package stackshot
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// watchDoneStatuses are the statuses WatchEvents() stops at. Unlike a sync,
+// a watched operation may be a deletion, which succeeds once the stack is
+// deleted.
+var watchDoneStatuses = func() map[string]bool {
+	statuses := map[string]bool{}
+	for status, success := range stackDoneStatuses {
+		statuses[status] = success
+	}
+	for status, success := range stackDeletedStatuses {
+		statuses[status] = success
+	}
+	return statuses
+}()
+
+// WatchEvents passes the stack's new StackEvents to consumer until the stack
+// finishes the operation in progress, without changing the stack. It returns
+// an error when the operation fails. Nothing is watched when no operation is
+// in progress; see InProgress().
+func (s *Stack) WatchEvents(consumer EventConsumer) error {
+	if s.cloudStack == nil {
+		return fmt.Errorf(stackDoesNotExistErrorFmt, s.config.Name)
+	}
+	if !s.InProgress() {
+		return nil
+	}
+	return s.waitForStatus(consumer, watchDoneStatuses)
+}
+
+// FollowEvents passes the stack's new StackEvents to consumer as they happen,
+// across any number of operations, until stop is closed. It doesn't change
+// the stack.
+func (s *Stack) FollowEvents(consumer EventConsumer, stop <-chan struct{}) error {
+	if s.cloudStack == nil {
+		return fmt.Errorf(stackDoesNotExistErrorFmt, s.config.Name)
+	}
+
+	for {
+		if err := s.latestEvents(consumer); err != nil {
+			return err
+		}
+
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		s.waiter.wait()
+	}
+}
+
+// InProgress reports whether an operation is running on the stack as of the
+// last time it was loaded.
+func (s *Stack) InProgress() bool {
+	if s.cloudStack == nil {
+		return false
+	}
+	_, done := watchDoneStatuses[aws.StringValue(s.cloudStack.StackStatus)]
+	return !done
+}
@@ -0,0 +1,98 @@
+package stackshot
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	cfn "github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+func TestWatchEvents(t *testing.T) {
+	stackWithStatus := func(status string) *cfn.Stack {
+		return &cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String(status)}
+	}
+
+	tests := []struct {
+		name        string
+		statuses    []string
+		shouldError bool
+		events      int
+	}{
+		{"Idle stacks aren't watched", []string{"UPDATE_ROLLBACK_COMPLETE"}, false, 0},
+		{"Successful updates", []string{"UPDATE_IN_PROGRESS", "UPDATE_IN_PROGRESS", "UPDATE_COMPLETE"}, false, 2},
+		{"Failed updates", []string{"UPDATE_IN_PROGRESS", "UPDATE_ROLLBACK_COMPLETE"}, true, 1},
+		{"Deletions", []string{"DELETE_IN_PROGRESS", "DELETE_COMPLETE"}, false, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responses := []*describeStackResponse{}
+			for _, status := range test.statuses[1:] {
+				responses = append(responses, NewDescribeStackResponse(stackWithStatus(status)))
+			}
+
+			api := &MockAPI{}
+			api.DescribeStacksFn = NewDescribeStackPlayer(responses...).DescribeStacksFn
+			api.CreateStackFn = func(*cfn.CreateStackInput) (*cfn.CreateStackOutput, error) {
+				t.Fatalf("Unexpected call to CreateStack")
+				return nil, nil
+			}
+			api.UpdateStackFn = func(*cfn.UpdateStackInput) (*cfn.UpdateStackOutput, error) {
+				t.Fatalf("Unexpected call to UpdateStack")
+				return nil, nil
+			}
+
+			stack := &Stack{
+				api:          api,
+				config:       &StackConfig{Name: "mystack"},
+				cloudStack:   stackWithStatus(test.statuses[0]),
+				eventLoader:  &stubEventLoader{},
+				waiter:       &impatientWaiter{},
+				waitAttempts: 5,
+			}
+
+			events := 0
+			err := stack.WatchEvents(EventConsumerFunc(func(*cfn.StackEvent) error {
+				events++
+				return nil
+			}))
+			if test.shouldError != (err != nil) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if events != test.events {
+				t.Errorf("Expected %d polls for events, got: %d", test.events, events)
+			}
+		})
+	}
+
+	stack := &Stack{config: &StackConfig{Name: "mystack"}}
+	if err := stack.WatchEvents(EventConsumerFunc(func(*cfn.StackEvent) error { return nil })); err == nil {
+		t.Errorf("Expected an error watching a stack that doesn't exist")
+	}
+}
+
+func TestFollowEvents(t *testing.T) {
+	stop := make(chan struct{})
+	polls := 0
+	stack := &Stack{
+		config:      &StackConfig{Name: "mystack"},
+		cloudStack:  &cfn.Stack{StackId: aws.String("arn:mystack"), StackStatus: aws.String("UPDATE_COMPLETE")},
+		eventLoader: &stubEventLoader{},
+		waiter: waiterFunc(func() {
+			if polls == 3 {
+				close(stop)
+			}
+		}),
+	}
+
+	err := stack.FollowEvents(EventConsumerFunc(func(*cfn.StackEvent) error {
+		polls++
+		return nil
+	}), stop)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if polls != 4 {
+		t.Errorf("Expected to poll until stopped, polled %d times", polls)
+	}
+}